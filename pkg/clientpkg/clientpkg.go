@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/Seann-Moser/go-serve/pkg/pagination"
+	"github.com/Seann-Moser/go-serve/pkg/requestid"
 )
 
 var _ HttpClient = &Client{}
@@ -249,6 +250,7 @@ func (c *Client) SendRequest(ctx context.Context, data RequestData, p *paginatio
 	for k, v := range data.Headers {
 		req.Header.Set(snakeCaseToHeader(ToSnakeCase(k)), v)
 	}
+	requestid.Inject(ctx, req.Header)
 
 	queryParams := url.Values{}
 	data.Params["items_per_page"] = strconv.Itoa(int(p.ItemsPerPage))
@@ -184,7 +184,7 @@ func GenerateBaseClient(write bool, headers []string, endpoints ...*endpoints.En
 	jsFunctions =
 		[]string{fmt.Sprintf(`
 import {Iterator,Pagination} from "assets/iterator.js"
-
+%s
 export default defineNuxtPlugin((nuxtApp) => {
 	const api = {
 	%s
@@ -195,7 +195,7 @@ export default defineNuxtPlugin((nuxtApp) => {
         },
     };
 })
-`, strings.Join(jsFunctions, ","), ToSnakeCase(projectName))}
+`, JSCSRFHeaders(), strings.Join(jsFunctions, ","), ToSnakeCase(projectName))}
 
 	if write {
 		err = os.WriteFile(path.Join(clientDir, fmt.Sprintf("generated_%s.go", ToSnakeCase(projectName))), []byte(strings.Join(functions, "")), os.ModePerm)
@@ -3,10 +3,12 @@ package clientpkg
 import (
 	_ "embed"
 	"fmt"
+	"github.com/Seann-Moser/go-serve/server/csrf"
 	"github.com/Seann-Moser/go-serve/server/endpoints"
 	"os"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -22,6 +24,66 @@ var jsIterator string
 //go:embed templates/js_func.tmpl
 var jsFuncTmpl string
 
+// JSCSRFHeaders defines csrfHeaders(), which echoes the csrf cookie set by server/csrf in the
+// request headers of the generated clients, and the csrfOnRequest/csrfOnResponseError fetch hooks.
+// The cookie cannot be read when the api is served from another origin, csrfOnRequest then fetches
+// a token from the token endpoint before unsafe requests. Names and path come from the csrf flags.
+func JSCSRFHeaders() string {
+	cookieName, headerName, tokenPath := csrf.ClientConfig()
+	return fmt.Sprintf(jsCSRFHeaders, strconv.Quote(cookieName), strconv.Quote(headerName), strconv.Quote(tokenPath))
+}
+
+const jsCSRFHeaders = `
+const csrfCookieName = %s
+const csrfHeaderName = %s
+const csrfTokenPath = %s
+let csrfToken = ""
+
+function csrfCookie(){
+    if (typeof document === "undefined") {
+        return ""
+    }
+    for (const part of document.cookie.split(/;\s*/)) {
+        const i = part.indexOf("=")
+        if (i > 0 && part.slice(0, i) === csrfCookieName) {
+            return decodeURIComponent(part.slice(i + 1))
+        }
+    }
+    return ""
+}
+
+function csrfHeaders(){
+    const token = csrfCookie() || csrfToken
+    return token ? {[csrfHeaderName]: token} : {}
+}
+
+async function csrfOnRequest({options}){
+    const method = (options.method ?? "GET").toUpperCase()
+    if (["GET", "HEAD", "OPTIONS", "TRACE"].includes(method)) {
+        return
+    }
+    let token = csrfCookie() || csrfToken
+    if (!token) {
+        const res = await $fetch(csrfTokenPath, {baseURL: options.baseURL, credentials: "include"})
+        csrfToken = (res?.data ?? res)?.token ?? ""
+        token = csrfToken
+    }
+    if (!token) {
+        return
+    }
+    const headers = new Headers(options.headers)
+    headers.set(csrfHeaderName, token)
+    options.headers = headers
+}
+
+function csrfOnResponseError({response}){
+    if (response.status === 403) {
+        // tokens are bound to the login, fetch a new one after logging in or out
+        csrfToken = ""
+    }
+}
+`
+
 func GenerateBaseJSClient(write bool, headers []string, endpoints ...*endpoints.Endpoint) (string, error) {
 	currentPath, err := os.Getwd()
 	if err != nil {
@@ -101,7 +163,7 @@ func GenerateBaseJSClient(write bool, headers []string, endpoints ...*endpoints.
 		jsFunctionsStr := `
 import {Iterator,Pagination} from "assets/iterator.js"
 const runtimeConfig = useRuntimeConfig();
-
+` + JSCSRFHeaders() + `
 ` + strings.Join(funcs, "\n\n")
 		err = os.WriteFile(path.Join(clientDir, fmt.Sprintf("%s_%s_req.js", ToSnakeCase(projectName), ToSnakeCase(k))), []byte(jsFunctionsStr), os.ModePerm)
 		if err != nil {
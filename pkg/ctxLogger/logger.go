@@ -19,6 +19,7 @@ const (
 var ignoreContextCanceled = false
 
 var globalLogger *zap.Logger
+var level = zap.NewAtomicLevel()
 var skip = []zap.Option{zap.AddCallerSkip(1)}
 
 func Flags() *pflag.FlagSet {
@@ -66,7 +67,7 @@ func NewLoggerFromFlags() (*zap.Logger, error) {
 	return logger, nil
 }
 
-func NewLogger(production bool, level string, icc bool) (*zap.Logger, error) {
+func NewLogger(production bool, lvl string, icc bool) (*zap.Logger, error) {
 	var conf zap.Config
 	if production {
 		conf = zap.NewProductionConfig()
@@ -74,9 +75,10 @@ func NewLogger(production bool, level string, icc bool) (*zap.Logger, error) {
 		conf = zap.NewDevelopmentConfig()
 	}
 
-	if err := conf.Level.UnmarshalText([]byte(level)); err != nil {
+	if err := conf.Level.UnmarshalText([]byte(lvl)); err != nil {
 		return nil, err
 	}
+	level = conf.Level
 	ignoreContextCanceled = icc
 	logger, err := conf.Build()
 	if err != nil {
@@ -86,6 +88,17 @@ func NewLogger(production bool, level string, icc bool) (*zap.Logger, error) {
 	return logger, nil
 }
 
+// Level returns the level of the logger built by NewLogger.
+func Level() zapcore.Level {
+	return level.Level()
+}
+
+// SetLevel changes the level of the logger built by NewLogger, and every logger derived from it,
+// at runtime.
+func SetLevel(lvl string) error {
+	return level.UnmarshalText([]byte(lvl))
+}
+
 func Check(ctx context.Context, lvl zapcore.Level, msg string) *zapcore.CheckedEntry {
 	return GetLogger(ctx).WithOptions(skip...).Check(lvl, msg)
 }
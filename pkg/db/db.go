@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
@@ -28,6 +29,7 @@ import (
 // DAO represents the Data Access Object, providing methods to interact with the database.
 type DAO struct {
 	db            QueryHelper.DB
+	sqlDB         *sqlx.DB
 	updateColumns bool
 	ctx           context.Context
 	tablesNames   []string
@@ -182,6 +184,35 @@ func DeleteAll[T any](ctx context.Context, i T) error {
 	return combinedErr
 }
 
+// BeginTx starts a transaction on the underlying SQL connection and stores it in the returned context.
+func (d *DAO) BeginTx(ctx context.Context, opts *sql.TxOptions) (context.Context, *sqlx.Tx, error) {
+	if d.sqlDB == nil {
+		return ctx, nil, errors.New("dao does not support transactions")
+	}
+	tx, err := d.sqlDB.BeginTxx(ctx, opts)
+	if err != nil {
+		return ctx, nil, err
+	}
+	return ContextWithTransaction(ctx, tx), tx, nil
+}
+
+// NamedExecResult runs a named statement on the transaction in ctx, or on the connection when
+// there is none, and returns its result so callers can check the rows affected.
+func (d *DAO) NamedExecResult(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	if tx, err := ContextGetTransaction(ctx); err == nil {
+		return tx.NamedExecContext(ctx, query, arg)
+	}
+	if d.sqlDB == nil {
+		return nil, errors.New("dao does not support statement results")
+	}
+	return d.sqlDB.NamedExecContext(ctx, query, arg)
+}
+
+// ContextWithTransaction stores the transaction in the context.
+func ContextWithTransaction(ctx context.Context, tx *sqlx.Tx) context.Context {
+	return context.WithValue(ctx, "transaction", tx) //nolint:staticcheck
+}
+
 // ContextGetTransaction retrieves the transaction from the context.
 func ContextGetTransaction(ctx context.Context) (*sqlx.Tx, error) {
 	value := ctx.Value("transaction")
@@ -224,6 +255,7 @@ func NewSQLDao(ctx context.Context) (*DAO, error) {
 	QueryHelper.AddDBContext(ctx, "", d)
 	return &DAO{
 		db:            d,
+		sqlDB:         db,
 		updateColumns: viper.GetBool(DBUpdateTablesFlag),
 		tablesNames:   make([]string, 0),
 		tableColumns:  map[string]map[string]QueryHelper.Column{},
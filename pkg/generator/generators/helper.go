@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"github.com/Seann-Moser/go-serve/pkg/clientpkg"
 	"github.com/Seann-Moser/go-serve/server/endpoints"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
@@ -366,6 +367,7 @@ func writeNuxtFile(dir string, group string, code []string, isPublic bool, class
 	}
 	nuxtIt := `%s
 import {Iterator,Pagination} from "assets/iterator.js"
+%s
 %s
  function GetConfig(baseURL = "http://localhost:3000" ,data={},pagination=null){
      let params = {}
@@ -381,6 +383,9 @@ import {Iterator,Pagination} from "assets/iterator.js"
          server: false,
          method: data.method ?? "GET",
          credentials: "include",
+         headers: csrfHeaders(),
+         onRequest: csrfOnRequest,
+         onResponseError: csrfOnResponseError,
          params: mergedParams,
          baseURL: baseURL,
          path: data.path ?? "/"
@@ -399,7 +404,7 @@ export default defineNuxtPlugin((nuxtApp) => {
     };
 })`
 	n := "baseUrl" + SnakeToCamel(ToSnakeCase(group))
-	_, err = f.WriteString(fmt.Sprintf(nuxtIt, classImports, header, n, strings.Join(code, ",\n")+"\n", ToSnakeCase(group)))
+	_, err = f.WriteString(fmt.Sprintf(nuxtIt, classImports, header, clientpkg.JSCSRFHeaders(), n, strings.Join(code, ",\n")+"\n", ToSnakeCase(group)))
 	return err
 }
 
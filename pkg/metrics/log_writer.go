@@ -21,6 +21,11 @@ type AuditLog struct {
 	StatusCode int64  `json:"status_code" db:"status_code"`
 	LogType    string `json:"log_type" db:"log_type"`
 	Version    string `json:"version"`
+	RequestID  string `json:"request_id" db:"request_id"`
+	// ClientCert* describe the verified client certificate of mTLS requests.
+	ClientCertSubject  string `json:"client_cert_subject,omitempty" db:"client_cert_subject"`
+	ClientCertSerial   string `json:"client_cert_serial,omitempty" db:"client_cert_serial"`
+	ClientCertSPIFFEID string `json:"client_cert_spiffe_id,omitempty" db:"client_cert_spiffe_id"`
 }
 
 type contextKey struct {
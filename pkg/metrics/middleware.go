@@ -3,6 +3,7 @@ package metrics
 import (
 	"context"
 	"fmt"
+	"github.com/Seann-Moser/go-serve/pkg/requestid"
 	"github.com/gorilla/mux"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -152,10 +153,22 @@ func (m *Metrics) Middleware() func(next http.Handler) http.Handler {
 }
 func (m *Metrics) newAuditLog(r *http.Request) *AuditLog {
 	entry := &AuditLog{
-		Service: m.Name,
-		Path:    getRawPath(r),
-		Method:  r.Method,
-		Version: m.Version,
+		Service:   m.Name,
+		Path:      getRawPath(r),
+		Method:    r.Method,
+		Version:   m.Version,
+		RequestID: requestid.FromContext(r.Context()),
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		entry.ClientCertSubject = cert.Subject.String()
+		entry.ClientCertSerial = cert.SerialNumber.String()
+		for _, u := range cert.URIs {
+			if u.Scheme == "spiffe" {
+				entry.ClientCertSPIFFEID = u.String()
+				break
+			}
+		}
 	}
 	return entry
 }
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAuditLog_ClientCert(t *testing.T) {
+	m := &Metrics{Name: "svc"}
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	entry := m.newAuditLog(r)
+	assert.Empty(t, entry.ClientCertSubject)
+
+	spiffe, _ := url.Parse("spiffe://corp/billing")
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{
+		Subject:      pkix.Name{CommonName: "billing"},
+		SerialNumber: big.NewInt(42),
+		URIs:         []*url.URL{spiffe},
+	}}}}
+	entry = m.newAuditLog(r)
+	assert.Equal(t, "CN=billing", entry.ClientCertSubject)
+	assert.Equal(t, "42", entry.ClientCertSerial)
+	assert.Equal(t, "spiffe://corp/billing", entry.ClientCertSPIFFEID)
+}
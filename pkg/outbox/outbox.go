@@ -0,0 +1,99 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Seann-Moser/go-serve/pkg/db"
+)
+
+// ErrLeaseLost is returned by Store.Update when the message is no longer leased to the caller,
+// e.g. because its lease ran out and another relay claimed it.
+var ErrLeaseLost = errors.New("outbox message lease lost")
+
+const (
+	StatusPending = "pending"
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+)
+
+// OutboxMessage is a single event waiting in the outbox table to be relayed to a publisher.
+type OutboxMessage struct {
+	ID          string `db:"id" json:"id" qc:"primary;data_type::varchar(64);where::="`
+	Topic       string `db:"topic" json:"topic" qc:"data_type::varchar(512);where::="`
+	Payload     string `db:"payload" json:"payload" qc:"data_type::text"`
+	Status      string `db:"status" json:"status" qc:"data_type::varchar(32);update;where::="`
+	Attempts    int    `db:"attempts" json:"attempts" qc:"update"`
+	LastError   string `db:"last_error" json:"last_error" qc:"data_type::text;update"`
+	AvailableAt int64  `db:"available_at" json:"available_at" qc:"data_type::bigint;update;where::<="`
+	CreatedAt   int64  `db:"created_at" json:"created_at" qc:"data_type::bigint"`
+	SentAt      int64  `db:"sent_at" json:"sent_at" qc:"data_type::bigint;update;where::<"`
+	LockedBy    string `db:"locked_by" json:"locked_by" qc:"data_type::varchar(64);update"`
+}
+
+// Store persists outbox messages. Add must write through tx when it is not nil so the
+// message commits or rolls back together with the caller's own rows.
+type Store interface {
+	Add(ctx context.Context, tx *sqlx.Tx, msgs ...*OutboxMessage) error
+	// Claim returns up to limit pending messages available at now and leases them to owner
+	// until leaseUntil by moving their AvailableAt, so concurrent relays never get the same row.
+	// A relay that dies before updating a message leaves it to be claimed again after the lease.
+	Claim(ctx context.Context, owner string, now, leaseUntil time.Time, limit int, topics ...string) ([]*OutboxMessage, error)
+	// Update stores the outcome of a claimed message. It returns ErrLeaseLost when the message
+	// is no longer leased to owner, so a relay whose lease ran out cannot overwrite the row.
+	Update(ctx context.Context, owner string, msg *OutboxMessage) error
+	DeleteSentBefore(ctx context.Context, cutoff time.Time) error
+}
+
+// NewMessage encodes data as the payload of a new pending outbox message for topic.
+func NewMessage[T any](topic string, data *T) (*OutboxMessage, error) {
+	if topic == "" {
+		return nil, fmt.Errorf("topic is required")
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshalling outbox payload: %w", err)
+	}
+	now := time.Now().Unix()
+	return &OutboxMessage{
+		ID:          uuid.New().String(),
+		Topic:       topic,
+		Payload:     string(b),
+		Status:      StatusPending,
+		AvailableAt: now,
+		CreatedAt:   now,
+	}, nil
+}
+
+// Write adds data to the outbox for topic using the transaction stored in ctx by db.DAO.BeginTx
+// or db.ContextWithTransaction. It fails without one: written on its own the message could be
+// relayed for changes that roll back, or lost for changes that commit.
+func Write[T any](ctx context.Context, store Store, topic string, data *T) error {
+	tx, err := db.ContextGetTransaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed writing outbox message: %w", err)
+	}
+	if tx == nil {
+		return fmt.Errorf("failed writing outbox message: no valid transaction in context")
+	}
+	msg, err := NewMessage(topic, data)
+	if err != nil {
+		return err
+	}
+	return store.Add(ctx, tx, msg)
+}
+
+// Decode unmarshals the payload of the message into T.
+func Decode[T any](msg *OutboxMessage) (*T, error) {
+	var data T
+	if err := json.Unmarshal([]byte(msg.Payload), &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
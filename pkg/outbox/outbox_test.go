@@ -0,0 +1,177 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Seann-Moser/go-serve/pkg/db"
+	"github.com/Seann-Moser/go-serve/pkg/ps"
+)
+
+type testEvent struct {
+	Name string `json:"name"`
+}
+
+type failingPublisher struct {
+	calls int
+}
+
+func (f *failingPublisher) PublishSync(ctx context.Context, topic string, data *testEvent) error {
+	f.calls++
+	return errors.New("broker unavailable")
+}
+
+// txCtx stores a transaction for Write, which the in-memory store ignores.
+func txCtx(ctx context.Context) context.Context {
+	return db.ContextWithTransaction(ctx, &sqlx.Tx{})
+}
+
+func TestWrite_RequiresTransaction(t *testing.T) {
+	store := NewInMemoryStore()
+	assert.Error(t, Write(context.Background(), store, "events", &testEvent{Name: "created"}))
+	pending, err := store.Claim(context.Background(), "relay-1", time.Now(), time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending, "nothing is written outside a transaction")
+}
+
+func TestRelay_PublishesPendingMessages(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStore()
+	pubsub := ps.NewInMemoryPubSub[testEvent]()
+	defer pubsub.Close()
+
+	sub, err := pubsub.Subscribe(ctx, "events")
+	require.NoError(t, err)
+
+	require.NoError(t, Write(txCtx(ctx), store, "events", &testEvent{Name: "created"}))
+
+	relay := NewRelay[testEvent](store, pubsub)
+	sent, err := relay.Process(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+
+	msg, err := sub.Pop(ctx, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "created", msg.Data().Name)
+
+	pending, err := store.Claim(ctx, "relay-1", time.Now(), time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestInMemoryStore_ClaimLeasesMessages(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStore()
+	require.NoError(t, Write(txCtx(ctx), store, "events", &testEvent{Name: "created"}))
+
+	now := time.Now()
+	claimed, err := store.Claim(ctx, "relay-1", now, now.Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+
+	// a second relay polling during the lease gets nothing
+	again, err := store.Claim(ctx, "relay-2", now, now.Add(time.Minute), 10)
+	require.NoError(t, err)
+	assert.Empty(t, again)
+
+	// a relay that died leaves the message to be claimed after the lease
+	again, err = store.Claim(ctx, "relay-2", now.Add(2*time.Minute), now.Add(3*time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, again, 1)
+
+	// the first relay lost its lease and cannot overwrite the row anymore
+	claimed[0].Status = StatusSent
+	assert.ErrorIs(t, store.Update(ctx, "relay-1", claimed[0]), ErrLeaseLost)
+	again[0].Status = StatusSent
+	require.NoError(t, store.Update(ctx, "relay-2", again[0]))
+	stored, _ := store.Get(again[0].ID)
+	assert.Equal(t, StatusSent, stored.Status)
+}
+
+func TestRelay_RetriesWithBackoff(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStore()
+	publisher := &failingPublisher{}
+
+	msg, err := NewMessage("events", &testEvent{Name: "created"})
+	require.NoError(t, err)
+	require.NoError(t, store.Add(ctx, nil, msg))
+
+	relay := NewRelay[testEvent](store, publisher)
+	relay.MaxAttempts = 2
+	relay.InitialBackoff = time.Hour
+
+	_, err = relay.Process(ctx)
+	require.NoError(t, err)
+
+	stored, _ := store.Get(msg.ID)
+	assert.Equal(t, StatusPending, stored.Status)
+	assert.Equal(t, 1, stored.Attempts)
+	assert.Greater(t, stored.AvailableAt, time.Now().Unix())
+	assert.Equal(t, "broker unavailable", stored.LastError)
+
+	// the message is not retried before its backoff expires
+	_, err = relay.Process(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, publisher.calls)
+
+	stored.AvailableAt = time.Now().Unix()
+	require.NoError(t, store.Update(ctx, relay.ID, stored))
+	_, err = relay.Process(ctx)
+	require.NoError(t, err)
+
+	stored, _ = store.Get(msg.ID)
+	assert.Equal(t, StatusFailed, stored.Status)
+	assert.Equal(t, 2, stored.Attempts)
+}
+
+func TestRelay_TopicFilter(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStore()
+	publisher := &failingPublisher{}
+
+	require.NoError(t, Write(txCtx(ctx), store, "other", &testEvent{Name: "ignored"}))
+
+	relay := NewRelay[testEvent](store, publisher, "events")
+	sent, err := relay.Process(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Equal(t, 0, publisher.calls)
+}
+
+func TestRelay_RetryDelay(t *testing.T) {
+	relay := NewRelay[testEvent](NewInMemoryStore(), &failingPublisher{})
+	relay.InitialBackoff = time.Second
+	relay.MaxBackoff = 5 * time.Second
+
+	assert.Equal(t, time.Second, relay.retryDelay(1))
+	assert.Equal(t, 2*time.Second, relay.retryDelay(2))
+	assert.Equal(t, 4*time.Second, relay.retryDelay(3))
+	assert.Equal(t, 5*time.Second, relay.retryDelay(4))
+}
+
+func TestCleaner_RemovesOldSentMessages(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStore()
+
+	old, _ := NewMessage("events", &testEvent{Name: "old"})
+	old.Status = StatusSent
+	old.SentAt = time.Now().Add(-48 * time.Hour).Unix()
+	recent, _ := NewMessage("events", &testEvent{Name: "recent"})
+	recent.Status = StatusSent
+	recent.SentAt = time.Now().Unix()
+	require.NoError(t, store.Add(ctx, nil, old, recent))
+
+	require.NoError(t, NewCleaner(store, 24*time.Hour, time.Hour).Cleanup(ctx))
+
+	_, found := store.Get(old.ID)
+	assert.False(t, found)
+	_, found = store.Get(recent.ID)
+	assert.True(t, found)
+}
@@ -0,0 +1,209 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/ps"
+)
+
+const (
+	outboxPollIntervalFlag    = "outbox-poll-interval"
+	outboxBatchSizeFlag       = "outbox-batch-size"
+	outboxMaxAttemptsFlag     = "outbox-max-attempts"
+	outboxInitialBackoffFlag  = "outbox-initial-backoff"
+	outboxMaxBackoffFlag      = "outbox-max-backoff"
+	outboxLeaseFlag           = "outbox-lease"
+	outboxRetentionFlag       = "outbox-retention"
+	outboxCleanupIntervalFlag = "outbox-cleanup-interval"
+)
+
+func Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("outbox", pflag.ExitOnError)
+	fs.Duration(outboxPollIntervalFlag, time.Second, "how often the relay polls for pending messages")
+	fs.Int(outboxBatchSizeFlag, 100, "max messages relayed per poll")
+	fs.Int(outboxMaxAttemptsFlag, 10, "publish attempts before a message is marked failed")
+	fs.Duration(outboxInitialBackoffFlag, time.Second, "delay before the first retry")
+	fs.Duration(outboxMaxBackoffFlag, 5*time.Minute, "max delay between retries")
+	fs.Duration(outboxLeaseFlag, time.Minute, "how long a claimed batch is reserved for one relay")
+	fs.Duration(outboxRetentionFlag, 7*24*time.Hour, "how long sent messages are kept")
+	fs.Duration(outboxCleanupIntervalFlag, time.Hour, "how often sent messages are cleaned up")
+	return fs
+}
+
+// Relay claims pending messages from a Store and publishes them one at a time through a
+// ps.SyncPublisher, so a failed publish is retried instead of recorded as sent. Relays on several
+// replicas share the store: each batch is leased to one relay for Lease. Delivery is
+// at-least-once: a crash between publishing and marking a row as sent publishes it again once
+// the lease ends.
+type Relay[T any] struct {
+	// ID owns the leases of the relay. It is random by default; relays must not share one.
+	ID             string
+	store          Store
+	publisher      ps.SyncPublisher[T]
+	topics         []string
+	PollInterval   time.Duration
+	BatchSize      int
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Lease          time.Duration
+}
+
+// NewRelay creates a relay for the given topics. With no topics every pending message is
+// relayed, so all rows in the store must decode into T.
+func NewRelay[T any](store Store, publisher ps.SyncPublisher[T], topics ...string) *Relay[T] {
+	return &Relay[T]{
+		ID:             uuid.New().String(),
+		store:          store,
+		publisher:      publisher,
+		topics:         topics,
+		PollInterval:   time.Second,
+		BatchSize:      100,
+		MaxAttempts:    10,
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Minute,
+		Lease:          time.Minute,
+	}
+}
+
+func NewRelayFromFlags[T any](store Store, publisher ps.SyncPublisher[T], topics ...string) *Relay[T] {
+	r := NewRelay[T](store, publisher, topics...)
+	r.PollInterval = viper.GetDuration(outboxPollIntervalFlag)
+	r.BatchSize = viper.GetInt(outboxBatchSizeFlag)
+	r.MaxAttempts = viper.GetInt(outboxMaxAttemptsFlag)
+	r.InitialBackoff = viper.GetDuration(outboxInitialBackoffFlag)
+	r.MaxBackoff = viper.GetDuration(outboxMaxBackoffFlag)
+	r.Lease = viper.GetDuration(outboxLeaseFlag)
+	return r
+}
+
+// Run polls the store until ctx is canceled.
+func (r *Relay[T]) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.Process(ctx); err != nil {
+			ctxLogger.Warn(ctx, "failed relaying outbox messages", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process relays one batch of pending messages and returns how many were published.
+func (r *Relay[T]) Process(ctx context.Context) (int, error) {
+	now := time.Now()
+	msgs, err := r.store.Claim(ctx, r.ID, now, now.Add(r.Lease), r.BatchSize, r.topics...)
+	if err != nil {
+		return 0, fmt.Errorf("failed claiming pending outbox messages: %w", err)
+	}
+	sent := 0
+	for _, msg := range msgs {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		pubErr := r.publish(ctx, msg)
+		now = time.Now()
+		msg.Attempts++
+		if pubErr == nil {
+			msg.Status = StatusSent
+			msg.SentAt = now.Unix()
+			msg.LastError = ""
+			sent++
+		} else {
+			msg.LastError = pubErr.Error()
+			if r.MaxAttempts > 0 && msg.Attempts >= r.MaxAttempts {
+				msg.Status = StatusFailed
+			} else {
+				msg.AvailableAt = now.Add(r.retryDelay(msg.Attempts)).Unix()
+			}
+			ctxLogger.Warn(ctx, "failed publishing outbox message",
+				zap.String("id", msg.ID),
+				zap.String("topic", msg.Topic),
+				zap.Int("attempts", msg.Attempts),
+				zap.Error(pubErr))
+		}
+		err := r.store.Update(ctx, r.ID, msg)
+		if errors.Is(err, ErrLeaseLost) {
+			// the lease ran out while publishing and another relay owns the row now
+			ctxLogger.Warn(ctx, "lost lease of outbox message", zap.String("id", msg.ID))
+			continue
+		}
+		if err != nil {
+			return sent, fmt.Errorf("failed updating outbox message %s: %w", msg.ID, err)
+		}
+	}
+	return sent, nil
+}
+
+func (r *Relay[T]) publish(ctx context.Context, msg *OutboxMessage) error {
+	data, err := Decode[T](msg)
+	if err != nil {
+		return fmt.Errorf("failed decoding payload: %w", err)
+	}
+	return r.publisher.PublishSync(ctx, msg.Topic, data)
+}
+
+// retryDelay doubles InitialBackoff for every attempt, capped at MaxBackoff.
+func (r *Relay[T]) retryDelay(attempts int) time.Duration {
+	delay := r.InitialBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if r.MaxBackoff > 0 && delay >= r.MaxBackoff {
+			return r.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// Cleaner periodically deletes sent messages older than Retention.
+type Cleaner struct {
+	store     Store
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+func NewCleaner(store Store, retention, interval time.Duration) *Cleaner {
+	return &Cleaner{
+		store:     store,
+		Retention: retention,
+		Interval:  interval,
+	}
+}
+
+func NewCleanerFromFlags(store Store) *Cleaner {
+	return NewCleaner(store, viper.GetDuration(outboxRetentionFlag), viper.GetDuration(outboxCleanupIntervalFlag))
+}
+
+// Run deletes old rows every Interval until ctx is canceled.
+func (c *Cleaner) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		if err := c.Cleanup(ctx); err != nil {
+			ctxLogger.Warn(ctx, "failed cleaning up outbox", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cleanup deletes sent messages older than Retention.
+func (c *Cleaner) Cleanup(ctx context.Context) error {
+	return c.store.DeleteSentBefore(ctx, time.Now().Add(-c.Retention))
+}
@@ -0,0 +1,139 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Seann-Moser/QueryHelper"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/Seann-Moser/go-serve/pkg/db"
+)
+
+var _ Store = &DAOStore{}
+
+// DAOStore keeps the outbox in a QueryHelper table registered on a db.DAO.
+type DAOStore struct {
+	dao   *db.DAO
+	table *QueryHelper.Table[OutboxMessage]
+}
+
+// NewDAOStore registers the outbox table on the dao and returns a Store backed by it.
+func NewDAOStore(ctx context.Context, dao *db.DAO, dataset string) (*DAOStore, error) {
+	tableCtx, err := db.AddTable[OutboxMessage](ctx, dao, dataset, QueryHelper.QueryTypeSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed adding outbox table: %w", err)
+	}
+	table, err := QueryHelper.GetTableCtx[OutboxMessage](tableCtx)
+	if err != nil {
+		return nil, err
+	}
+	return &DAOStore{dao: dao, table: table}, nil
+}
+
+func (s *DAOStore) Add(ctx context.Context, tx *sqlx.Tx, msgs ...*OutboxMessage) error {
+	for _, msg := range msgs {
+		if tx == nil {
+			if _, err := s.table.Insert(ctx, nil, *msg); err != nil {
+				return fmt.Errorf("failed inserting outbox message: %w", err)
+			}
+			continue
+		}
+		args, err := insertArgs(msg)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.NamedExecContext(ctx, s.table.InsertStatement(1), args); err != nil {
+			return fmt.Errorf("failed inserting outbox message: %w", err)
+		}
+	}
+	return nil
+}
+
+// Claim leases candidate rows one at a time with a conditional update on their AvailableAt.
+// A row another relay claimed first no longer matches and is skipped.
+func (s *DAOStore) Claim(ctx context.Context, owner string, now, leaseUntil time.Time, limit int, topics ...string) ([]*OutboxMessage, error) {
+	q := QueryHelper.QueryTable[OutboxMessage](s.table)
+	q.Where(q.Column("status"), "=", "AND", 0, StatusPending).
+		Where(q.Column("available_at"), "<=", "AND", 0, now.Unix())
+	if len(topics) > 0 {
+		q.Where(q.Column("topic"), "in", "AND", 0, topics)
+	}
+	candidates, err := q.OrderBy(q.Column("available_at")).Limit(limit).Run(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	claim := fmt.Sprintf("UPDATE %s SET available_at = :lease, locked_by = :owner WHERE id = :id AND status = :status AND available_at = :available_at", s.table.FullTableName())
+	var output []*OutboxMessage
+	for _, msg := range candidates {
+		result, err := s.dao.NamedExecResult(ctx, claim, map[string]interface{}{
+			"lease":        leaseUntil.Unix(),
+			"owner":        owner,
+			"id":           msg.ID,
+			"status":       StatusPending,
+			"available_at": msg.AvailableAt,
+		})
+		if err != nil {
+			return output, fmt.Errorf("failed claiming outbox message: %w", err)
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected != 1 {
+			continue
+		}
+		msg.AvailableAt = leaseUntil.Unix()
+		msg.LockedBy = owner
+		output = append(output, msg)
+	}
+	return output, nil
+}
+
+// Update only matches the row while owner still holds its lease.
+func (s *DAOStore) Update(ctx context.Context, owner string, msg *OutboxMessage) error {
+	result, err := s.dao.NamedExecResult(ctx,
+		fmt.Sprintf("UPDATE %s SET status = :status, attempts = :attempts, last_error = :last_error, available_at = :available_at, sent_at = :sent_at WHERE id = :id AND locked_by = :owner", s.table.FullTableName()),
+		map[string]interface{}{
+			"id":           msg.ID,
+			"owner":        owner,
+			"status":       msg.Status,
+			"attempts":     msg.Attempts,
+			"last_error":   msg.LastError,
+			"available_at": msg.AvailableAt,
+			"sent_at":      msg.SentAt,
+		})
+	if err != nil {
+		return fmt.Errorf("failed updating outbox message: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed updating outbox message: %w", err)
+	} else if n != 1 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (s *DAOStore) DeleteSentBefore(ctx context.Context, cutoff time.Time) error {
+	return s.table.NamedExec(ctx, nil,
+		fmt.Sprintf("DELETE FROM %s WHERE status = :status AND sent_at < :sent_at", s.table.FullTableName()),
+		map[string]interface{}{
+			"status":  StatusSent,
+			"sent_at": cutoff.Unix(),
+		})
+}
+
+// insertArgs maps the message onto the row-prefixed names used by Table.InsertStatement.
+func insertArgs(msg *OutboxMessage) (map[string]interface{}, error) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	row := map[string]interface{}{}
+	if err := json.Unmarshal(b, &row); err != nil {
+		return nil, err
+	}
+	args := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		args["0_"+k] = v
+	}
+	return args, nil
+}
@@ -0,0 +1,102 @@
+package outbox
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var _ Store = &InMemoryStore{}
+
+// InMemoryStore is an in-memory Store. It ignores transactions and is meant for tests.
+type InMemoryStore struct {
+	mu       sync.Mutex
+	messages map[string]*OutboxMessage
+}
+
+// NewInMemoryStore creates an empty InMemoryStore.
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		messages: map[string]*OutboxMessage{},
+	}
+}
+
+func (s *InMemoryStore) Add(ctx context.Context, tx *sqlx.Tx, msgs ...*OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, msg := range msgs {
+		m := *msg
+		s.messages[m.ID] = &m
+	}
+	return nil
+}
+
+func (s *InMemoryStore) Claim(ctx context.Context, owner string, now, leaseUntil time.Time, limit int, topics ...string) ([]*OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	allowed := map[string]bool{}
+	for _, t := range topics {
+		allowed[t] = true
+	}
+	var output []*OutboxMessage
+	for _, msg := range s.messages {
+		if msg.Status != StatusPending || msg.AvailableAt > now.Unix() {
+			continue
+		}
+		if len(allowed) > 0 && !allowed[msg.Topic] {
+			continue
+		}
+		output = append(output, msg)
+	}
+	sort.Slice(output, func(i, j int) bool {
+		return output[i].AvailableAt < output[j].AvailableAt
+	})
+	if limit > 0 && len(output) > limit {
+		output = output[:limit]
+	}
+	for i, msg := range output {
+		msg.AvailableAt = leaseUntil.Unix()
+		msg.LockedBy = owner
+		m := *msg
+		output[i] = &m
+	}
+	return output, nil
+}
+
+func (s *InMemoryStore) Update(ctx context.Context, owner string, msg *OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, found := s.messages[msg.ID]; !found || current.LockedBy != owner {
+		return ErrLeaseLost
+	}
+	m := *msg
+	m.LockedBy = owner
+	s.messages[m.ID] = &m
+	return nil
+}
+
+func (s *InMemoryStore) DeleteSentBefore(ctx context.Context, cutoff time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, msg := range s.messages {
+		if msg.Status == StatusSent && msg.SentAt < cutoff.Unix() {
+			delete(s.messages, id)
+		}
+	}
+	return nil
+}
+
+// Get returns a copy of the message with the given id.
+func (s *InMemoryStore) Get(id string) (*OutboxMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg, found := s.messages[id]
+	if !found {
+		return nil, false
+	}
+	m := *msg
+	return &m, true
+}
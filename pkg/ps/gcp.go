@@ -7,21 +7,45 @@ import (
 	"fmt"
 	"github.com/Seann-Moser/go-serve/pkg/clientpkg"
 	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/google/uuid"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/api/option"
+	"strconv"
+	"sync"
 	"time"
 )
 
 var _ PubSub[any] = &GCPPubSub[any]{}
+var _ ScheduledPublisher[any] = &GCPPubSub[any]{}
+var _ PatternSubscriber[any] = &GCPPubSub[any]{}
+var _ SyncPublisher[any] = &GCPPubSub[any]{}
+
+const (
+	gcpScheduledIDAttribute     = "ps-scheduled-id"
+	gcpScheduledAtAttribute     = "ps-deliver-at"
+	gcpScheduledTopicAttribute  = "ps-target-topic"
+	gcpScheduledCancelAttribute = "ps-cancel-id"
+
+	// gcpScheduledHoldWindow is how far ahead of its delivery time a scheduled message is held
+	// by the receiver instead of being nacked back to the holding subscription.
+	gcpScheduledHoldWindow = time.Minute
+)
 
 // GCPPubSub implements the PubSub interface using Google Cloud Pub/Sub.
 type GCPPubSub[T any] struct {
-	client              *pubsub.Client
-	defaultTopic        string
-	defaultSubscription string
+	client                *pubsub.Client
+	defaultTopic          string
+	defaultSubscription   string
+	scheduledTopic        string
+	scheduledSubscription string
+
+	schedulerOnce   sync.Once
+	schedulerCancel context.CancelFunc
+	canceledMu      sync.Mutex
+	canceled        map[string]bool
 }
 
 func GCPPubSubFlags(prefix string) *pflag.FlagSet {
@@ -31,6 +55,8 @@ func GCPPubSubFlags(prefix string) *pflag.FlagSet {
 	fs.String(clientpkg.GetFlagWithPrefix(prefix, "credentials-file"), "", "Path to GCP service account credentials JSON file")
 	fs.String(clientpkg.GetFlagWithPrefix(prefix, "default-topic"), "", "Default Pub/Sub topic name")
 	fs.String(clientpkg.GetFlagWithPrefix(prefix, "default-subscription"), "", "Default Pub/Sub subscription name")
+	fs.String(clientpkg.GetFlagWithPrefix(prefix, "scheduled-topic"), "", "Holding topic for scheduled messages")
+	fs.String(clientpkg.GetFlagWithPrefix(prefix, "scheduled-subscription"), "", "Holding subscription that releases scheduled messages")
 
 	return fs
 }
@@ -42,6 +68,8 @@ func NewGCPPubSubFromFlags[T any](ctx context.Context, prefix string) (*GCPPubSu
 	credentialsFile := viper.GetString(clientpkg.GetFlagWithPrefix(prefix, "credentials-file"))
 	defaultTopic := viper.GetString(clientpkg.GetFlagWithPrefix(prefix, "default-topic"))
 	defaultSubscription := viper.GetString(clientpkg.GetFlagWithPrefix(prefix, "default-subscription"))
+	scheduledTopic := viper.GetString(clientpkg.GetFlagWithPrefix(prefix, "scheduled-topic"))
+	scheduledSubscription := viper.GetString(clientpkg.GetFlagWithPrefix(prefix, "scheduled-subscription"))
 
 	// Validate required flags
 	if projectID == "" {
@@ -63,6 +91,8 @@ func NewGCPPubSubFromFlags[T any](ctx context.Context, prefix string) (*GCPPubSu
 	// Assign default topic and subscription if provided
 	pubsubClient.defaultTopic = defaultTopic
 	pubsubClient.defaultSubscription = defaultSubscription
+	pubsubClient.scheduledTopic = scheduledTopic
+	pubsubClient.scheduledSubscription = scheduledSubscription
 
 	return pubsubClient, nil
 }
@@ -74,7 +104,8 @@ func NewGCPPubSub[T any](ctx context.Context, projectID string, opts ...option.C
 		return nil, fmt.Errorf("failed to create pubsub client: %w", err)
 	}
 	return &GCPPubSub[T]{
-		client: client,
+		client:   client,
+		canceled: map[string]bool{},
 	}, nil
 }
 
@@ -102,6 +133,7 @@ func (g *GCPPubSub[T]) Publish(ctx context.Context, topic string, data chan *T,
 				ctxLogger.Info(ctx, "attempting to publish message")
 				b, err := json.Marshal(d)
 				if err != nil {
+					recordPublish(ctx, topic, err)
 					ctxLogger.Error(ctx, "failed marshalling data", zap.Error(err))
 					continue
 				}
@@ -109,6 +141,7 @@ func (g *GCPPubSub[T]) Publish(ctx context.Context, topic string, data chan *T,
 					Data: b,
 				})
 				_, err = result.Get(ctx)
+				recordPublish(ctx, topic, err)
 				if err != nil {
 					ctxLogger.Warn(ctx, "failed to publish msg", zap.Error(err))
 					continue
@@ -157,17 +190,16 @@ func (g *GCPPubSub[T]) Subscribe(ctx context.Context, subscriptionName string) (
 				return
 			}
 
-			subscription.c <- &SubscriptionData[T]{
-				data: &d,
-				Ack: func(ctx context.Context) error {
+			subscription.c <- newSubscriptionData(ctx, subscriptionName, &d, msg.PublishTime,
+				func(ctx context.Context) error {
 					msg.Ack()
 					return nil
 				},
-				Nack: func(ctx context.Context) error {
+				func(ctx context.Context) error {
 					msg.Nack()
 					return nil
 				},
-			}
+			)
 		})
 		if err != nil {
 			ctxLogger.Warn(ctx, "failed to receive subscription data", zap.Error(err))
@@ -178,12 +210,176 @@ func (g *GCPPubSub[T]) Subscribe(ctx context.Context, subscriptionName string) (
 	return subscription, nil
 }
 
+// SubscribePattern is not supported: GCP subscriptions are bound to a single topic.
+// Route event families into one topic with a filter on the subscription instead.
+func (g *GCPPubSub[T]) SubscribePattern(ctx context.Context, pattern string) (*Subscription[T], error) {
+	return nil, fmt.Errorf("gcp pubsub: %w", ErrPatternUnsupported)
+}
+
 // Close closes the Pub/Sub client.
 // It should be called when the client is no longer needed.
 func (g *GCPPubSub[T]) Close() error {
+	if g.schedulerCancel != nil {
+		g.schedulerCancel()
+	}
 	return g.client.Close()
 }
 
 func (g *GCPPubSub[T]) Ping(ctx context.Context, timeout time.Duration) error {
 	return nil
 }
+
+// PublishSync publishes data to topic and waits for the server to acknowledge it.
+func (g *GCPPubSub[T]) PublishSync(ctx context.Context, topic string, data *T) error {
+	if topic == "" {
+		topic = g.defaultTopic
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		recordPublish(ctx, topic, err)
+		return fmt.Errorf("failed marshalling data: %w", err)
+	}
+	t := g.client.Topic(topic)
+	defer t.Stop()
+	_, err = t.Publish(ctx, &pubsub.Message{Data: b}).Get(ctx)
+	recordPublish(ctx, topic, err)
+	if err != nil {
+		return fmt.Errorf("failed to publish msg: %w", err)
+	}
+	return nil
+}
+
+// PublishAt publishes data to the holding topic with its target topic and delivery time as
+// attributes. The receiver on the holding subscription republishes it to topic once it is due.
+// Configure a retry policy with a large maximum backoff on the holding subscription, since
+// messages that are not due yet are nacked back to it.
+func (g *GCPPubSub[T]) PublishAt(ctx context.Context, topic string, at time.Time, data *T) (string, error) {
+	if topic == "" {
+		topic = g.defaultTopic
+	}
+	if g.scheduledTopic == "" {
+		return "", fmt.Errorf("scheduled-topic is required for scheduled messages")
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed marshalling scheduled message: %w", err)
+	}
+	id := uuid.New().String()
+	result := g.client.Topic(g.scheduledTopic).Publish(ctx, &pubsub.Message{
+		Data: b,
+		Attributes: map[string]string{
+			gcpScheduledIDAttribute:    id,
+			gcpScheduledAtAttribute:    strconv.FormatInt(at.UnixMilli(), 10),
+			gcpScheduledTopicAttribute: topic,
+		},
+	})
+	if _, err := result.Get(ctx); err != nil {
+		return "", fmt.Errorf("failed scheduling message: %w", err)
+	}
+	if g.scheduledSubscription != "" {
+		g.schedulerOnce.Do(func() {
+			schedulerCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+			g.schedulerCancel = cancel
+			go func() {
+				if err := g.RunScheduler(schedulerCtx); err != nil {
+					ctxLogger.Warn(schedulerCtx, "scheduled message receiver stopped", zap.Error(err))
+				}
+			}()
+		})
+	}
+	return id, nil
+}
+
+// PublishAfter schedules data to be published to topic once delay has passed.
+func (g *GCPPubSub[T]) PublishAfter(ctx context.Context, topic string, delay time.Duration, data *T) (string, error) {
+	return g.PublishAt(ctx, topic, time.Now().Add(delay), data)
+}
+
+// CancelScheduled publishes a cancel marker to the holding topic. Pub/Sub cannot remove a
+// published message, so the receiver drops the scheduled message when it next sees it.
+// Markers are kept in memory by the receiver that gets them, which means cancellation is only
+// reliable with a single receiver on the holding subscription. Unlike the other backends it
+// cannot tell whether id exists and never returns ErrScheduledNotFound.
+func (g *GCPPubSub[T]) CancelScheduled(ctx context.Context, id string) error {
+	if g.scheduledTopic == "" {
+		return fmt.Errorf("scheduled-topic is required for scheduled messages")
+	}
+	result := g.client.Topic(g.scheduledTopic).Publish(ctx, &pubsub.Message{
+		Data:       []byte("{}"),
+		Attributes: map[string]string{gcpScheduledCancelAttribute: id},
+	})
+	if _, err := result.Get(ctx); err != nil {
+		return fmt.Errorf("failed canceling scheduled message: %w", err)
+	}
+	return nil
+}
+
+// RunScheduler receives from the holding subscription and republishes due messages until ctx
+// is canceled. It is started automatically by PublishAt when scheduled-subscription is set.
+func (g *GCPPubSub[T]) RunScheduler(ctx context.Context) error {
+	if g.scheduledSubscription == "" {
+		return fmt.Errorf("scheduled-subscription is required for scheduled messages")
+	}
+	sub := g.client.Subscription(g.scheduledSubscription)
+	return sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		if id := msg.Attributes[gcpScheduledCancelAttribute]; id != "" {
+			g.markCanceled(id)
+			msg.Ack()
+			return
+		}
+		id := msg.Attributes[gcpScheduledIDAttribute]
+		topic := msg.Attributes[gcpScheduledTopicAttribute]
+		atMillis, err := strconv.ParseInt(msg.Attributes[gcpScheduledAtAttribute], 10, 64)
+		if id == "" || topic == "" || err != nil {
+			ctxLogger.Warn(ctx, "dropping malformed scheduled message", zap.String("id", id))
+			msg.Ack()
+			return
+		}
+		wait := time.Until(time.UnixMilli(atMillis))
+		if wait > gcpScheduledHoldWindow {
+			msg.Nack()
+			return
+		}
+		if wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				msg.Nack()
+				return
+			case <-t.C:
+			}
+		}
+		if g.takeCanceled(id) {
+			msg.Ack()
+			return
+		}
+		_, err = g.client.Topic(topic).Publish(ctx, &pubsub.Message{Data: msg.Data}).Get(ctx)
+		recordPublish(ctx, topic, err)
+		if err != nil {
+			ctxLogger.Warn(ctx, "failed publishing scheduled message", zap.String("id", id), zap.Error(err))
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+	})
+}
+
+func (g *GCPPubSub[T]) markCanceled(id string) {
+	g.canceledMu.Lock()
+	defer g.canceledMu.Unlock()
+	if g.canceled == nil {
+		g.canceled = map[string]bool{}
+	}
+	g.canceled[id] = true
+}
+
+func (g *GCPPubSub[T]) takeCanceled(id string) bool {
+	g.canceledMu.Lock()
+	defer g.canceledMu.Unlock()
+	if !g.canceled[id] {
+		return false
+	}
+	delete(g.canceled, id)
+	return true
+}
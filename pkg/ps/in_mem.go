@@ -1,14 +1,25 @@
 package ps
 
 import (
+	"container/heap"
 	"context"
 	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 var _ PubSub[any] = &InMemoryPubSub[any]{}
+var _ ScheduledPublisher[any] = &InMemoryPubSub[any]{}
+var _ PatternSubscriber[any] = &InMemoryPubSub[any]{}
+var _ SyncPublisher[any] = &InMemoryPubSub[any]{}
+
+type patternSubscriber[T any] struct {
+	pattern string
+	c       chan *SubscriptionData[T]
+}
 
 // InMemoryPubSub is an in-memory implementation of the PubSub interface.
 // It is suitable for testing or scenarios where external dependencies are not desired.
@@ -16,13 +27,24 @@ type InMemoryPubSub[T any] struct {
 	mu          sync.RWMutex
 	dispatchMu  sync.Mutex
 	subscribers map[string][]chan *SubscriptionData[T]
+	patterns    []*patternSubscriber[T]
 	closed      bool
+
+	scheduleMu    sync.Mutex
+	schedule      scheduleHeap[T]
+	scheduled     map[string]*scheduledItem[T]
+	scheduleWake  chan struct{}
+	scheduleStop  chan struct{}
+	schedulerOnce sync.Once
 }
 
 // NewInMemoryPubSub creates a new instance of InMemoryPubSub.
 func NewInMemoryPubSub[T any]() *InMemoryPubSub[T] {
 	return &InMemoryPubSub[T]{
-		subscribers: make(map[string][]chan *SubscriptionData[T]),
+		subscribers:  make(map[string][]chan *SubscriptionData[T]),
+		scheduled:    make(map[string]*scheduledItem[T]),
+		scheduleWake: make(chan struct{}, 1),
+		scheduleStop: make(chan struct{}),
 	}
 }
 
@@ -47,48 +69,10 @@ func (im *InMemoryPubSub[T]) Publish(ctx context.Context, topic string, data cha
 		go func() {
 			defer wg.Done()
 			for msg := range data {
-				// Marshal and unmarshal to create a deep copy.
-				b, err := json.Marshal(msg)
-				if err != nil {
-					// In a real implementation, handle the error appropriately.
-					continue
-				}
-
-				var dataDecoded T
-				err = json.Unmarshal(b, &dataDecoded)
-				if err != nil {
-					continue
-				}
-
-				// Create SubscriptionData
-				subData := &SubscriptionData[T]{
-					data: &dataDecoded,
-					Ack: func(ctx context.Context) error {
-						// Ack is a no-op in in-memory implementation.
-						return nil
-					},
-					Nack: func(ctx context.Context) error {
-						// Nack is a no-op in in-memory implementation.
-						return nil
-					},
-				}
-
-				// Lock dispatchMu to prevent concurrent send and closure
-				im.dispatchMu.Lock()
-				im.mu.RLock()
-				currentSubs, exists := im.subscribers[topic]
-				im.mu.RUnlock()
-				if exists {
-					for _, subCh := range currentSubs {
-						select {
-						case subCh <- subData:
-						case <-ctx.Done():
-							im.dispatchMu.Unlock()
-							return
-						}
-					}
+				// messages that cannot be copied are skipped, the worker stops with ctx
+				if err := im.dispatch(ctx, topic, msg); err != nil && ctx.Err() != nil {
+					return
 				}
-				im.dispatchMu.Unlock()
 			}
 		}()
 	}
@@ -97,6 +81,67 @@ func (im *InMemoryPubSub[T]) Publish(ctx context.Context, topic string, data cha
 	return nil
 }
 
+// PublishSync delivers data to the current subscribers of topic.
+func (im *InMemoryPubSub[T]) PublishSync(ctx context.Context, topic string, data *T) error {
+	im.mu.RLock()
+	closed := im.closed
+	im.mu.RUnlock()
+	if closed {
+		return fmt.Errorf("pubsub is closed")
+	}
+	return im.dispatch(ctx, topic, data)
+}
+
+// dispatch hands a deep copy of msg to every subscriber of topic and every matching pattern. It
+// fails when msg cannot be copied or ctx ends while a subscriber is full.
+func (im *InMemoryPubSub[T]) dispatch(ctx context.Context, topic string, msg *T) error {
+	// Marshal and unmarshal to create a deep copy.
+	b, err := json.Marshal(msg)
+	if err != nil {
+		recordPublish(ctx, topic, err)
+		return fmt.Errorf("failed copying message: %w", err)
+	}
+
+	var dataDecoded T
+	err = json.Unmarshal(b, &dataDecoded)
+	if err != nil {
+		recordPublish(ctx, topic, err)
+		return fmt.Errorf("failed copying message: %w", err)
+	}
+
+	publishedAt := time.Now()
+
+	// Lock dispatchMu to prevent concurrent send and closure
+	im.dispatchMu.Lock()
+	defer im.dispatchMu.Unlock()
+	im.mu.RLock()
+	targets := map[chan *SubscriptionData[T]]string{}
+	for _, subCh := range im.subscribers[topic] {
+		targets[subCh] = topic
+	}
+	for _, p := range im.patterns {
+		if MatchTopic(p.pattern, topic) {
+			targets[p.c] = p.pattern
+		}
+	}
+	im.mu.RUnlock()
+	recordPublish(ctx, topic, nil)
+	for subCh, subscription := range targets {
+		// Ack and Nack are no-ops in the in-memory implementation.
+		subData := newSubscriptionData(ctx, subscription, &dataDecoded, publishedAt,
+			func(ctx context.Context) error { return nil },
+			func(ctx context.Context) error { return nil },
+		)
+		subData.topic = topic
+		select {
+		case subCh <- subData:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
 // Subscribe subscribes to a given subscription (topic) and returns a Subscription.
 func (im *InMemoryPubSub[T]) Subscribe(ctx context.Context, subscription string) (*Subscription[T], error) {
 	im.mu.Lock()
@@ -119,30 +164,73 @@ func (im *InMemoryPubSub[T]) Subscribe(ctx context.Context, subscription string)
 
 	// Initialize closeOnce and define closeFunc using sync.Once.
 	subscriptionObj.closeOnce = sync.Once{}
+	// closeFunc is already guarded by Subscription.closeOnce, guarding it again with the same
+	// Once deadlocks Close.
 	subscriptionObj.closeFunc = func() {
-		subscriptionObj.closeOnce.Do(func() {
+		im.dispatchMu.Lock()
+		defer im.dispatchMu.Unlock()
+
+		im.mu.Lock()
+		defer im.mu.Unlock()
+		// Remove the subscription channel from the subscribers map.
+		subs := im.subscribers[subscription]
+		for i, ch := range subs {
+			if ch == subCh {
+				im.subscribers[subscription] = append(subs[:i], subs[i+1:]...)
+				close(ch) // Safe to close now.
+				// Drop undelivered messages so reads fail right after Close.
+				for range ch {
+				}
+				break
+			}
+		}
+		// If no more subscribers for the topic, delete the entry.
+		if len(im.subscribers[subscription]) == 0 {
+			delete(im.subscribers, subscription)
+		}
+	}
+
+	return subscriptionObj, nil
+}
+
+// SubscribePattern subscribes to every topic matching pattern.
+func (im *InMemoryPubSub[T]) SubscribePattern(ctx context.Context, pattern string) (*Subscription[T], error) {
+	if err := ValidatePattern(pattern); err != nil {
+		return nil, err
+	}
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	if im.closed {
+		return nil, fmt.Errorf("pubsub is closed")
+	}
+
+	sub := &patternSubscriber[T]{
+		pattern: pattern,
+		c:       make(chan *SubscriptionData[T], 100),
+	}
+	im.patterns = append(im.patterns, sub)
+
+	return &Subscription[T]{
+		Name: pattern,
+		c:    sub.c,
+		closeFunc: func() {
 			im.dispatchMu.Lock()
 			defer im.dispatchMu.Unlock()
 
 			im.mu.Lock()
 			defer im.mu.Unlock()
-			// Remove the subscription channel from the subscribers map.
-			subs := im.subscribers[subscription]
-			for i, ch := range subs {
-				if ch == subCh {
-					im.subscribers[subscription] = append(subs[:i], subs[i+1:]...)
-					close(ch) // Safe to close now.
+			for i, p := range im.patterns {
+				if p == sub {
+					im.patterns = append(im.patterns[:i], im.patterns[i+1:]...)
+					close(sub.c)
+					for range sub.c {
+					}
 					break
 				}
 			}
-			// If no more subscribers for the topic, delete the entry.
-			if len(im.subscribers[subscription]) == 0 {
-				delete(im.subscribers, subscription)
-			}
-		})
-	}
-
-	return subscriptionObj, nil
+		},
+	}, nil
 }
 
 // Close shuts down the InMemoryPubSub and closes all subscription channels.
@@ -155,6 +243,7 @@ func (im *InMemoryPubSub[T]) Close() error {
 	}
 
 	im.closed = true
+	close(im.scheduleStop)
 	im.dispatchMu.Lock()
 	defer im.dispatchMu.Unlock()
 	for topic, subs := range im.subscribers {
@@ -163,6 +252,10 @@ func (im *InMemoryPubSub[T]) Close() error {
 		}
 		delete(im.subscribers, topic)
 	}
+	for _, p := range im.patterns {
+		close(p.c)
+	}
+	im.patterns = nil
 
 	return nil
 }
@@ -170,3 +263,94 @@ func (im *InMemoryPubSub[T]) Close() error {
 func (im *InMemoryPubSub[T]) Ping(ctx context.Context, timeout time.Duration) error {
 	return nil
 }
+
+// PublishAt schedules data to be published to topic at the given time.
+func (im *InMemoryPubSub[T]) PublishAt(ctx context.Context, topic string, at time.Time, data *T) (string, error) {
+	im.mu.RLock()
+	closed := im.closed
+	im.mu.RUnlock()
+	if closed {
+		return "", fmt.Errorf("pubsub is closed")
+	}
+	item := &scheduledItem[T]{
+		ctx:   context.WithoutCancel(ctx),
+		id:    uuid.New().String(),
+		topic: topic,
+		at:    at,
+		data:  data,
+	}
+	im.scheduleMu.Lock()
+	heap.Push(&im.schedule, item)
+	im.scheduled[item.id] = item
+	im.scheduleMu.Unlock()
+
+	im.schedulerOnce.Do(func() {
+		go im.runScheduler()
+	})
+	im.wakeScheduler()
+	return item.id, nil
+}
+
+// PublishAfter schedules data to be published to topic once delay has passed.
+func (im *InMemoryPubSub[T]) PublishAfter(ctx context.Context, topic string, delay time.Duration, data *T) (string, error) {
+	return im.PublishAt(ctx, topic, time.Now().Add(delay), data)
+}
+
+// CancelScheduled removes a scheduled message before it is delivered.
+func (im *InMemoryPubSub[T]) CancelScheduled(ctx context.Context, id string) error {
+	im.scheduleMu.Lock()
+	defer im.scheduleMu.Unlock()
+	item, found := im.scheduled[id]
+	if !found {
+		return ErrScheduledNotFound
+	}
+	heap.Remove(&im.schedule, item.index)
+	delete(im.scheduled, id)
+	return nil
+}
+
+func (im *InMemoryPubSub[T]) wakeScheduler() {
+	select {
+	case im.scheduleWake <- struct{}{}:
+	default:
+	}
+}
+
+// runScheduler publishes due messages and sleeps until the next one is due or the heap changes.
+func (im *InMemoryPubSub[T]) runScheduler() {
+	for {
+		var due []*scheduledItem[T]
+		var timer *time.Timer
+		var timerC <-chan time.Time
+
+		im.scheduleMu.Lock()
+		now := time.Now()
+		for im.schedule.Len() > 0 && !im.schedule[0].at.After(now) {
+			item := heap.Pop(&im.schedule).(*scheduledItem[T])
+			delete(im.scheduled, item.id)
+			due = append(due, item)
+		}
+		if im.schedule.Len() > 0 {
+			timer = time.NewTimer(im.schedule[0].at.Sub(now))
+			timerC = timer.C
+		}
+		im.scheduleMu.Unlock()
+
+		for _, item := range due {
+			_ = publishOne[T](item.ctx, im, item.topic, item.data)
+		}
+
+		select {
+		case <-im.scheduleStop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-im.scheduleWake:
+		case <-timerC:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
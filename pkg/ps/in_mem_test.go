@@ -238,6 +238,42 @@ func TestSubscriptionClose(t *testing.T) {
 	}
 }
 
+// TestSubscriptionCloseReturns ensures Close returns, unsubscribes and drops undelivered
+// messages instead of deadlocking on its own sync.Once.
+func TestSubscriptionCloseReturns(t *testing.T) {
+	ctx := context.Background()
+	pubsub := NewInMemoryPubSub[TestMessage]()
+	defer pubsub.Close()
+
+	topic := "close-returns-topic"
+	subscription, err := pubsub.Subscribe(ctx, topic)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	if err := pubsub.PublishSync(ctx, topic, &TestMessage{Content: "undelivered"}); err != nil {
+		t.Fatalf("PublishSync failed: %v", err)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		subscription.Close(ctx)
+		subscription.Close(ctx)
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return")
+	}
+
+	if msg, err := subscription.Pop(ctx, 10*time.Millisecond); err == nil {
+		t.Errorf("Expected error after closing subscription, but got message: %v", msg.data.Content)
+	}
+	if err := pubsub.PublishSync(ctx, topic, &TestMessage{Content: "after close"}); err != nil {
+		t.Errorf("Publishing after the only subscriber closed failed: %v", err)
+	}
+}
+
 // TestPubSubClose ensures that closing the Pub/Sub system prevents further publishing and subscriptions.
 func TestPubSubClose(t *testing.T) {
 	ctx := context.Background()
@@ -313,3 +349,67 @@ func TestBPopWithContextCancel(t *testing.T) {
 		t.Errorf("Expected context cancellation error, but got none")
 	}
 }
+
+// TestPublishAfter verifies that scheduled messages are delivered in order once they are due.
+func TestPublishAfter(t *testing.T) {
+	ctx := context.Background()
+	pubsub := NewInMemoryPubSub[TestMessage]()
+	defer pubsub.Close()
+
+	topic := "scheduled-topic"
+	subscription, err := pubsub.Subscribe(ctx, topic)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer subscription.Close(ctx)
+
+	start := time.Now()
+	if _, err := pubsub.PublishAfter(ctx, topic, 200*time.Millisecond, &TestMessage{Content: "second"}); err != nil {
+		t.Fatalf("PublishAfter failed: %v", err)
+	}
+	if _, err := pubsub.PublishAt(ctx, topic, start.Add(100*time.Millisecond), &TestMessage{Content: "first"}); err != nil {
+		t.Fatalf("PublishAt failed: %v", err)
+	}
+
+	for _, expected := range []string{"first", "second"} {
+		msg, err := subscription.Pop(ctx, time.Second)
+		if err != nil {
+			t.Fatalf("Failed to receive message: %v", err)
+		}
+		if msg.Data().Content != expected {
+			t.Errorf("Expected message '%s', got '%s'", expected, msg.Data().Content)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Scheduled messages delivered too early: %v", elapsed)
+	}
+}
+
+// TestCancelScheduled ensures that a canceled message is never delivered.
+func TestCancelScheduled(t *testing.T) {
+	ctx := context.Background()
+	pubsub := NewInMemoryPubSub[TestMessage]()
+	defer pubsub.Close()
+
+	topic := "cancel-scheduled-topic"
+	subscription, err := pubsub.Subscribe(ctx, topic)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer subscription.Close(ctx)
+
+	id, err := pubsub.PublishAfter(ctx, topic, 100*time.Millisecond, &TestMessage{Content: "canceled"})
+	if err != nil {
+		t.Fatalf("PublishAfter failed: %v", err)
+	}
+	if err := pubsub.CancelScheduled(ctx, id); err != nil {
+		t.Fatalf("CancelScheduled failed: %v", err)
+	}
+	if err := pubsub.CancelScheduled(ctx, id); err != ErrScheduledNotFound {
+		t.Errorf("Expected ErrScheduledNotFound, got %v", err)
+	}
+
+	if msg, err := subscription.Pop(ctx, 300*time.Millisecond); err == nil {
+		t.Errorf("Expected no message, got '%s'", msg.Data().Content)
+	}
+}
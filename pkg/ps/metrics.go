@@ -0,0 +1,95 @@
+package ps
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/metrics"
+)
+
+const (
+	PublishedMetric     = "ps.messages.published"
+	PublishFailedMetric = "ps.messages.publish_failed"
+	ReceivedMetric      = "ps.messages.received"
+	AckedMetric         = "ps.messages.acked"
+	NackedMetric        = "ps.messages.nacked"
+	LatencyMetric       = "ps.messages.latency"
+	InFlightMetric      = "ps.subscription.in_flight"
+)
+
+var registerMetricsOnce sync.Once
+
+func registerMetrics(ctx context.Context) {
+	registerMetricsOnce.Do(func() {
+		counters := map[string]string{
+			PublishedMetric:     "Number of messages published.",
+			PublishFailedMetric: "Number of messages that failed to publish.",
+			ReceivedMetric:      "Number of messages received by subscriptions.",
+			AckedMetric:         "Number of messages acked.",
+			NackedMetric:        "Number of messages nacked.",
+		}
+		for name, description := range counters {
+			if err := metrics.RegisterCounter(name, "ps", metric.WithDescription(description), metric.WithUnit("{message}")); err != nil {
+				ctxLogger.Warn(ctx, "failed registering ps metric", zap.String("name", name), zap.Error(err))
+			}
+		}
+		if err := metrics.RegisterHistogram(LatencyMetric, "ps",
+			metric.WithDescription("Time between a message being published and received."),
+			metric.WithUnit("ms")); err != nil {
+			ctxLogger.Warn(ctx, "failed registering ps metric", zap.String("name", LatencyMetric), zap.Error(err))
+		}
+		if err := metrics.RegisterUpDownCounter(InFlightMetric, "ps",
+			metric.WithDescription("Messages received but not yet acked or nacked."),
+			metric.WithUnit("{message}")); err != nil {
+			ctxLogger.Warn(ctx, "failed registering ps metric", zap.String("name", InFlightMetric), zap.Error(err))
+		}
+	})
+}
+
+// recordPublish counts a publish attempt for topic.
+func recordPublish(ctx context.Context, topic string, err error) {
+	registerMetrics(ctx)
+	name := PublishedMetric
+	if err != nil {
+		name = PublishFailedMetric
+	}
+	_ = metrics.Measure(ctx, name, int64(1), attribute.String("topic", topic))
+}
+
+// newSubscriptionData wraps a received message so receipt, latency, in-flight and ack/nack are
+// measured for the subscription. Ack and Nack are counted once per message.
+func newSubscriptionData[T any](ctx context.Context, subscription string, data *T, publishedAt time.Time, ack, nack func(ctx context.Context) error) *SubscriptionData[T] {
+	registerMetrics(ctx)
+	attr := attribute.String("subscription", subscription)
+	_ = metrics.Measure(ctx, ReceivedMetric, int64(1), attr)
+	_ = metrics.Measure(ctx, InFlightMetric, int64(1), attr)
+	if !publishedAt.IsZero() {
+		_ = metrics.Measure(ctx, LatencyMetric, float64(time.Since(publishedAt).Milliseconds()), attr)
+	}
+
+	var settled atomic.Bool
+	settle := func(ctx context.Context, name string, f func(ctx context.Context) error) error {
+		if settled.CompareAndSwap(false, true) {
+			_ = metrics.Measure(ctx, InFlightMetric, int64(-1), attr)
+			_ = metrics.Measure(ctx, name, int64(1), attr)
+		}
+		return f(ctx)
+	}
+	return &SubscriptionData[T]{
+		data:        data,
+		publishedAt: publishedAt,
+		Ack: func(ctx context.Context) error {
+			return settle(ctx, AckedMetric, ack)
+		},
+		Nack: func(ctx context.Context) error {
+			return settle(ctx, NackedMetric, nack)
+		},
+	}
+}
@@ -0,0 +1,84 @@
+package ps
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestEnvelopeRoundTrip verifies the publish time survives the envelope and raw payloads pass through.
+func TestEnvelopeRoundTrip(t *testing.T) {
+	raw := []byte(`{"Content":"hello"}`)
+	wrapped, err := wrapEnvelope(raw)
+	if err != nil {
+		t.Fatalf("wrapEnvelope failed: %v", err)
+	}
+	payload, publishedAt := unwrapEnvelope(wrapped)
+	if string(payload) != string(raw) {
+		t.Errorf("Expected payload %s, got %s", raw, payload)
+	}
+	if time.Since(publishedAt) > time.Second {
+		t.Errorf("Unexpected publish time %v", publishedAt)
+	}
+
+	payload, publishedAt = unwrapEnvelope(raw)
+	if string(payload) != string(raw) || !publishedAt.IsZero() {
+		t.Errorf("Expected raw payload without publish time, got %s at %v", payload, publishedAt)
+	}
+}
+
+// TestSubscriptionDataWrapsAck ensures instrumented acks still reach the backend every time.
+func TestSubscriptionDataWrapsAck(t *testing.T) {
+	ctx := context.Background()
+	acks := 0
+	msg := &TestMessage{Content: "hello"}
+	data := newSubscriptionData(ctx, "settle", msg, time.Now(),
+		func(ctx context.Context) error { acks++; return nil },
+		func(ctx context.Context) error { return nil },
+	)
+	_ = data.Ack(ctx)
+	_ = data.Ack(ctx)
+	if acks != 2 {
+		t.Errorf("Expected backend ack to be called twice, got %d", acks)
+	}
+	if data.PublishedAt().IsZero() {
+		t.Errorf("Expected publish time to be set")
+	}
+}
+
+// TestRedisEncodeEnvelopeOptIn keeps the wire format unchanged unless the envelope is enabled.
+func TestRedisEncodeEnvelopeOptIn(t *testing.T) {
+	raw := []byte(`{"Content":"hello"}`)
+	r := &RedisPubSub[TestMessage]{}
+	b, err := r.encode(raw)
+	if err != nil || string(b) != string(raw) {
+		t.Errorf("Expected raw payload %s, got %s (%v)", raw, b, err)
+	}
+
+	r.envelope = true
+	b, err = r.encode(raw)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	payload, publishedAt := unwrapEnvelope(b)
+	if string(payload) != string(raw) || publishedAt.IsZero() {
+		t.Errorf("Expected enveloped payload with publish time, got %s at %v", payload, publishedAt)
+	}
+}
+
+// TestRedisClaimLease falls back to the default lease when none is configured.
+func TestRedisClaimLease(t *testing.T) {
+	r := &RedisPubSub[TestMessage]{}
+	if lease := r.claimLease(); lease != defaultRedisScheduleClaimLease {
+		t.Errorf("Expected default lease %v, got %v", defaultRedisScheduleClaimLease, lease)
+	}
+	r.scheduleClaimLease = time.Minute
+	if lease := r.claimLease(); lease != time.Minute {
+		t.Errorf("Expected configured lease %v, got %v", time.Minute, lease)
+	}
+	// without runScheduler no mover is started
+	r.startScheduler(context.Background())
+	if r.schedulerCancel != nil {
+		t.Errorf("Expected no scheduler without runScheduler")
+	}
+}
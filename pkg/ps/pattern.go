@@ -0,0 +1,68 @@
+package ps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrPatternUnsupported is returned by backends that cannot subscribe to topic patterns.
+var ErrPatternUnsupported = errors.New("pattern subscriptions are not supported by this backend")
+
+// PatternSubscriber subscribes to every topic matching a pattern. Topics are split on "." into
+// tokens; "*" matches exactly one token and ">" as the last token matches one or more tokens,
+// so "orders.*" matches "orders.created" and "orders.>" also matches "orders.eu.created".
+// SubscriptionData.Topic returns the concrete topic of each message.
+type PatternSubscriber[T any] interface {
+	SubscribePattern(ctx context.Context, pattern string) (*Subscription[T], error)
+}
+
+// ValidatePattern checks that ">" only appears as the last token and no token is empty.
+func ValidatePattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("pattern is required")
+	}
+	tokens := strings.Split(pattern, ".")
+	for i, token := range tokens {
+		if token == "" {
+			return fmt.Errorf("invalid pattern %q: empty token", pattern)
+		}
+		if token == ">" && i != len(tokens)-1 {
+			return fmt.Errorf("invalid pattern %q: '>' must be the last token", pattern)
+		}
+	}
+	return nil
+}
+
+// MatchTopic reports whether topic matches pattern.
+func MatchTopic(pattern, topic string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	topicTokens := strings.Split(topic, ".")
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(topicTokens) > i
+		}
+		if i >= len(topicTokens) {
+			return false
+		}
+		if token != "*" && token != topicTokens[i] {
+			return false
+		}
+	}
+	return len(patternTokens) == len(topicTokens)
+}
+
+// redisGlob converts a pattern to a PSUBSCRIBE glob. The glob is broader than the pattern
+// because Redis "*" also matches ".", so messages still have to be filtered with MatchTopic.
+func redisGlob(pattern string) string {
+	tokens := strings.Split(pattern, ".")
+	for i, token := range tokens {
+		if token == "*" || token == ">" {
+			tokens[i] = "*"
+			continue
+		}
+		tokens[i] = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`).Replace(token)
+	}
+	return strings.Join(tokens, ".")
+}
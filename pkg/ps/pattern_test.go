@@ -0,0 +1,90 @@
+package ps
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestMatchTopic covers single and multi token wildcards.
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		match   bool
+	}{
+		{"orders.created", "orders.created", true},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders.eu.created", false},
+		{"orders.*", "orders", false},
+		{"orders.>", "orders.created", true},
+		{"orders.>", "orders.eu.created", true},
+		{"orders.>", "orders", false},
+		{"*.created", "users.created", true},
+		{"*.created", "users.deleted", false},
+		{">", "anything.at.all", true},
+	}
+	for _, tt := range tests {
+		if got := MatchTopic(tt.pattern, tt.topic); got != tt.match {
+			t.Errorf("MatchTopic(%q, %q) = %v, expected %v", tt.pattern, tt.topic, got, tt.match)
+		}
+	}
+}
+
+// TestValidatePattern rejects misplaced multi token wildcards and empty tokens.
+func TestValidatePattern(t *testing.T) {
+	for _, pattern := range []string{"", "orders..created", "orders.>.created"} {
+		if err := ValidatePattern(pattern); err == nil {
+			t.Errorf("Expected error for pattern %q", pattern)
+		}
+	}
+	if err := ValidatePattern("orders.*.>"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// TestRedisGlob checks wildcards are converted and glob characters in literals are escaped.
+func TestRedisGlob(t *testing.T) {
+	if got := redisGlob("orders.*.>"); got != "orders.*.*" {
+		t.Errorf("Expected orders.*.*, got %s", got)
+	}
+	if got := redisGlob("ord?rs.*"); got != `ord\?rs.*` {
+		t.Errorf(`Expected ord\?rs.*, got %s`, got)
+	}
+}
+
+// TestSubscribePattern verifies pattern subscribers receive matching topics with the concrete topic name.
+func TestSubscribePattern(t *testing.T) {
+	ctx := context.Background()
+	pubsub := NewInMemoryPubSub[TestMessage]()
+	defer pubsub.Close()
+
+	subscription, err := pubsub.SubscribePattern(ctx, "orders.>")
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer subscription.Close(ctx)
+
+	for _, topic := range []string{"orders.created", "users.created", "orders.eu.shipped"} {
+		if err := publishOne[TestMessage](ctx, pubsub, topic, &TestMessage{Content: topic}); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	for _, expected := range []string{"orders.created", "orders.eu.shipped"} {
+		msg, err := subscription.Pop(ctx, time.Second)
+		if err != nil {
+			t.Fatalf("Failed to receive message: %v", err)
+		}
+		if msg.Topic() != expected || msg.Data().Content != expected {
+			t.Errorf("Expected message on '%s', got '%s' on '%s'", expected, msg.Data().Content, msg.Topic())
+		}
+	}
+	if msg, err := subscription.Pop(ctx, 100*time.Millisecond); err == nil {
+		t.Errorf("Expected no more messages, got '%s'", msg.Topic())
+	}
+
+	if _, err := pubsub.SubscribePattern(ctx, "orders.>.created"); err == nil {
+		t.Errorf("Expected error for invalid pattern")
+	}
+}
@@ -3,6 +3,7 @@ package ps
 import (
 	"cloud.google.com/go/pubsub"
 	"context"
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
@@ -21,6 +22,12 @@ type Publisher[T any] interface {
 	Publish(ctx context.Context, topic string, data chan *T, workers int) error
 }
 
+// SyncPublisher publishes a single message and returns once the backend accepted it, for callers
+// that record delivery and have to see failures, such as the outbox relay.
+type SyncPublisher[T any] interface {
+	PublishSync(ctx context.Context, topic string, data *T) error
+}
+
 // Subscriber defines methods for subscribing to messages.
 type Subscriber[T any] interface {
 	Subscribe(ctx context.Context, subscription string) (*Subscription[T], error)
@@ -37,15 +44,53 @@ type Subscription[T any] struct {
 }
 
 type SubscriptionData[T any] struct {
-	data *T
-	Ack  func(ctx context.Context) error
-	Nack func(ctx context.Context) error
+	data        *T
+	topic       string
+	publishedAt time.Time
+	Ack         func(ctx context.Context) error
+	Nack        func(ctx context.Context) error
 }
 
 func (d *SubscriptionData[T]) Data() *T {
 	return d.data
 }
 
+// Topic returns the concrete topic the message was published to. It is empty when the backend
+// only knows the subscription name.
+func (d *SubscriptionData[T]) Topic() string {
+	return d.topic
+}
+
+// PublishedAt returns when the message was published, or the zero time if the backend did not record it.
+func (d *SubscriptionData[T]) PublishedAt() time.Time {
+	return d.publishedAt
+}
+
+// envelope carries the publish time next to the payload on backends without message metadata.
+// Readers accept payloads with and without it, writers only add it when configured to.
+type envelope struct {
+	PublishedAt int64           `json:"ps_published_at"`
+	Data        json.RawMessage `json:"ps_data"`
+}
+
+// wrapEnvelope adds the current time to an encoded payload.
+func wrapEnvelope(payload []byte) ([]byte, error) {
+	return json.Marshal(envelope{
+		PublishedAt: time.Now().UnixMilli(),
+		Data:        payload,
+	})
+}
+
+// unwrapEnvelope returns the payload and publish time of an encoded message. Messages published
+// without an envelope are returned unchanged with a zero time.
+func unwrapEnvelope(raw []byte) ([]byte, time.Time) {
+	var e envelope
+	if err := json.Unmarshal(raw, &e); err != nil || e.Data == nil || e.PublishedAt == 0 {
+		return raw, time.Time{}
+	}
+	return e.Data, time.UnixMilli(e.PublishedAt)
+}
+
 func (s *Subscription[T]) Read() <-chan *SubscriptionData[T] {
 	return s.c
 }
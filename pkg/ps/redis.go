@@ -3,22 +3,42 @@ package ps
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/Seann-Moser/go-serve/pkg/clientpkg"
 	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
 	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"strconv"
 	"sync"
 	"time"
 )
 
 var _ PubSub[any] = &RedisPubSub[any]{}
+var _ ScheduledPublisher[any] = &RedisPubSub[any]{}
+var _ PatternSubscriber[any] = &RedisPubSub[any]{}
+var _ SyncPublisher[any] = &RedisPubSub[any]{}
 
 type RedisPubSub[T any] struct {
 	client         *redis.Client
 	defaultChannel string
 	ps             *redis.PubSub
+
+	scheduleKey          string
+	schedulePollInterval time.Duration
+	scheduleClaimLease   time.Duration
+	// runScheduler starts the mover of scheduled messages with the client, so replicas that
+	// only consume still deliver messages that other services scheduled.
+	runScheduler    bool
+	schedulerOnce   sync.Once
+	schedulerCancel context.CancelFunc
+
+	// envelope wraps published payloads with their publish time. Subscribers accept both formats,
+	// so it should only be enabled once every reader of the channels runs a version that unwraps it.
+	envelope bool
 }
 
 func RedisPubSubFlags(prefix string) *pflag.FlagSet {
@@ -28,6 +48,11 @@ func RedisPubSubFlags(prefix string) *pflag.FlagSet {
 	fs.String(clientpkg.GetFlagWithPrefix(prefix, "redis-password"), "", "Redis server password")
 	fs.Int(clientpkg.GetFlagWithPrefix(prefix, "redis-db"), 0, "Redis database number")
 	fs.String(clientpkg.GetFlagWithPrefix(prefix, "default-channel"), "", "Default Redis channel name")
+	fs.String(clientpkg.GetFlagWithPrefix(prefix, "redis-schedule-key"), defaultRedisScheduleKey, "Redis sorted set holding scheduled messages")
+	fs.Duration(clientpkg.GetFlagWithPrefix(prefix, "redis-schedule-poll-interval"), time.Second, "How often due scheduled messages are moved to their channel")
+	fs.Duration(clientpkg.GetFlagWithPrefix(prefix, "redis-schedule-claim-lease"), defaultRedisScheduleClaimLease, "How long a process holds a due scheduled message before another may publish it")
+	fs.Bool(clientpkg.GetFlagWithPrefix(prefix, "redis-run-scheduler"), true, "Move due scheduled messages to their channel from this process")
+	fs.Bool(clientpkg.GetFlagWithPrefix(prefix, "redis-publish-envelope"), false, "Wrap published messages with their publish time, requires every subscriber to understand the envelope")
 	return fs
 }
 
@@ -37,6 +62,17 @@ func NewRedisPubSubFromFlags[T any](ctx context.Context, prefix string) (*RedisP
 	redisPassword := viper.GetString(clientpkg.GetFlagWithPrefix(prefix, "redis-password"))
 	redisDB := viper.GetInt(clientpkg.GetFlagWithPrefix(prefix, "redis-db"))
 	defaultChannel := viper.GetString(clientpkg.GetFlagWithPrefix(prefix, "default-channel"))
+	scheduleKey := viper.GetString(clientpkg.GetFlagWithPrefix(prefix, "redis-schedule-key"))
+	schedulePollInterval := viper.GetDuration(clientpkg.GetFlagWithPrefix(prefix, "redis-schedule-poll-interval"))
+	scheduleClaimLease := viper.GetDuration(clientpkg.GetFlagWithPrefix(prefix, "redis-schedule-claim-lease"))
+	runScheduler := viper.GetBool(clientpkg.GetFlagWithPrefix(prefix, "redis-run-scheduler"))
+	envelope := viper.GetBool(clientpkg.GetFlagWithPrefix(prefix, "redis-publish-envelope"))
+	if scheduleKey == "" {
+		scheduleKey = defaultRedisScheduleKey
+	}
+	if schedulePollInterval <= 0 {
+		schedulePollInterval = time.Second
+	}
 
 	// Validate required flags
 	if redisAddress == "" {
@@ -64,10 +100,17 @@ func NewRedisPubSubFromFlags[T any](ctx context.Context, prefix string) (*RedisP
 			ping := client.Ping(tmpCtx) // Use tmpCtx to respect the timeout
 			if ping.Err() == nil {
 				// Successful ping, break the loop
-				return &RedisPubSub[T]{
-					client:         client,
-					defaultChannel: defaultChannel,
-				}, nil
+				r := &RedisPubSub[T]{
+					client:               client,
+					defaultChannel:       defaultChannel,
+					scheduleKey:          scheduleKey,
+					schedulePollInterval: schedulePollInterval,
+					scheduleClaimLease:   scheduleClaimLease,
+					runScheduler:         runScheduler,
+					envelope:             envelope,
+				}
+				r.startScheduler(ctx)
+				return r, nil
 			}
 		}
 	}
@@ -127,15 +170,18 @@ func (r *RedisPubSub[T]) Publish(ctx context.Context, channel string, data chan
 				default:
 					// Marshal the message to JSON
 					b, err := json.Marshal(msg)
+					if err == nil {
+						b, err = r.encode(b)
+					}
 					if err != nil {
-						// Handle marshaling error (e.g., log it)
+						recordPublish(ctx, channel, err)
 						continue
 					}
 
 					// Publish the message to Redis
 					err = r.client.Publish(ctx, channel, b).Err()
+					recordPublish(ctx, channel, err)
 					if err != nil {
-						// Handle publishing error (e.g., log it)
 						continue
 					}
 				}
@@ -148,6 +194,38 @@ func (r *RedisPubSub[T]) Publish(ctx context.Context, channel string, data chan
 	return nil
 }
 
+// encode prepares an encoded payload for the wire, adding the envelope when it is enabled.
+func (r *RedisPubSub[T]) encode(payload []byte) ([]byte, error) {
+	if !r.envelope {
+		return payload, nil
+	}
+	return wrapEnvelope(payload)
+}
+
+// PublishSync publishes data to channel and returns the error of the PUBLISH command.
+func (r *RedisPubSub[T]) PublishSync(ctx context.Context, channel string, data *T) error {
+	if channel == "" {
+		if r.defaultChannel == "" {
+			return fmt.Errorf("channel is required")
+		}
+		channel = r.defaultChannel
+	}
+	b, err := json.Marshal(data)
+	if err == nil {
+		b, err = r.encode(b)
+	}
+	if err != nil {
+		recordPublish(ctx, channel, err)
+		return fmt.Errorf("failed marshalling data: %w", err)
+	}
+	err = r.client.Publish(ctx, channel, b).Err()
+	recordPublish(ctx, channel, err)
+	if err != nil {
+		return fmt.Errorf("failed to publish msg: %w", err)
+	}
+	return nil
+}
+
 // Subscribe subscribes to a given channel (topic) and returns a Subscription.
 func (r *RedisPubSub[T]) Subscribe(ctx context.Context, channel string) (*Subscription[T], error) {
 	if channel == "" {
@@ -175,26 +253,20 @@ func (r *RedisPubSub[T]) Subscribe(ctx context.Context, channel string) (*Subscr
 		ch := r.ps.Channel()
 
 		for msg := range ch {
+			payload, publishedAt := unwrapEnvelope([]byte(msg.Payload))
 			var data T
-			err := json.Unmarshal([]byte(msg.Payload), &data)
+			err := json.Unmarshal(payload, &data)
 			if err != nil {
 				// Handle unmarshaling error (e.g., log it)
 				continue
 			}
 
-			subData := &SubscriptionData[T]{
-				data: &data,
-				Ack: func(ctx context.Context) error {
-					// Redis Pub/Sub does not support acknowledgments
-					// This is a no-op in this implementation
-					return nil
-				},
-				Nack: func(ctx context.Context) error {
-					// Redis Pub/Sub does not support negative acknowledgments
-					// This is a no-op in this implementation
-					return nil
-				},
-			}
+			// Redis Pub/Sub does not support acknowledgments, Ack and Nack are no-ops.
+			subData := newSubscriptionData(ctx, channel, &data, publishedAt,
+				func(ctx context.Context) error { return nil },
+				func(ctx context.Context) error { return nil },
+			)
+			subData.topic = msg.Channel
 
 			select {
 			case dataCh <- subData:
@@ -220,11 +292,254 @@ func (r *RedisPubSub[T]) Subscribe(ctx context.Context, channel string) (*Subscr
 	return subscriptionObj, nil
 }
 
+// SubscribePattern subscribes to every channel matching pattern using PSUBSCRIBE.
+func (r *RedisPubSub[T]) SubscribePattern(ctx context.Context, pattern string) (*Subscription[T], error) {
+	if err := ValidatePattern(pattern); err != nil {
+		return nil, err
+	}
+	pubSub := r.client.PSubscribe(ctx, redisGlob(pattern))
+
+	// Wait for confirmation that subscription is created
+	if _, err := pubSub.Receive(ctx); err != nil {
+		_ = pubSub.Close()
+		return nil, fmt.Errorf("failed to subscribe to pattern '%s': %w", pattern, err)
+	}
+
+	dataCh := make(chan *SubscriptionData[T], 100) // Buffered to prevent blocking
+
+	go func() {
+		defer close(dataCh)
+		for msg := range pubSub.Channel() {
+			// the glob also matches channels with extra tokens where the pattern has "*"
+			if !MatchTopic(pattern, msg.Channel) {
+				continue
+			}
+			payload, publishedAt := unwrapEnvelope([]byte(msg.Payload))
+			var data T
+			if err := json.Unmarshal(payload, &data); err != nil {
+				continue
+			}
+
+			// Redis Pub/Sub does not support acknowledgments, Ack and Nack are no-ops.
+			subData := newSubscriptionData(ctx, pattern, &data, publishedAt,
+				func(ctx context.Context) error { return nil },
+				func(ctx context.Context) error { return nil },
+			)
+			subData.topic = msg.Channel
+
+			select {
+			case dataCh <- subData:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return &Subscription[T]{
+		Name: pattern,
+		c:    dataCh,
+		closeFunc: func() {
+			_ = pubSub.PUnsubscribe(ctx, redisGlob(pattern))
+			_ = pubSub.Close()
+		},
+	}, nil
+}
+
 // Close closes the RedisPubSub client.
 func (r *RedisPubSub[T]) Close() error {
+	if r.schedulerCancel != nil {
+		r.schedulerCancel()
+	}
 	if r.ps != nil {
 		r.ps.Close()
 	}
 	r.client.Close()
 	return nil
 }
+
+const defaultRedisScheduleKey = "ps:scheduled"
+
+func (r *RedisPubSub[T]) scheduleSetKey() string {
+	if r.scheduleKey == "" {
+		return defaultRedisScheduleKey
+	}
+	return r.scheduleKey
+}
+
+func (r *RedisPubSub[T]) scheduleDataKey() string {
+	return r.scheduleSetKey() + ":data"
+}
+
+// PublishAt stores data in the schedule sorted set, scored by delivery time, and starts the
+// mover loop for this client if it is not running yet and redis-run-scheduler is set.
+func (r *RedisPubSub[T]) PublishAt(ctx context.Context, channel string, at time.Time, data *T) (string, error) {
+	if channel == "" {
+		if r.defaultChannel == "" {
+			return "", fmt.Errorf("channel is required")
+		}
+		channel = r.defaultChannel
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed marshalling scheduled message: %w", err)
+	}
+	msg := scheduledMessage{
+		ID:      uuid.New().String(),
+		Topic:   channel,
+		At:      at.UnixMilli(),
+		Payload: b,
+	}
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		return "", fmt.Errorf("failed marshalling scheduled message: %w", err)
+	}
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, r.scheduleDataKey(), msg.ID, raw)
+		pipe.ZAdd(ctx, r.scheduleSetKey(), &redis.Z{Score: float64(msg.At), Member: msg.ID})
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed scheduling message: %w", err)
+	}
+	r.startScheduler(ctx)
+	return msg.ID, nil
+}
+
+// startScheduler runs RunScheduler in the background until Close, once per client. It does
+// nothing when the client was created without redis-run-scheduler.
+func (r *RedisPubSub[T]) startScheduler(ctx context.Context) {
+	if !r.runScheduler {
+		return
+	}
+	r.schedulerOnce.Do(func() {
+		schedulerCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		r.schedulerCancel = cancel
+		go func() {
+			_ = r.RunScheduler(schedulerCtx)
+		}()
+	})
+}
+
+// PublishAfter schedules data to be published to channel once delay has passed.
+func (r *RedisPubSub[T]) PublishAfter(ctx context.Context, channel string, delay time.Duration, data *T) (string, error) {
+	return r.PublishAt(ctx, channel, time.Now().Add(delay), data)
+}
+
+// CancelScheduled removes a scheduled message before it is moved to its channel.
+func (r *RedisPubSub[T]) CancelScheduled(ctx context.Context, id string) error {
+	removed, err := r.client.ZRem(ctx, r.scheduleSetKey(), id).Result()
+	if err != nil {
+		return fmt.Errorf("failed canceling scheduled message: %w", err)
+	}
+	if removed == 0 {
+		return ErrScheduledNotFound
+	}
+	return r.client.HDel(ctx, r.scheduleDataKey(), id).Err()
+}
+
+// RunScheduler moves due scheduled messages to their channel until ctx is canceled.
+// Any number of processes can run it; a claim leases each due message to one of them, and the
+// message is only removed once it was published, so delivery is at-least-once.
+// Clients created from flags run it unless redis-run-scheduler is turned off.
+func (r *RedisPubSub[T]) RunScheduler(ctx context.Context) error {
+	interval := r.schedulePollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := r.moveDue(ctx); err != nil && ctx.Err() == nil {
+			ctxLogger.Warn(ctx, "failed moving scheduled messages", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// defaultRedisScheduleClaimLease is how long a mover holds a due message by default. A message
+// whose publish failed, or whose mover died, becomes due again after it.
+const defaultRedisScheduleClaimLease = 30 * time.Second
+
+func (r *RedisPubSub[T]) claimLease() time.Duration {
+	if r.scheduleClaimLease <= 0 {
+		return defaultRedisScheduleClaimLease
+	}
+	return r.scheduleClaimLease
+}
+
+// claimScheduledScript claims a due message by moving its score to the end of the lease, so
+// only one mover publishes it and an unpublished message is not lost.
+var claimScheduledScript = redis.NewScript(`
+local score = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if not score or tonumber(score) > tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[3], ARGV[1])
+return 1
+`)
+
+func (r *RedisPubSub[T]) moveDue(ctx context.Context) error {
+	now := time.Now()
+	ids, err := r.client.ZRangeByScore(ctx, r.scheduleSetKey(), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: 100,
+	}).Result()
+	if err != nil {
+		return err
+	}
+	leaseUntil := now.Add(r.claimLease()).UnixMilli()
+	for _, id := range ids {
+		claimed, err := claimScheduledScript.Run(ctx, r.client, []string{r.scheduleSetKey()}, id, now.UnixMilli(), leaseUntil).Int()
+		if err != nil {
+			return err
+		}
+		if claimed == 0 {
+			// canceled or claimed by another process
+			continue
+		}
+		raw, err := r.client.HGet(ctx, r.scheduleDataKey(), id).Bytes()
+		if errors.Is(err, redis.Nil) {
+			// canceled between the claim and the load
+			r.client.ZRem(ctx, r.scheduleSetKey(), id)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed loading scheduled message %s: %w", id, err)
+		}
+		var msg scheduledMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			// it will never decode, keeping it would retry it forever
+			ctxLogger.Warn(ctx, "dropping undecodable scheduled message", zap.String("id", id), zap.Error(err))
+			r.removeScheduled(ctx, id)
+			continue
+		}
+		payload, err := r.encode(msg.Payload)
+		if err == nil {
+			err = r.client.Publish(ctx, msg.Topic, payload).Err()
+		}
+		recordPublish(ctx, msg.Topic, err)
+		if err != nil {
+			return fmt.Errorf("failed publishing scheduled message %s: %w", id, err)
+		}
+		r.removeScheduled(ctx, id)
+	}
+	return nil
+}
+
+// removeScheduled deletes a delivered or dropped message from the schedule.
+func (r *RedisPubSub[T]) removeScheduled(ctx context.Context, id string) {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, r.scheduleSetKey(), id)
+		pipe.HDel(ctx, r.scheduleDataKey(), id)
+		return nil
+	})
+	if err != nil {
+		// the message is published again once the lease ends
+		ctxLogger.Warn(ctx, "failed removing delivered scheduled message", zap.String("id", id), zap.Error(err))
+	}
+}
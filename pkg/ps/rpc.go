@@ -0,0 +1,278 @@
+package ps
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+)
+
+// Request is the envelope a Requester publishes on the request topic.
+type Request[T any] struct {
+	ID       string `json:"id"`
+	ReplyTo  string `json:"reply_to"`
+	Deadline int64  `json:"deadline,omitempty"`
+	Data     *T     `json:"data"`
+}
+
+// Reply is the envelope a Responder publishes on the reply topic of the caller.
+type Reply[T any] struct {
+	ID    string `json:"id"`
+	Data  *T     `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// RemoteError is returned by Requester.Call when the responder handler failed.
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote error: %s", e.Message)
+}
+
+// Requester sends requests on a topic and waits for the matching reply on its own reply topic.
+// Replies are matched by correlation ID, so only the first reply for a request is returned
+// when several responder replicas answer it.
+type Requester[Req any, Resp any] struct {
+	requests   Publisher[Request[Req]]
+	topic      string
+	replyTopic string
+	sub        *Subscription[Reply[Resp]]
+
+	mu      sync.Mutex
+	pending map[string]chan *Reply[Resp]
+	cancel  context.CancelFunc
+}
+
+// NewRequester subscribes to a reply topic unique to this requester and starts routing replies.
+// On GCP the subscriber must be able to receive from that name, so use NewRequesterWithReplyTopic
+// with a pre-provisioned topic and subscription per caller instance.
+func NewRequester[Req any, Resp any](ctx context.Context, requests Publisher[Request[Req]], replies Subscriber[Reply[Resp]], topic string) (*Requester[Req, Resp], error) {
+	if topic == "" {
+		return nil, fmt.Errorf("topic is required")
+	}
+	return NewRequesterWithReplyTopic[Req, Resp](ctx, requests, replies, topic, fmt.Sprintf("%s.reply.%s", topic, uuid.New().String()))
+}
+
+// NewRequesterWithReplyTopic is NewRequester with an explicit reply topic, which must not be
+// shared with other requesters.
+func NewRequesterWithReplyTopic[Req any, Resp any](ctx context.Context, requests Publisher[Request[Req]], replies Subscriber[Reply[Resp]], topic, replyTopic string) (*Requester[Req, Resp], error) {
+	if topic == "" || replyTopic == "" {
+		return nil, fmt.Errorf("topic and reply topic are required")
+	}
+	sub, err := replies.Subscribe(ctx, replyTopic)
+	if err != nil {
+		return nil, fmt.Errorf("failed subscribing to reply topic %s: %w", replyTopic, err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	r := &Requester[Req, Resp]{
+		requests:   requests,
+		topic:      topic,
+		replyTopic: replyTopic,
+		sub:        sub,
+		pending:    map[string]chan *Reply[Resp]{},
+		cancel:     cancel,
+	}
+	go r.route(ctx)
+	return r, nil
+}
+
+// ReplyTopic returns the topic responders publish replies for this requester to.
+func (r *Requester[Req, Resp]) ReplyTopic() string {
+	return r.replyTopic
+}
+
+// Call publishes req and blocks until a reply arrives or ctx is done.
+func (r *Requester[Req, Resp]) Call(ctx context.Context, req *Req) (*Resp, error) {
+	request := &Request[Req]{
+		ID:      uuid.New().String(),
+		ReplyTo: r.replyTopic,
+		Data:    req,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		request.Deadline = deadline.UnixMilli()
+	}
+
+	c := make(chan *Reply[Resp], 1)
+	r.mu.Lock()
+	r.pending[request.ID] = c
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, request.ID)
+		r.mu.Unlock()
+	}()
+
+	if err := publishOne[Request[Req]](ctx, r.requests, r.topic, request); err != nil {
+		return nil, fmt.Errorf("failed publishing request: %w", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case reply := <-c:
+		if reply.Error != "" {
+			return nil, &RemoteError{Message: reply.Error}
+		}
+		return reply.Data, nil
+	}
+}
+
+// Close stops routing replies and unsubscribes from the reply topic.
+func (r *Requester[Req, Resp]) Close(ctx context.Context) {
+	r.cancel()
+	r.sub.Close(ctx)
+}
+
+func (r *Requester[Req, Resp]) route(ctx context.Context) {
+	for {
+		var msg *SubscriptionData[Reply[Resp]]
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok = <-r.sub.Read():
+		}
+		if !ok {
+			return
+		}
+		_ = msg.Ack(ctx)
+		reply := msg.Data()
+		if reply == nil {
+			continue
+		}
+		r.mu.Lock()
+		c, found := r.pending[reply.ID]
+		delete(r.pending, reply.ID)
+		r.mu.Unlock()
+		if !found {
+			// late reply or duplicate from another replica
+			continue
+		}
+		c <- reply
+	}
+}
+
+// ResponderHandler handles a single request and returns the reply data.
+type ResponderHandler[Req any, Resp any] func(ctx context.Context, req *Req) (*Resp, error)
+
+// Responder consumes requests from a topic and publishes the handler result to the reply topic
+// named in each request. Several replicas can serve the same topic: on backends with shared
+// subscriptions (GCP) each request is handled once, on fan-out backends (Redis, in-memory) each
+// replica answers and the requester keeps the first reply.
+type Responder[Req any, Resp any] struct {
+	requests Subscriber[Request[Req]]
+	replies  Publisher[Reply[Resp]]
+	topic    string
+	handler  ResponderHandler[Req, Resp]
+	// Concurrency is the number of requests handled at once, so one slow request does not hold
+	// up the others. Values below 1 handle one request at a time.
+	Concurrency int
+}
+
+func NewResponder[Req any, Resp any](requests Subscriber[Request[Req]], replies Publisher[Reply[Resp]], topic string, handler ResponderHandler[Req, Resp]) *Responder[Req, Resp] {
+	return &Responder[Req, Resp]{
+		requests:    requests,
+		replies:     replies,
+		topic:       topic,
+		handler:     handler,
+		Concurrency: 10,
+	}
+}
+
+// Run subscribes to the request topic and handles requests until ctx is canceled.
+func (r *Responder[Req, Resp]) Run(ctx context.Context) error {
+	sub, err := r.requests.Subscribe(ctx, r.topic)
+	if err != nil {
+		return fmt.Errorf("failed subscribing to request topic %s: %w", r.topic, err)
+	}
+	r.serve(ctx, sub)
+	return nil
+}
+
+// Start subscribes to the request topic and handles requests in the background until ctx is
+// canceled. Requests published after Start returns are guaranteed to be seen.
+func (r *Responder[Req, Resp]) Start(ctx context.Context) error {
+	sub, err := r.requests.Subscribe(ctx, r.topic)
+	if err != nil {
+		return fmt.Errorf("failed subscribing to request topic %s: %w", r.topic, err)
+	}
+	go r.serve(ctx, sub)
+	return nil
+}
+
+func (r *Responder[Req, Resp]) serve(ctx context.Context, sub *Subscription[Request[Req]]) {
+	defer sub.Close(ctx)
+	concurrency := r.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		// take a slot before reading, so requests beyond the limit stay with the subscription
+		select {
+		case <-ctx.Done():
+			return
+		case slots <- struct{}{}:
+		}
+		var msg *SubscriptionData[Request[Req]]
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok = <-sub.Read():
+		}
+		if !ok {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			r.handle(ctx, msg)
+		}()
+	}
+}
+
+func (r *Responder[Req, Resp]) handle(ctx context.Context, msg *SubscriptionData[Request[Req]]) {
+	request := msg.Data()
+	if request == nil || request.ReplyTo == "" {
+		ctxLogger.Warn(ctx, "dropping request without reply topic", zap.String("topic", r.topic))
+		_ = msg.Ack(ctx)
+		return
+	}
+	handlerCtx := ctx
+	if request.Deadline > 0 {
+		deadline := time.UnixMilli(request.Deadline)
+		if time.Now().After(deadline) {
+			// the caller already gave up
+			_ = msg.Ack(ctx)
+			return
+		}
+		var cancel context.CancelFunc
+		handlerCtx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	reply := &Reply[Resp]{ID: request.ID}
+	data, err := r.handler(handlerCtx, request.Data)
+	if err != nil {
+		reply.Error = err.Error()
+	} else {
+		reply.Data = data
+	}
+	if err := publishOne[Reply[Resp]](ctx, r.replies, request.ReplyTo, reply); err != nil {
+		ctxLogger.Warn(ctx, "failed publishing reply", zap.String("id", request.ID), zap.Error(err))
+		_ = msg.Nack(ctx)
+		return
+	}
+	_ = msg.Ack(ctx)
+}
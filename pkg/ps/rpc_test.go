@@ -0,0 +1,198 @@
+package ps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type addRequest struct {
+	A int
+	B int
+}
+
+type addResponse struct {
+	Sum int
+}
+
+func newTestRPC(t *testing.T) (*InMemoryPubSub[Request[addRequest]], *InMemoryPubSub[Reply[addResponse]]) {
+	requests := NewInMemoryPubSub[Request[addRequest]]()
+	replies := NewInMemoryPubSub[Reply[addResponse]]()
+	t.Cleanup(func() {
+		_ = requests.Close()
+		_ = replies.Close()
+	})
+	return requests, replies
+}
+
+// TestRequesterCall verifies a request is answered by the responder through the reply topic.
+func TestRequesterCall(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requests, replies := newTestRPC(t)
+
+	responder := NewResponder[addRequest, addResponse](requests, replies, "add", func(ctx context.Context, req *addRequest) (*addResponse, error) {
+		if req.A < 0 {
+			return nil, errors.New("negative input")
+		}
+		return &addResponse{Sum: req.A + req.B}, nil
+	})
+	if err := responder.Start(ctx); err != nil {
+		t.Fatalf("Failed to start responder: %v", err)
+	}
+
+	requester, err := NewRequester[addRequest, addResponse](ctx, requests, replies, "add")
+	if err != nil {
+		t.Fatalf("Failed to create requester: %v", err)
+	}
+	defer requester.Close(ctx)
+
+	callCtx, callCancel := context.WithTimeout(ctx, time.Second)
+	defer callCancel()
+	resp, err := requester.Call(callCtx, &addRequest{A: 2, B: 3})
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if resp.Sum != 5 {
+		t.Errorf("Expected sum 5, got %d", resp.Sum)
+	}
+
+	_, err = requester.Call(callCtx, &addRequest{A: -1, B: 3})
+	var remoteErr *RemoteError
+	if !errors.As(err, &remoteErr) || remoteErr.Message != "negative input" {
+		t.Errorf("Expected remote error, got %v", err)
+	}
+}
+
+// TestRequesterCallMultipleReplicas ensures concurrent calls are matched to their own replies
+// when every replica answers every request.
+func TestRequesterCallMultipleReplicas(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requests, replies := newTestRPC(t)
+
+	for i := 0; i < 3; i++ {
+		responder := NewResponder[addRequest, addResponse](requests, replies, "add", func(ctx context.Context, req *addRequest) (*addResponse, error) {
+			return &addResponse{Sum: req.A + req.B}, nil
+		})
+		if err := responder.Start(ctx); err != nil {
+			t.Fatalf("Failed to start responder: %v", err)
+		}
+	}
+
+	requester, err := NewRequester[addRequest, addResponse](ctx, requests, replies, "add")
+	if err != nil {
+		t.Fatalf("Failed to create requester: %v", err)
+	}
+	defer requester.Close(ctx)
+
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			callCtx, callCancel := context.WithTimeout(ctx, time.Second)
+			defer callCancel()
+			resp, err := requester.Call(callCtx, &addRequest{A: i, B: i})
+			if err == nil && resp.Sum != 2*i {
+				err = fmt.Errorf("expected sum %d, got %d", 2*i, resp.Sum)
+			}
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Call failed: %v", err)
+		}
+	}
+}
+
+// TestRequesterCallTimeout checks that Call returns once the context deadline passes.
+func TestRequesterCallTimeout(t *testing.T) {
+	ctx := context.Background()
+	requests, replies := newTestRPC(t)
+
+	requester, err := NewRequester[addRequest, addResponse](ctx, requests, replies, "nobody-listens")
+	if err != nil {
+		t.Fatalf("Failed to create requester: %v", err)
+	}
+	defer requester.Close(ctx)
+
+	callCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := requester.Call(callCtx, &addRequest{A: 1, B: 1}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+// TestResponderConcurrency ensures a slow request does not hold up the ones behind it.
+func TestResponderConcurrency(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requests, replies := newTestRPC(t)
+
+	release := make(chan struct{})
+	defer close(release)
+	responder := NewResponder[addRequest, addResponse](requests, replies, "add", func(ctx context.Context, req *addRequest) (*addResponse, error) {
+		if req.A == 0 {
+			<-release
+		}
+		return &addResponse{Sum: req.A + req.B}, nil
+	})
+	if err := responder.Start(ctx); err != nil {
+		t.Fatalf("Failed to start responder: %v", err)
+	}
+	requester, err := NewRequester[addRequest, addResponse](ctx, requests, replies, "add")
+	if err != nil {
+		t.Fatalf("Failed to create requester: %v", err)
+	}
+	defer requester.Close(ctx)
+
+	go func() {
+		_, _ = requester.Call(ctx, &addRequest{A: 0, B: 1})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	callCtx, callCancel := context.WithTimeout(ctx, time.Second)
+	defer callCancel()
+	resp, err := requester.Call(callCtx, &addRequest{A: 2, B: 3})
+	if err != nil {
+		t.Fatalf("Call behind a slow request failed: %v", err)
+	}
+	if resp.Sum != 5 {
+		t.Errorf("Expected sum 5, got %d", resp.Sum)
+	}
+}
+
+type failingSyncPublisher[T any] struct{}
+
+func (failingSyncPublisher[T]) Publish(ctx context.Context, topic string, data chan *T, workers int) error {
+	return nil
+}
+
+func (failingSyncPublisher[T]) PublishSync(ctx context.Context, topic string, data *T) error {
+	return errors.New("broker unavailable")
+}
+
+// TestRequesterCallPublishError checks that Call returns a failed publish right away instead
+// of waiting for its deadline.
+func TestRequesterCallPublishError(t *testing.T) {
+	ctx := context.Background()
+	_, replies := newTestRPC(t)
+
+	requester, err := NewRequester[addRequest, addResponse](ctx, failingSyncPublisher[Request[addRequest]]{}, replies, "add")
+	if err != nil {
+		t.Fatalf("Failed to create requester: %v", err)
+	}
+	defer requester.Close(ctx)
+
+	callCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := requester.Call(callCtx, &addRequest{A: 1, B: 1}); err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the publish error, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Call waited for its deadline after the publish failed")
+	}
+}
@@ -0,0 +1,82 @@
+package ps
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrScheduledNotFound is returned by CancelScheduled when the id is unknown or already delivered.
+// Only backends that can look up scheduled messages return it, see ScheduledPublisher.
+var ErrScheduledNotFound = errors.New("scheduled message not found")
+
+// ScheduledPublisher defines methods for publishing messages that are delivered at a later time.
+// PublishAt and PublishAfter return an id that can be passed to CancelScheduled.
+//
+// CancelScheduled returns ErrScheduledNotFound for unknown or delivered ids on the Redis and
+// in-memory backends. GCP Pub/Sub cannot look up a published message, so GCPPubSub returns nil
+// for any id and a cancel that arrives after delivery has no effect.
+type ScheduledPublisher[T any] interface {
+	PublishAt(ctx context.Context, topic string, at time.Time, data *T) (string, error)
+	PublishAfter(ctx context.Context, topic string, delay time.Duration, data *T) (string, error)
+	CancelScheduled(ctx context.Context, id string) error
+}
+
+// scheduledMessage is the payload kept by backends that store scheduled messages outside the process.
+type scheduledMessage struct {
+	ID      string `json:"id"`
+	Topic   string `json:"topic"`
+	At      int64  `json:"at"`
+	Payload []byte `json:"payload"`
+}
+
+type scheduledItem[T any] struct {
+	ctx   context.Context
+	id    string
+	topic string
+	at    time.Time
+	data  *T
+	index int
+}
+
+// scheduleHeap is a min-heap of scheduled items ordered by delivery time.
+type scheduleHeap[T any] []*scheduledItem[T]
+
+var _ heap.Interface = &scheduleHeap[any]{}
+
+func (h scheduleHeap[T]) Len() int           { return len(h) }
+func (h scheduleHeap[T]) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h scheduleHeap[T]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *scheduleHeap[T]) Push(x any) {
+	item := x.(*scheduledItem[T])
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *scheduleHeap[T]) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*h = old[:n-1]
+	return item
+}
+
+// publishOne publishes a single message through a Publisher. Publishers that implement
+// SyncPublisher are waited for, so a failed publish is returned instead of only logged.
+func publishOne[T any](ctx context.Context, p Publisher[T], topic string, data *T) error {
+	if sp, ok := p.(SyncPublisher[T]); ok {
+		return sp.PublishSync(ctx, topic, data)
+	}
+	c := make(chan *T, 1)
+	c <- data
+	close(c)
+	return p.Publish(ctx, topic, c, 1)
+}
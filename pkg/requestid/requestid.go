@@ -0,0 +1,73 @@
+// Package requestid carries the X-Request-ID correlation id through a request's context so
+// server logs, audit logs and outbound client calls can be joined on it.
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	Header = "X-Request-ID"
+	// maxLength bounds ids accepted from callers so they can't bloat every log line.
+	maxLength = 128
+)
+
+type contextKey struct{}
+
+// New generates a request id.
+func New() string {
+	return uuid.NewString()
+}
+
+// Valid reports whether an id received from a caller is safe to reuse: non-empty, bounded and
+// limited to characters that need no escaping in headers or logs.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/', c == '+', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// FromRequest returns the caller supplied id when it is valid, otherwise a new one.
+func FromRequest(r *http.Request) string {
+	if id := r.Header.Get(Header); Valid(id) {
+		return id
+	}
+	return New()
+}
+
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request id stored in ctx, or "" when there is none.
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Inject adds the request id and the W3C traceparent of ctx to outbound headers. Headers the
+// caller already set are left untouched.
+func Inject(ctx context.Context, header http.Header) {
+	if id := FromContext(ctx); id != "" && header.Get(Header) == "" {
+		header.Set(Header, id)
+	}
+	if header.Get("traceparent") == "" {
+		propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(header))
+	}
+}
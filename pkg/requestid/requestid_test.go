@@ -0,0 +1,50 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestFromRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(Header, "abc-123")
+	assert.Equal(t, "abc-123", FromRequest(r))
+
+	for _, bad := range []string{"", "has space", "new\nline", strings.Repeat("a", maxLength+1)} {
+		r.Header.Set(Header, bad)
+		id := FromRequest(r)
+		assert.NotEqual(t, bad, id)
+		assert.True(t, Valid(id))
+	}
+}
+
+func TestInject(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	ctx = WithID(ctx, "req-1")
+
+	h := http.Header{}
+	Inject(ctx, h)
+	assert.Equal(t, "req-1", h.Get(Header))
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", h.Get("traceparent"))
+
+	h = http.Header{}
+	h.Set(Header, "caller-set")
+	Inject(ctx, h)
+	assert.Equal(t, "caller-set", h.Get(Header))
+
+	h = http.Header{}
+	Inject(context.Background(), h)
+	assert.Empty(t, h)
+}
@@ -0,0 +1,238 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/request"
+	"github.com/Seann-Moser/go-serve/pkg/response"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+const (
+	adminPortFlag  = "admin-port"
+	adminTokenFlag = "admin-token"
+)
+
+func Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("admin", pflag.ExitOnError)
+	fs.String(adminPortFlag, "", "port of the admin listener, disabled when empty")
+	fs.String(adminTokenFlag, "", "bearer token for the admin listener, it only listens on loopback when empty")
+	return fs
+}
+
+// InFlightCounter reports the requests being served, see middle.RequestTracker.
+type InFlightCounter interface {
+	InFlight() int64
+}
+
+// Route is an endpoint as shown by the routes dump.
+type Route struct {
+	Path            string               `json:"path"`
+	Methods         []string             `json:"methods"`
+	SubDomain       string               `json:"sub_domain,omitempty"`
+	PermissionLevel endpoints.Permission `json:"permission_level"`
+	Roles           []string             `json:"roles,omitempty"`
+	Group           string               `json:"group,omitempty"`
+	Public          bool                 `json:"public,omitempty"`
+}
+
+// BuildInfo is served by the build endpoint.
+type BuildInfo struct {
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	GoVersion string    `json:"go_version"`
+	Revision  string    `json:"revision,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Admin serves operational endpoints on their own listener: pprof, a dump of the registered
+// endpoints, the log level, build info and in-flight requests. Guard decides who may call it;
+// by default callers need "Authorization: Bearer <Token>". Without a Token the listener is bound to
+// loopback, see Address, and only loopback callers are allowed.
+type Admin struct {
+	Port     string
+	Token    string
+	Name     string
+	Version  string
+	Tracker  InFlightCounter
+	Guard    func(r *http.Request) bool
+	Response *response.Response
+
+	startedAt time.Time
+	mu        sync.RWMutex
+	routes    map[string]*Route
+}
+
+func NewFromFlags() *Admin {
+	return New(viper.GetString(adminPortFlag), viper.GetString(adminTokenFlag))
+}
+
+func New(port, token string) *Admin {
+	return &Admin{
+		Port:      port,
+		Token:     token,
+		Response:  response.NewResponse(false),
+		startedAt: time.Now(),
+		routes:    map[string]*Route{},
+	}
+}
+
+// Address is the listen address of the admin listener. Without a Token it only listens on
+// 127.0.0.1: a proxy sidecar forwarding from outside would otherwise pass the loopback check.
+func (a *Admin) Address() string {
+	if a.Token == "" {
+		return "127.0.0.1:" + a.Port
+	}
+	return ":" + a.Port
+}
+
+// Register records endpoints for the routes dump.
+func (a *Admin) Register(eps ...*endpoints.Endpoint) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, e := range eps {
+		if e == nil {
+			continue
+		}
+		methods := e.Methods
+		if len(methods) == 0 && e.Method != "" {
+			methods = []string{e.Method}
+		}
+		key := e.SubDomain + e.URLPath + " " + strings.Join(methods, ",")
+		a.routes[key] = &Route{
+			Path:            e.URLPath,
+			Methods:         methods,
+			SubDomain:       e.SubDomain,
+			PermissionLevel: e.PermissionLevel,
+			Roles:           e.Roles,
+			Group:           e.Group,
+			Public:          e.Public,
+		}
+	}
+}
+
+// Routes returns the registered endpoints sorted by path.
+func (a *Admin) Routes() []*Route {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	routes := make([]*Route, 0, len(a.routes))
+	for _, r := range a.routes {
+		routes = append(routes, r)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return strings.Join(routes[i].Methods, ",") < strings.Join(routes[j].Methods, ",")
+	})
+	return routes
+}
+
+// Handler returns the admin router.
+func (a *Admin) Handler() http.Handler {
+	router := mux.NewRouter()
+	router.Use(a.guard)
+	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	router.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+	router.HandleFunc("/admin/routes", a.RoutesHandler).Methods(http.MethodGet)
+	router.HandleFunc("/admin/log-level", a.LogLevelHandler).Methods(http.MethodGet, http.MethodPut)
+	router.HandleFunc("/admin/build", a.BuildHandler).Methods(http.MethodGet)
+	router.HandleFunc("/admin/inflight", a.InFlightHandler).Methods(http.MethodGet)
+	return router
+}
+
+func (a *Admin) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := a.allowed
+		if a.Guard != nil {
+			allowed = a.Guard
+		}
+		if !allowed(r) {
+			ctxLogger.Warn(r.Context(), "denied admin request", zap.String("path", r.URL.Path), zap.String("remote_addr", r.RemoteAddr))
+			a.Response.Error(r, w, nil, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Admin) allowed(r *http.Request) bool {
+	if a.Token == "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	}
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	return found && strings.EqualFold(scheme, "Bearer") && subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) == 1
+}
+
+func (a *Admin) RoutesHandler(w http.ResponseWriter, r *http.Request) {
+	a.Response.DataResponse(r, w, a.Routes(), http.StatusOK)
+}
+
+// LogLevelRequest is the body of a log level change.
+type LogLevelRequest struct {
+	Level string `json:"level"`
+}
+
+func (a *Admin) LogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		body, err := request.GetBody[LogLevelRequest](r)
+		if err != nil {
+			a.Response.Error(r, w, err, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := ctxLogger.SetLevel(body.Level); err != nil {
+			a.Response.Error(r, w, err, http.StatusBadRequest, "invalid log level")
+			return
+		}
+		ctxLogger.Info(r.Context(), "changed log level", zap.String("level", body.Level))
+	}
+	a.Response.DataResponse(r, w, LogLevelRequest{Level: ctxLogger.Level().String()}, http.StatusOK)
+}
+
+func (a *Admin) BuildHandler(w http.ResponseWriter, r *http.Request) {
+	info := BuildInfo{
+		Name:      a.Name,
+		Version:   a.Version,
+		GoVersion: runtime.Version(),
+		StartedAt: a.startedAt,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Revision = setting.Value
+			}
+		}
+	}
+	a.Response.DataResponse(r, w, info, http.StatusOK)
+}
+
+func (a *Admin) InFlightHandler(w http.ResponseWriter, r *http.Request) {
+	var inFlight int64
+	if a.Tracker != nil {
+		inFlight = a.Tracker.InFlight()
+	}
+	a.Response.DataResponse(r, w, map[string]int64{"in_flight": inFlight}, http.StatusOK)
+}
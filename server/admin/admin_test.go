@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+type fixedTracker int64
+
+func (f fixedTracker) InFlight() int64 {
+	return int64(f)
+}
+
+func call(t *testing.T, h http.Handler, method, path, token, body string) (int, map[string]interface{}) {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	output := map[string]interface{}{}
+	_ = json.Unmarshal(w.Body.Bytes(), &output)
+	return w.Code, output
+}
+
+func TestAdmin(t *testing.T) {
+	_, err := ctxLogger.NewLogger(false, "info", false)
+	require.NoError(t, err)
+	a := New("9090", "secret")
+	a.Name = "svc"
+	a.Tracker = fixedTracker(3)
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	users := endpoints.NewEndpoint("/", "/users", "", handler, http.MethodGet, http.MethodPost)
+	users.Group = "users"
+	a.Register(users, endpoints.NewEndpoint("/", "/about", "", handler, http.MethodGet))
+	h := a.Handler()
+
+	code, _ := call(t, h, http.MethodGet, "/admin/routes", "", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = call(t, h, http.MethodGet, "/admin/routes", "wrong", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, body := call(t, h, http.MethodGet, "/admin/routes", "secret", "")
+	require.Equal(t, http.StatusOK, code)
+	routes := body["data"].([]interface{})
+	require.Len(t, routes, 2)
+	assert.Equal(t, "/about", routes[0].(map[string]interface{})["path"])
+	assert.Equal(t, "users", routes[1].(map[string]interface{})["group"])
+
+	code, body = call(t, h, http.MethodPut, "/admin/log-level", "secret", `{"level":"warn"}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "warn", body["data"].(map[string]interface{})["level"])
+	code, _ = call(t, h, http.MethodPut, "/admin/log-level", "secret", `{"level":"loud"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	_, body = call(t, h, http.MethodGet, "/admin/build", "secret", "")
+	assert.Equal(t, "svc", body["data"].(map[string]interface{})["name"])
+	_, body = call(t, h, http.MethodGet, "/admin/inflight", "secret", "")
+	assert.Equal(t, float64(3), body["data"].(map[string]interface{})["in_flight"])
+
+	code, _ = call(t, h, http.MethodGet, "/debug/pprof/", "secret", "")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestAdmin_LoopbackWithoutToken(t *testing.T) {
+	h := New("9090", "").Handler()
+	r := httptest.NewRequest(http.MethodGet, "/admin/inflight", nil)
+	r.RemoteAddr = "127.0.0.1:5000"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	r.RemoteAddr = "10.1.2.3:5000"
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAdmin_Address(t *testing.T) {
+	assert.Equal(t, "127.0.0.1:9090", New("9090", "").Address())
+	assert.Equal(t, ":9090", New("9090", "secret").Address())
+}
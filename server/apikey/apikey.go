@@ -0,0 +1,143 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("api key not found")
+	ErrInvalidKey = errors.New("invalid api key")
+)
+
+// AnyScope grants access to every endpoint, including endpoints without roles.
+const AnyScope = "*"
+
+// APIKey is the stored half of a key. Only Hash is kept; the plaintext is shown once on creation.
+type APIKey struct {
+	ID         string `db:"id" json:"id" qc:"primary;data_type::varchar(64);where::="`
+	Prefix     string `db:"prefix" json:"prefix" qc:"data_type::varchar(32)"`
+	Hash       string `db:"hash" json:"hash" qc:"data_type::varchar(128)"`
+	Name       string `db:"name" json:"name" qc:"data_type::varchar(256);update"`
+	OwnerID    string `db:"owner_id" json:"owner_id" qc:"data_type::varchar(256);where::="`
+	Scopes     string `db:"scopes" json:"scopes" qc:"data_type::text;update"`
+	CreatedAt  int64  `db:"created_at" json:"created_at" qc:"data_type::bigint"`
+	ExpiresAt  int64  `db:"expires_at" json:"expires_at" qc:"data_type::bigint;update"`
+	LastUsedAt int64  `db:"last_used_at" json:"last_used_at" qc:"data_type::bigint;update"`
+	RevokedAt  int64  `db:"revoked_at" json:"revoked_at" qc:"data_type::bigint;update"`
+}
+
+// ScopeList returns the comma separated Scopes.
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return nil
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// Active reports whether the key is neither revoked nor expired at now.
+func (k *APIKey) Active(now time.Time) bool {
+	if k.RevokedAt > 0 {
+		return false
+	}
+	return k.ExpiresAt == 0 || now.Unix() < k.ExpiresAt
+}
+
+// Allows reports whether the key grants one of roles. Endpoints without roles only allow keys
+// with AnyScope, a key must never reach an endpoint nobody scoped by accident.
+func (k *APIKey) Allows(roles []string) bool {
+	for _, scope := range k.ScopeList() {
+		if scope == AnyScope {
+			return true
+		}
+		for _, role := range roles {
+			if scope == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Store persists api keys. Get returns ErrNotFound for unknown keys.
+type Store interface {
+	Create(ctx context.Context, k *APIKey) error
+	Get(ctx context.Context, id string) (*APIKey, error)
+	// List returns the keys of ownerID, or every key when ownerID is empty.
+	List(ctx context.Context, ownerID string) ([]*APIKey, error)
+	Update(ctx context.Context, k *APIKey) error
+	// Touch sets only the last use of a key, so it cannot undo a concurrent revoke.
+	Touch(ctx context.Context, id string, lastUsedAt int64) error
+}
+
+// Generate creates a key of the form "<prefix>_<id>_<secret>". The returned plaintext must be
+// handed to the caller; the APIKey only holds its hash.
+func Generate(prefix, name, ownerID string, scopes []string, expires time.Time) (string, *APIKey, error) {
+	if prefix == "" || strings.Contains(prefix, "_") {
+		return "", nil, fmt.Errorf("invalid api key prefix %q", prefix)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	k := &APIKey{
+		ID:        hex.EncodeToString(id),
+		Prefix:    prefix,
+		Name:      name,
+		OwnerID:   ownerID,
+		Scopes:    strings.Join(scopes, ","),
+		CreatedAt: time.Now().Unix(),
+	}
+	if !expires.IsZero() {
+		k.ExpiresAt = expires.Unix()
+	}
+	plaintext := fmt.Sprintf("%s_%s_%s", prefix, k.ID, base64.RawURLEncoding.EncodeToString(secret))
+	k.Hash = Hash(plaintext)
+	return plaintext, k, nil
+}
+
+// Hash returns the stored form of a plaintext key. Keys are random, so a fast hash is enough.
+func Hash(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseKey returns the prefix and id of a plaintext key.
+func ParseKey(plaintext string) (prefix, id string, err error) {
+	parts := strings.SplitN(plaintext, "_", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", ErrInvalidKey
+	}
+	return parts[0], parts[1], nil
+}
+
+// Verify looks up a plaintext key and returns it when it matches and is active.
+func Verify(ctx context.Context, store Store, plaintext string, now time.Time) (*APIKey, error) {
+	prefix, id, err := ParseKey(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	k, err := store.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if k.Prefix != prefix || subtle.ConstantTimeCompare([]byte(k.Hash), []byte(Hash(plaintext))) != 1 || !k.Active(now) {
+		return nil, ErrInvalidKey
+	}
+	return k, nil
+}
@@ -0,0 +1,162 @@
+package apikey
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Seann-Moser/go-serve/server/auth"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+func TestGenerateVerify(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStore()
+	plaintext, k, err := Generate("gs", "partner", "owner", []string{"read"}, time.Time{})
+	require.NoError(t, err)
+	require.NoError(t, store.Create(ctx, k))
+	assert.NotContains(t, k.Hash, plaintext)
+
+	got, err := Verify(ctx, store, plaintext, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, k.ID, got.ID)
+
+	_, err = Verify(ctx, store, plaintext+"x", time.Now())
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	_, err = Verify(ctx, store, "garbage", time.Now())
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	got.RevokedAt = time.Now().Unix()
+	require.NoError(t, store.Update(ctx, got))
+	_, err = Verify(ctx, store, plaintext, time.Now())
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	plaintext, k, err = Generate("gs", "partner", "owner", nil, time.Now().Add(-time.Second))
+	require.NoError(t, err)
+	require.NoError(t, store.Create(ctx, k))
+	_, err = Verify(ctx, store, plaintext, time.Now())
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStore()
+	m := New(store, "gs", false)
+	readKey, k, err := Generate("gs", "reader", "owner", []string{"read"}, time.Time{})
+	require.NoError(t, err)
+	require.NoError(t, store.Create(ctx, k))
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		if p, found := auth.GetPrincipal(r.Context()); found {
+			assert.Equal(t, AuthMethod, p.Method)
+			assert.True(t, p.HasScope("read"))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	read := endpoints.NewEndpoint("/", "/items", "", ok, http.MethodGet)
+	read.Roles = []string{"read"}
+	write := endpoints.NewEndpoint("/", "/items/new", "", ok, http.MethodPost)
+	write.Roles = []string{"write"}
+	open := endpoints.NewEndpoint("/", "/open", "", ok, http.MethodGet)
+	m.Register(read, write, open)
+	anyKey, k2, err := Generate("gs", "admin", "owner", []string{AnyScope}, time.Time{})
+	require.NoError(t, err)
+	require.NoError(t, store.Create(ctx, k2))
+
+	router := mux.NewRouter()
+	router.Use(m.AuthMiddleware)
+	router.HandleFunc(read.URLPath, ok).Methods(http.MethodGet)
+	router.HandleFunc(write.URLPath, ok).Methods(http.MethodPost)
+	router.HandleFunc("/unregistered", ok).Methods(http.MethodGet)
+	router.HandleFunc(open.URLPath, func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }).Methods(http.MethodGet)
+
+	tcs := []struct {
+		Name     string
+		Method   string
+		Path     string
+		Header   string
+		Value    string
+		Expected int
+	}{
+		{Name: "authorization header", Method: http.MethodGet, Path: "/items", Header: "Authorization", Value: "ApiKey " + readKey, Expected: http.StatusOK},
+		{Name: "custom header", Method: http.MethodGet, Path: "/items", Header: "X-API-Key", Value: readKey, Expected: http.StatusOK},
+		{Name: "no key", Method: http.MethodGet, Path: "/items", Expected: http.StatusOK},
+		{Name: "invalid key", Method: http.MethodGet, Path: "/items", Header: "X-API-Key", Value: "gs_nope_nope", Expected: http.StatusUnauthorized},
+		{Name: "missing scope", Method: http.MethodPost, Path: "/items/new", Header: "X-API-Key", Value: readKey, Expected: http.StatusForbidden},
+		{Name: "endpoint without roles", Method: http.MethodGet, Path: "/open", Header: "X-API-Key", Value: readKey, Expected: http.StatusForbidden},
+		{Name: "any scope without roles", Method: http.MethodGet, Path: "/open", Header: "X-API-Key", Value: anyKey, Expected: http.StatusOK},
+		{Name: "unregistered route", Method: http.MethodGet, Path: "/unregistered", Header: "X-API-Key", Value: readKey, Expected: http.StatusForbidden},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.Method, tc.Path, nil)
+			if tc.Header != "" {
+				r.Header.Set(tc.Header, tc.Value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			assert.Equal(t, tc.Expected, w.Code)
+		})
+	}
+
+	used, err := store.Get(ctx, k.ID)
+	require.NoError(t, err)
+	assert.NotZero(t, used.LastUsedAt)
+
+	m.AllowUnscoped = true
+	r := httptest.NewRequest(http.MethodGet, "/open", nil)
+	r.Header.Set("X-API-Key", readKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestCreateHandler_LimitsScopes(t *testing.T) {
+	m := New(NewInMemoryStore(), "gs", false)
+	create := func(principal *auth.Principal, scopes string) int {
+		r := httptest.NewRequest(http.MethodPost, "/apikeys", strings.NewReader(`{"owner_id":"owner","scopes":`+scopes+`}`))
+		r.Header.Set("Content-Type", "application/json")
+		if principal != nil {
+			r = auth.SetPrincipal(r, principal)
+		}
+		w := httptest.NewRecorder()
+		m.CreateHandler(w, r)
+		return w.Code
+	}
+	admin := &auth.Principal{ID: "admin", Roles: []string{"apikeys", "read"}}
+	assert.Equal(t, http.StatusCreated, create(admin, `["read"]`))
+	assert.Equal(t, http.StatusForbidden, create(admin, `["write"]`))
+	assert.Equal(t, http.StatusForbidden, create(admin, `["*"]`))
+	assert.Equal(t, http.StatusForbidden, create(nil, `["read"]`))
+	assert.Equal(t, http.StatusCreated, create(nil, `[]`))
+
+	key := &auth.Principal{ID: "owner", Method: AuthMethod, Scopes: []string{"read"}}
+	assert.Equal(t, http.StatusForbidden, create(key, `["read","write"]`))
+	assert.Equal(t, http.StatusCreated, create(&auth.Principal{ID: "root", Scopes: []string{AnyScope}}, `["*"]`))
+}
+
+func TestInMemoryStore_TouchKeepsRevoke(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStore()
+	_, k, err := Generate("gs", "reader", "owner", nil, time.Time{})
+	require.NoError(t, err)
+	require.NoError(t, store.Create(ctx, k))
+
+	revoked := *k
+	revoked.RevokedAt = time.Now().Unix()
+	require.NoError(t, store.Update(ctx, &revoked))
+	require.NoError(t, store.Touch(ctx, k.ID, time.Now().Unix()))
+
+	stored, err := store.Get(ctx, k.ID)
+	require.NoError(t, err)
+	assert.NotZero(t, stored.RevokedAt)
+	assert.NotZero(t, stored.LastUsedAt)
+	assert.ErrorIs(t, store.Touch(ctx, "missing", 1), ErrNotFound)
+}
@@ -0,0 +1,134 @@
+package apikey
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/request"
+	"github.com/Seann-Moser/go-serve/server/auth"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+// CreateRequest is the body of the create endpoint. ExpiresIn is in seconds, 0 never expires.
+// Scopes must be held by the caller, see CreateHandler.
+type CreateRequest struct {
+	Name      string   `json:"name"`
+	OwnerID   string   `json:"owner_id"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn int64    `json:"expires_in"`
+}
+
+// CreateResponse holds the plaintext key, which is not retrievable afterwards.
+type CreateResponse struct {
+	Key    string  `json:"key"`
+	APIKey *APIKey `json:"api_key"`
+}
+
+// Endpoints returns the admin endpoints to create, list and revoke keys under prefix, all
+// restricted to role.
+func (m *Middleware) Endpoints(prefix, role string) []*endpoints.Endpoint {
+	create := endpoints.NewEndpoint(prefix, "/apikeys", role, m.CreateHandler, http.MethodPost)
+	create.Description = "creates an api key, the key is only returned once"
+	create.SetRequestType(CreateRequest{}, http.MethodPost)
+	create.SetResponseType(CreateResponse{})
+
+	list := endpoints.NewEndpoint(prefix, "/apikeys", role, m.ListHandler, http.MethodGet)
+	list.Description = "lists api keys, optionally filtered by owner_id"
+	list.QueryParams = []string{"owner_id"}
+	list.SetResponseType([]*APIKey{})
+
+	revoke := endpoints.NewEndpoint(prefix, "/apikeys/{id}", role, m.RevokeHandler, http.MethodDelete)
+	revoke.Description = "revokes an api key"
+	return []*endpoints.Endpoint{create, list, revoke}
+}
+
+// CreateHandler creates a key with a subset of the caller's grants: each requested scope must be
+// one of the principal's scopes or roles, and AnyScope is only granted by callers holding it.
+func (m *Middleware) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := request.GetBody[CreateRequest](r)
+	if err != nil {
+		m.Response.Error(r, w, err, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if body.OwnerID == "" {
+		m.Response.Error(r, w, nil, http.StatusBadRequest, "owner_id is required")
+		return
+	}
+	principal, _ := auth.GetPrincipal(r.Context())
+	for _, scope := range body.Scopes {
+		if !grants(principal, scope) {
+			ctxLogger.Warn(r.Context(), "denied api key scope", zap.String("scope", scope))
+			m.Response.Error(r, w, nil, http.StatusForbidden, "cannot grant scope "+scope)
+			return
+		}
+	}
+	var expires time.Time
+	if body.ExpiresIn > 0 {
+		expires = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	plaintext, k, err := Generate(m.Prefix, body.Name, body.OwnerID, body.Scopes, expires)
+	if err != nil {
+		m.Response.Error(r, w, err, http.StatusInternalServerError, "failed generating api key")
+		return
+	}
+	if err := m.Store.Create(r.Context(), k); err != nil {
+		ctxLogger.Error(r.Context(), "failed storing api key", zap.Error(err))
+		m.Response.Error(r, w, err, http.StatusInternalServerError, "failed storing api key")
+		return
+	}
+	m.Response.DataResponse(r, w, CreateResponse{Key: plaintext, APIKey: redact(k)}, http.StatusCreated)
+}
+
+func (m *Middleware) ListHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := m.Store.List(r.Context(), r.URL.Query().Get("owner_id"))
+	if err != nil {
+		m.Response.Error(r, w, err, http.StatusInternalServerError, "failed listing api keys")
+		return
+	}
+	for _, k := range keys {
+		redact(k)
+	}
+	m.Response.DataResponse(r, w, keys, http.StatusOK)
+}
+
+func (m *Middleware) RevokeHandler(w http.ResponseWriter, r *http.Request) {
+	k, err := m.Store.Get(r.Context(), mux.Vars(r)["id"])
+	if errors.Is(err, ErrNotFound) {
+		m.Response.Error(r, w, err, http.StatusNotFound, "api key not found")
+		return
+	}
+	if err != nil {
+		m.Response.Error(r, w, err, http.StatusInternalServerError, "failed loading api key")
+		return
+	}
+	if k.RevokedAt == 0 {
+		k.RevokedAt = time.Now().Unix()
+		if err := m.Store.Update(r.Context(), k); err != nil {
+			m.Response.Error(r, w, err, http.StatusInternalServerError, "failed revoking api key")
+			return
+		}
+	}
+	m.Response.DataResponse(r, w, redact(k), http.StatusOK)
+}
+
+// grants reports whether p may hand scope on to a new key.
+func grants(p *auth.Principal, scope string) bool {
+	if p.HasScope(AnyScope) {
+		return true
+	}
+	if scope == AnyScope {
+		return p.HasRole(AnyScope)
+	}
+	return p.HasScope(scope) || p.HasRole(scope)
+}
+
+// redact clears the hash before a key leaves the service.
+func redact(k *APIKey) *APIKey {
+	k.Hash = ""
+	return k
+}
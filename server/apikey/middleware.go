@@ -0,0 +1,155 @@
+package apikey
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/response"
+	"github.com/Seann-Moser/go-serve/server/auth"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+const (
+	apiKeyPrefixFlag        = "apikey-prefix"
+	apiKeyHeaderFlag        = "apikey-header"
+	apiKeyTouchIntervalFlag = "apikey-touch-interval"
+	apiKeyShowErrFlag       = "apikey-show-err"
+	apiKeyAllowUnscopedFlag = "apikey-allow-unscoped"
+
+	// AuthMethod is the Principal.Method set for api key callers.
+	AuthMethod = "apikey"
+	// AuthScheme is the Authorization scheme carrying a key, "Authorization: ApiKey <key>".
+	AuthScheme = "ApiKey"
+)
+
+func Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("apikey", pflag.ExitOnError)
+	fs.String(apiKeyPrefixFlag, "gs", "prefix of generated api keys")
+	fs.String(apiKeyHeaderFlag, "X-API-Key", "header accepted in addition to \"Authorization: ApiKey\"")
+	fs.Duration(apiKeyTouchIntervalFlag, time.Minute, "minimum time between last used updates of a key")
+	fs.Bool(apiKeyAllowUnscopedFlag, false, "let any valid key call registered endpoints without roles")
+	fs.Bool(apiKeyShowErrFlag, false, "return error in http response(not secure)")
+	return fs
+}
+
+// Middleware authenticates api keys and stores the caller as an auth.Principal whose Scopes are
+// the key scopes. A key may call an endpoint when one of its scopes is in the endpoint Roles.
+// Endpoints without Roles reject keys unless AllowUnscoped is set.
+// Requests without a key are passed on untouched for the other auth middlewares.
+type Middleware struct {
+	Store         Store
+	Prefix        string
+	Header        string
+	TouchInterval time.Duration
+	// AllowUnscoped lets every valid key call registered endpoints that have no Roles. Without it
+	// those endpoints only accept keys with AnyScope.
+	AllowUnscoped bool
+	Response      *response.Response
+
+	roles endpoints.RouteOptions[[]string]
+}
+
+func NewFromFlags(store Store) *Middleware {
+	m := New(store, viper.GetString(apiKeyPrefixFlag), viper.GetBool(apiKeyShowErrFlag))
+	m.Header = viper.GetString(apiKeyHeaderFlag)
+	m.TouchInterval = viper.GetDuration(apiKeyTouchIntervalFlag)
+	m.AllowUnscoped = viper.GetBool(apiKeyAllowUnscopedFlag)
+	return m
+}
+
+func New(store Store, prefix string, showError bool) *Middleware {
+	return &Middleware{
+		Store:         store,
+		Prefix:        prefix,
+		Header:        "X-API-Key",
+		TouchInterval: time.Minute,
+		Response:      response.NewResponse(showError),
+	}
+}
+
+// Register records the roles of endpoints so key scopes can be checked against them. Keys are
+// rejected on routes that were not registered.
+func (m *Middleware) Register(eps ...*endpoints.Endpoint) {
+	for _, e := range eps {
+		if e == nil {
+			continue
+		}
+		roles := e.Roles
+		if len(roles) == 0 && e.Role != "" {
+			roles = []string{e.Role}
+		}
+		m.roles.Set(e.URLPath, roles)
+	}
+}
+
+// KeyFromRequest returns the key from "Authorization: ApiKey <key>" or the configured header.
+func (m *Middleware) KeyFromRequest(r *http.Request) (string, bool) {
+	if scheme, key, found := strings.Cut(r.Header.Get("Authorization"), " "); found && strings.EqualFold(scheme, AuthScheme) {
+		key = strings.TrimSpace(key)
+		return key, key != ""
+	}
+	if m.Header != "" {
+		if key := strings.TrimSpace(r.Header.Get(m.Header)); key != "" {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func (m *Middleware) AuthMiddleware(next http.Handler) http.Handler {
+	return auth.NewChain(m.Response, nil, m.Authenticator()).Middleware(next)
+}
+
+// Authenticator returns the auth.Authenticator for api keys. It is the Middleware itself, so an
+// auth.Chain passes registered endpoints on and key scopes keep being checked.
+func (m *Middleware) Authenticator() auth.Authenticator {
+	return m
+}
+
+func (m *Middleware) Authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
+	plaintext, found := m.KeyFromRequest(r)
+	if !found {
+		return r, auth.ErrNoCredentials
+	}
+	now := time.Now()
+	k, err := Verify(r.Context(), m.Store, plaintext, now)
+	if errors.Is(err, ErrInvalidKey) {
+		return r, auth.Unauthorized("invalid api key")
+	}
+	if err != nil {
+		return r, fmt.Errorf("failed verifying api key: %w", err)
+	}
+	roles, registered := m.routeRoles(r)
+	if !registered || !(k.Allows(roles) || (m.AllowUnscoped && len(roles) == 0)) {
+		return r, auth.Forbidden("api key is missing the required scope")
+	}
+	m.touch(r, k, now)
+	return auth.SetPrincipal(r, &auth.Principal{
+		ID:     k.OwnerID,
+		Key:    k.ID,
+		Method: AuthMethod,
+		Scopes: k.ScopeList(),
+	}), nil
+}
+
+func (m *Middleware) routeRoles(r *http.Request) ([]string, bool) {
+	return m.roles.Get(r)
+}
+
+// touch records the last use at most once per TouchInterval to limit store writes.
+func (m *Middleware) touch(r *http.Request, k *APIKey, now time.Time) {
+	if now.Sub(time.Unix(k.LastUsedAt, 0)) < m.TouchInterval {
+		return
+	}
+	if err := m.Store.Touch(r.Context(), k.ID, now.Unix()); err != nil {
+		ctxLogger.Warn(r.Context(), "failed updating api key last used", zap.Error(err))
+	}
+}
@@ -0,0 +1,67 @@
+package apikey
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Seann-Moser/QueryHelper"
+
+	"github.com/Seann-Moser/go-serve/pkg/db"
+)
+
+var _ Store = &DAOStore{}
+
+// DAOStore keeps api keys in a QueryHelper table registered on a db.DAO.
+type DAOStore struct {
+	table *QueryHelper.Table[APIKey]
+}
+
+// NewDAOStore registers the api key table on the dao and returns a Store backed by it.
+func NewDAOStore(ctx context.Context, dao *db.DAO, dataset string) (*DAOStore, error) {
+	tableCtx, err := db.AddTable[APIKey](ctx, dao, dataset, QueryHelper.QueryTypeSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed adding api key table: %w", err)
+	}
+	table, err := QueryHelper.GetTableCtx[APIKey](tableCtx)
+	if err != nil {
+		return nil, err
+	}
+	return &DAOStore{table: table}, nil
+}
+
+func (d *DAOStore) Create(ctx context.Context, k *APIKey) error {
+	if _, err := d.table.Insert(ctx, nil, *k); err != nil {
+		return fmt.Errorf("failed inserting api key: %w", err)
+	}
+	return nil
+}
+
+func (d *DAOStore) Get(ctx context.Context, id string) (*APIKey, error) {
+	q := QueryHelper.QueryTable[APIKey](d.table)
+	keys, err := q.Where(q.Column("id"), "=", "AND", 0, id).Run(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading api key: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, ErrNotFound
+	}
+	return keys[0], nil
+}
+
+func (d *DAOStore) List(ctx context.Context, ownerID string) ([]*APIKey, error) {
+	q := QueryHelper.QueryTable[APIKey](d.table)
+	if ownerID != "" {
+		q.Where(q.Column("owner_id"), "=", "AND", 0, ownerID)
+	}
+	return q.OrderBy(q.Column("created_at")).Run(ctx, nil)
+}
+
+func (d *DAOStore) Update(ctx context.Context, k *APIKey) error {
+	return d.table.Update(ctx, nil, *k)
+}
+
+func (d *DAOStore) Touch(ctx context.Context, id string, lastUsedAt int64) error {
+	return d.table.NamedExec(ctx, nil,
+		fmt.Sprintf("UPDATE %s SET last_used_at = :last_used_at WHERE id = :id", d.table.FullTableName()),
+		map[string]interface{}{"last_used_at": lastUsedAt, "id": id})
+}
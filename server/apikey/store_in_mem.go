@@ -0,0 +1,79 @@
+package apikey
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+var _ Store = &InMemoryStore{}
+
+// InMemoryStore keeps api keys in a map. It is meant for tests and single instance services.
+type InMemoryStore struct {
+	mu   sync.Mutex
+	keys map[string]*APIKey
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		keys: map[string]*APIKey{},
+	}
+}
+
+func (m *InMemoryStore) Create(ctx context.Context, k *APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := *k
+	m.keys[k.ID] = &c
+	return nil
+}
+
+func (m *InMemoryStore) Get(ctx context.Context, id string) (*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, found := m.keys[id]
+	if !found {
+		return nil, ErrNotFound
+	}
+	c := *k
+	return &c, nil
+}
+
+func (m *InMemoryStore) List(ctx context.Context, ownerID string) ([]*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var output []*APIKey
+	for _, k := range m.keys {
+		if ownerID != "" && k.OwnerID != ownerID {
+			continue
+		}
+		c := *k
+		output = append(output, &c)
+	}
+	sort.Slice(output, func(i, j int) bool {
+		return output[i].CreatedAt < output[j].CreatedAt
+	})
+	return output, nil
+}
+
+func (m *InMemoryStore) Update(ctx context.Context, k *APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, found := m.keys[k.ID]; !found {
+		return ErrNotFound
+	}
+	c := *k
+	m.keys[k.ID] = &c
+	return nil
+}
+
+func (m *InMemoryStore) Touch(ctx context.Context, id string, lastUsedAt int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, found := m.keys[id]
+	if !found {
+		return ErrNotFound
+	}
+	k.LastUsedAt = lastUsedAt
+	return nil
+}
@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/response"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request carries none of its
+// credentials, so the Chain moves on to the next one.
+var ErrNoCredentials = errors.New("no credentials")
+
+// AuthFunctions decides whether a principal may call an endpoint. Path has mux variables
+// replaced with "%".
+type AuthFunctions interface {
+	HasAccessToEndpoint(id string, key string, path string, r *http.Request) (bool, error)
+	ValidDevice(id string, deviceId string, path string, r *http.Request) (bool, error)
+	CanSkipValidation(r *http.Request) bool
+}
+
+// Authenticator identifies the caller by one method. On success it returns the request with
+// its Principal set (see SetPrincipal) and anything else the method stores in the context.
+// It returns ErrNoCredentials when the method does not apply and an *Error when the
+// credentials are invalid.
+type Authenticator interface {
+	Authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, error)
+}
+
+type AuthenticatorFunc func(w http.ResponseWriter, r *http.Request) (*http.Request, error)
+
+func (f AuthenticatorFunc) Authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
+	return f(w, r)
+}
+
+// Denier is implemented by authenticators that clean up when a request is rejected, e.g. by
+// removing cookies.
+type Denier interface {
+	Denied(w http.ResponseWriter, r *http.Request)
+}
+
+// DeviceBinder is implemented by authenticators whose principals are tied to the device they
+// logged in from. The Chain checks every principal of such an authenticator with
+// AuthFunctions.ValidDevice, also when its DeviceID is empty, since the device cookie is set by
+// the client and could simply be dropped.
+type DeviceBinder interface {
+	BindsDevice() bool
+}
+
+// Error rejects a request with Status and Message.
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func Unauthorized(message string) error {
+	return &Error{Status: http.StatusUnauthorized, Message: message}
+}
+
+func Forbidden(message string) error {
+	return &Error{Status: http.StatusForbidden, Message: message}
+}
+
+// Chain runs its authenticators in order; the first that recognizes credentials produces the
+// principal, otherwise the caller is anonymous. The principal is then checked with
+// AuthFunctions, unless the endpoint is Public or AuthFunctions.CanSkipValidation allows it.
+type Chain struct {
+	Authenticators []Authenticator
+	AuthFunctions  AuthFunctions
+	Response       *response.Response
+
+	public endpoints.RouteOptions[bool]
+}
+
+func NewChain(resp *response.Response, authFunctions AuthFunctions, authenticators ...Authenticator) *Chain {
+	if resp == nil {
+		resp = response.NewResponse(false)
+	}
+	return &Chain{
+		Authenticators: authenticators,
+		AuthFunctions:  authFunctions,
+		Response:       resp,
+	}
+}
+
+// Register records Public endpoints and passes the endpoints on to authenticators that read
+// endpoint options themselves.
+func (c *Chain) Register(eps ...*endpoints.Endpoint) {
+	for _, e := range eps {
+		if e != nil && e.Public {
+			c.public.Set(e.URLPath, true)
+		}
+	}
+	for _, a := range c.Authenticators {
+		if registrar, ok := a.(interface{ Register(...*endpoints.Endpoint) }); ok {
+			registrar.Register(eps...)
+		}
+	}
+}
+
+func (c *Chain) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		skip := c.isPublic(r) || (c.AuthFunctions != nil && c.AuthFunctions.CanSkipValidation(r))
+		authenticated, bindsDevice, err := c.authenticate(w, r)
+		if err != nil {
+			var authErr *Error
+			switch {
+			case skip:
+				// stale credentials must not lock callers out of public endpoints
+				ctxLogger.Debug(r.Context(), "ignoring invalid credentials on public endpoint", zap.Error(err))
+			case errors.As(err, &authErr):
+				c.Response.Error(r, w, err, authErr.Status, authErr.Message)
+				return
+			default:
+				ctxLogger.Error(r.Context(), "failed authenticating request", zap.Error(err))
+				c.Response.Error(r, w, err, http.StatusInternalServerError, "failed authenticating request")
+				return
+			}
+		} else {
+			r = authenticated
+		}
+		if skip || c.AuthFunctions == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, found := GetPrincipal(r.Context())
+		if !found {
+			principal = &Principal{}
+		}
+		path := EndpointPath(r)
+		if access, err := c.AuthFunctions.HasAccessToEndpoint(principal.ID, principal.Key, path, r); !access || err != nil {
+			c.denied(w, r)
+			c.Response.Error(r, w, err, http.StatusUnauthorized, "unauthorized access to endpoint")
+			return
+		}
+		if bindsDevice || principal.DeviceID != "" {
+			if access, err := c.AuthFunctions.ValidDevice(principal.ID, principal.DeviceID, path, r); !access || err != nil {
+				c.denied(w, r)
+				c.Response.Error(r, w, err, http.StatusUnauthorized, "invalid device")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate also reports whether the authenticator that recognized the credentials binds
+// its principals to a device.
+func (c *Chain) authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, bool, error) {
+	for _, a := range c.Authenticators {
+		authenticated, err := a.Authenticate(w, r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		binder, ok := a.(DeviceBinder)
+		return authenticated, ok && binder.BindsDevice(), err
+	}
+	return r, false, nil
+}
+
+func (c *Chain) denied(w http.ResponseWriter, r *http.Request) {
+	for _, a := range c.Authenticators {
+		if d, ok := a.(Denier); ok {
+			d.Denied(w, r)
+		}
+	}
+}
+
+func (c *Chain) isPublic(r *http.Request) bool {
+	public, _ := c.public.Get(r)
+	return public
+}
+
+// EndpointPath returns the request path with mux variables replaced with "%", the form passed
+// to AuthFunctions.
+func EndpointPath(r *http.Request) string {
+	path := r.URL.Path
+	for _, v := range mux.Vars(r) {
+		path = strings.ReplaceAll(path, v, "%")
+	}
+	return path
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+type testAuthFunctions struct {
+	skip bool
+}
+
+func (t testAuthFunctions) HasAccessToEndpoint(id string, key string, path string, r *http.Request) (bool, error) {
+	return id != "", nil
+}
+
+func (t testAuthFunctions) ValidDevice(id string, deviceId string, path string, r *http.Request) (bool, error) {
+	return deviceId != "bad", nil
+}
+
+func (t testAuthFunctions) CanSkipValidation(r *http.Request) bool {
+	return t.skip
+}
+
+func headerAuthenticator(header, method string) Authenticator {
+	return AuthenticatorFunc(func(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
+		value := r.Header.Get(header)
+		switch value {
+		case "":
+			return r, ErrNoCredentials
+		case "invalid":
+			return r, Unauthorized("invalid " + method)
+		case "broken":
+			return r, errors.New("store unavailable")
+		}
+		return SetPrincipal(r, &Principal{ID: value, Method: method, DeviceID: r.Header.Get("Device")}), nil
+	})
+}
+
+func TestChain(t *testing.T) {
+	var seen *Principal
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = GetPrincipal(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}
+	public := endpoints.NewEndpoint("/", "/public", "", handler, http.MethodGet)
+	public.Public = true
+	private := endpoints.NewEndpoint("/", "/private", "", handler, http.MethodGet)
+
+	tcs := []struct {
+		Name     string
+		Path     string
+		Headers  map[string]string
+		Skip     bool
+		Expected int
+		Method   string
+	}{
+		{Name: "first authenticator", Path: "/private", Headers: map[string]string{"A": "user"}, Expected: http.StatusOK, Method: "a"},
+		{Name: "falls through to second", Path: "/private", Headers: map[string]string{"B": "user"}, Expected: http.StatusOK, Method: "b"},
+		{Name: "first match wins", Path: "/private", Headers: map[string]string{"A": "user", "B": "user"}, Expected: http.StatusOK, Method: "a"},
+		{Name: "anonymous denied", Path: "/private", Expected: http.StatusUnauthorized},
+		{Name: "invalid credentials", Path: "/private", Headers: map[string]string{"A": "invalid"}, Expected: http.StatusUnauthorized},
+		{Name: "authenticator failure", Path: "/private", Headers: map[string]string{"A": "broken"}, Expected: http.StatusInternalServerError},
+		{Name: "invalid device", Path: "/private", Headers: map[string]string{"A": "user", "Device": "bad"}, Expected: http.StatusUnauthorized},
+		{Name: "public endpoint", Path: "/public", Expected: http.StatusOK},
+		{Name: "public ignores invalid credentials", Path: "/public", Headers: map[string]string{"A": "invalid"}, Expected: http.StatusOK},
+		{Name: "skip validation", Path: "/private", Skip: true, Expected: http.StatusOK},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.Name, func(t *testing.T) {
+			chain := NewChain(nil, testAuthFunctions{skip: tc.Skip}, headerAuthenticator("A", "a"), headerAuthenticator("B", "b"))
+			chain.Register(public, private)
+			router := mux.NewRouter()
+			router.Use(chain.Middleware)
+			router.HandleFunc(public.URLPath, handler)
+			router.HandleFunc(private.URLPath, handler)
+
+			seen = nil
+			r := httptest.NewRequest(http.MethodGet, tc.Path, nil)
+			for k, v := range tc.Headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			assert.Equal(t, tc.Expected, w.Code)
+			if tc.Method != "" {
+				if assert.NotNil(t, seen) {
+					assert.Equal(t, tc.Method, seen.Method)
+				}
+			}
+		})
+	}
+}
+
+type deviceAuthFunctions struct {
+	testAuthFunctions
+	checked *int
+}
+
+func (d deviceAuthFunctions) ValidDevice(id string, deviceId string, path string, r *http.Request) (bool, error) {
+	*d.checked++
+	return deviceId != "", nil
+}
+
+type bindingAuthenticator struct {
+	Authenticator
+	binds bool
+}
+
+func (b bindingAuthenticator) BindsDevice() bool {
+	return b.binds
+}
+
+func TestChain_DeviceBinding(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	tcs := []struct {
+		Name     string
+		Binds    bool
+		Device   string
+		Checked  int
+		Expected int
+	}{
+		{Name: "missing device is checked", Binds: true, Checked: 1, Expected: http.StatusUnauthorized},
+		{Name: "device is checked", Binds: true, Device: "d1", Checked: 1, Expected: http.StatusOK},
+		{Name: "opted out", Binds: false, Checked: 0, Expected: http.StatusOK},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.Name, func(t *testing.T) {
+			checked := 0
+			chain := NewChain(nil, deviceAuthFunctions{checked: &checked}, bindingAuthenticator{Authenticator: headerAuthenticator("A", "a"), binds: tc.Binds})
+			router := mux.NewRouter()
+			router.Use(chain.Middleware)
+			router.HandleFunc("/private", handler)
+
+			r := httptest.NewRequest(http.MethodGet, "/private", nil)
+			r.Header.Set("A", "user")
+			r.Header.Set("Device", tc.Device)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			assert.Equal(t, tc.Expected, w.Code)
+			assert.Equal(t, tc.Checked, checked)
+		})
+	}
+}
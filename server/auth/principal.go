@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const principalContextKey = "go-serve-principal"
+
+// Principal is the authenticated caller of a request, independent of how it authenticated.
+type Principal struct {
+	ID       string                 `json:"id"`
+	Key      string                 `json:"key,omitempty"`
+	DeviceID string                 `json:"device_id,omitempty"`
+	Method   string                 `json:"method"`
+	Roles    []string               `json:"roles,omitempty"`
+	Scopes   []string               `json:"scopes,omitempty"`
+	Claims   map[string]interface{} `json:"claims,omitempty"`
+	// MFAVerifiedAt is when the caller last passed a second factor in this login, zero if never.
+	MFAVerifiedAt time.Time `json:"mfa_verified_at,omitempty"`
+	// MFAPending is set when the login passed its first factor but still owes the second one.
+	MFAPending bool `json:"mfa_pending,omitempty"`
+	// MFAUntrusted is set when the authenticator cannot vouch for the mfa state of the login,
+	// e.g. cookies read without signature verification, which the caller may have edited.
+	MFAUntrusted bool `json:"mfa_untrusted,omitempty"`
+}
+
+// MFASatisfied reports whether the principal passed a second factor, within maxAge of now when
+// maxAge is set. Endpoints that require step-up check it.
+func (p *Principal) MFASatisfied(maxAge time.Duration, now time.Time) bool {
+	if p == nil || p.MFAPending || p.MFAUntrusted || p.MFAVerifiedAt.IsZero() {
+		return false
+	}
+	return maxAge <= 0 || now.Sub(p.MFAVerifiedAt) <= maxAge
+}
+
+// HasRole reports whether the principal has any of the roles.
+func (p *Principal) HasRole(roles ...string) bool {
+	if p == nil {
+		return false
+	}
+	for _, have := range p.Roles {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the principal was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	if p == nil {
+		return false
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey, p) //nolint:staticcheck
+}
+
+func GetPrincipal(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalContextKey).(*Principal)
+	return p, ok && p != nil
+}
+
+// SetPrincipal returns a shallow copy of r carrying the principal in its context.
+func SetPrincipal(r *http.Request, p *Principal) *http.Request {
+	return r.WithContext(WithPrincipal(r.Context(), p))
+}
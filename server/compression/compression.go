@@ -0,0 +1,232 @@
+package compression
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+const (
+	compressMinSizeFlag      = "compress-min-size"
+	compressEncodingsFlag    = "compress-encodings"
+	compressContentTypesFlag = "compress-content-types"
+)
+
+// Content codings supported out of the box. Brotli has no standard library implementation, it is
+// only offered after adding an encoder with AddEncoding(Brotli, ...) and listing it in Encodings.
+const (
+	Gzip    = "gzip"
+	Deflate = "deflate"
+	Zstd    = "zstd"
+	Brotli  = "br"
+)
+
+// DefaultEncodings are the codings with a built-in encoder, in order of preference.
+var DefaultEncodings = []string{Zstd, Gzip}
+
+// DefaultContentTypes are compressed unless configured otherwise. Entries ending in "/" match
+// every subtype.
+var DefaultContentTypes = []string{
+	"text/",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"application/x-ndjson",
+	"image/svg+xml",
+}
+
+func Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("compression", pflag.ExitOnError)
+	fs.Int(compressMinSizeFlag, 1024, "smallest response body in bytes that is compressed")
+	fs.StringSlice(compressEncodingsFlag, DefaultEncodings, "content codings in order of preference, codings without an encoder are ignored")
+	fs.StringSlice(compressContentTypesFlag, DefaultContentTypes, "content types that are compressed, entries ending in / match every subtype")
+	return fs
+}
+
+// Encoder is a reusable compressing writer, as implemented by gzip.Writer, flate.Writer,
+// zstd.Encoder and brotli.Writer.
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// NewEncoder creates an Encoder writing to w.
+type NewEncoder func(w io.Writer) (Encoder, error)
+
+// Compressor compresses responses with the content coding preferred by both the client's
+// Accept-Encoding and Encodings. Bodies smaller than MinSize, content types outside ContentTypes
+// and endpoints with SkipCompression are sent as they are. Encoders are pooled per coding.
+type Compressor struct {
+	MinSize      int
+	Encodings    []string
+	ContentTypes []string
+
+	mu    sync.RWMutex
+	pools map[string]*sync.Pool
+	skip  endpoints.RouteOptions[bool]
+}
+
+func NewFromFlags() *Compressor {
+	c := New(viper.GetInt(compressMinSizeFlag))
+	c.Encodings = viper.GetStringSlice(compressEncodingsFlag)
+	c.ContentTypes = viper.GetStringSlice(compressContentTypesFlag)
+	return c
+}
+
+func New(minSize int) *Compressor {
+	c := &Compressor{
+		MinSize:      minSize,
+		Encodings:    DefaultEncodings,
+		ContentTypes: DefaultContentTypes,
+		pools:        map[string]*sync.Pool{},
+	}
+	c.AddEncoding(Gzip, func(w io.Writer) (Encoder, error) {
+		return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	})
+	c.AddEncoding(Deflate, func(w io.Writer) (Encoder, error) {
+		return flate.NewWriter(w, flate.DefaultCompression)
+	})
+	c.AddEncoding(Zstd, func(w io.Writer) (Encoder, error) {
+		// one goroutine per response, the server already runs responses concurrently
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	})
+	return c
+}
+
+// AddEncoding adds or replaces the encoder of a content coding. The coding is only offered when
+// it is listed in Encodings.
+func (c *Compressor) AddEncoding(name string, newEncoder NewEncoder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pools[strings.ToLower(name)] = &sync.Pool{
+		New: func() interface{} {
+			e, err := newEncoder(io.Discard)
+			if err != nil {
+				return nil
+			}
+			return e
+		},
+	}
+}
+
+func (c *Compressor) Register(eps ...*endpoints.Endpoint) {
+	for _, e := range eps {
+		if e != nil && e.SkipCompression {
+			c.skip.Set(e.URLPath, true)
+		}
+	}
+}
+
+func (c *Compressor) skipped(r *http.Request) bool {
+	skip, _ := c.skip.Get(r)
+	return skip
+}
+
+func (c *Compressor) pool(encoding string) *sync.Pool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.pools[encoding]
+}
+
+// Negotiate returns the coding of Encodings with the highest quality in acceptEncoding, ties
+// going to the earlier one in Encodings, or "" when none is acceptable.
+func (c *Compressor) Negotiate(acceptEncoding string) string {
+	accepted := parseAcceptEncoding(acceptEncoding)
+	if len(accepted) == 0 {
+		return ""
+	}
+	best, bestQ := "", 0.0
+	for _, encoding := range c.Encodings {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if c.pool(encoding) == nil {
+			continue
+		}
+		q, found := accepted[encoding]
+		if !found {
+			q = accepted["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+func parseAcceptEncoding(header string) map[string]float64 {
+	output := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || !strings.EqualFold(key, "q") {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				parsed = 0
+			}
+			q = parsed
+		}
+		output[name] = q
+	}
+	return output
+}
+
+func (c *Compressor) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range c.ContentTypes {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if strings.HasSuffix(allowed, "/") && strings.HasPrefix(mediaType, allowed) || mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware compresses responses of endpoints without SkipCompression. HEAD, range and upgrade
+// requests are passed through untouched.
+func (c *Compressor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" || c.skipped(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := c.Negotiate(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, compressor: c, encoding: encoding}
+		defer func() {
+			if err := cw.Close(); err != nil {
+				// the response is cut short, there is nothing left to tell the client
+				ctxLogger.Warn(r.Context(), "failed finishing compressed response", zap.Error(err), zap.String("encoding", encoding))
+			}
+		}()
+		next.ServeHTTP(cw, r)
+	})
+}
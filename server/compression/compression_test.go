@@ -0,0 +1,157 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Seann-Moser/go-serve/pkg/metrics"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+func TestCompressor_Negotiate(t *testing.T) {
+	c := New(0)
+	tcs := []struct {
+		Accept   string
+		Expected string
+	}{
+		{Accept: "", Expected: ""},
+		{Accept: "gzip", Expected: Gzip},
+		{Accept: "gzip, zstd", Expected: Zstd},
+		{Accept: "gzip;q=1.0, zstd;q=0.5", Expected: Gzip},
+		{Accept: "br, gzip", Expected: Gzip},
+		{Accept: "*", Expected: Zstd},
+		{Accept: "*, zstd;q=0", Expected: Gzip},
+		{Accept: "deflate", Expected: ""},
+		{Accept: "identity", Expected: ""},
+	}
+	for _, tc := range tcs {
+		assert.Equal(t, tc.Expected, c.Negotiate(tc.Accept), tc.Accept)
+	}
+}
+
+func TestCompressor_Middleware(t *testing.T) {
+	c := New(100)
+	body := strings.Repeat(`{"id":"item","name":"a list entry"},`, 50)
+	jsonHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, body)
+	}
+	tagged := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		jsonHandler(w, r)
+	}
+	small := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{}`)
+	}
+	download := endpoints.NewEndpoint("/", "/download", "", jsonHandler)
+	download.SkipCompression = true
+	image := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = io.WriteString(w, body)
+	}
+	eps := []*endpoints.Endpoint{
+		endpoints.NewEndpoint("/", "/items", "", jsonHandler),
+		endpoints.NewEndpoint("/", "/small", "", small),
+		endpoints.NewEndpoint("/", "/tagged", "", tagged),
+		endpoints.NewEndpoint("/", "/image", "", image),
+		download,
+	}
+	router := mux.NewRouter()
+	for _, e := range eps {
+		router.HandleFunc(e.URLPath, e.HandlerFunc)
+	}
+	c.Register(eps...)
+	router.Use(c.Middleware)
+	do := func(path, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Accept-Encoding", accept)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("/items", "gzip")
+	require.Equal(t, Gzip, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	gz, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+
+	// twice, so the second response reuses the pooled encoder
+	for i := 0; i < 2; i++ {
+		w = do("/items", "zstd")
+		require.Equal(t, Zstd, w.Header().Get("Content-Encoding"))
+		zr, err := zstd.NewReader(w.Body)
+		require.NoError(t, err)
+		decoded, err = io.ReadAll(zr)
+		zr.Close()
+		require.NoError(t, err)
+		assert.Equal(t, body, string(decoded))
+	}
+
+	w = do("/tagged", "gzip")
+	require.Equal(t, Gzip, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, `W/"v1"`, w.Header().Get("ETag"))
+	assert.Equal(t, `"v1"`, do("/tagged", "").Header().Get("ETag"))
+
+	for _, path := range []string{"/small", "/image", "/download"} {
+		w = do(path, "gzip")
+		assert.Empty(t, w.Header().Get("Content-Encoding"), path)
+		assert.NotEmpty(t, w.Body.String(), path)
+	}
+	assert.Equal(t, body, do("/items", "").Body.String())
+}
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (h hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+func (h hijackRecorder) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(h.ResponseRecorder, r)
+}
+
+func TestCompressWriter_WrapResponseWriter(t *testing.T) {
+	c := New(10)
+	rec := httptest.NewRecorder()
+	cw := &compressWriter{ResponseWriter: hijackRecorder{rec}, compressor: c, encoding: Gzip}
+
+	// the metrics writer picks its variant by the interfaces of the writer it wraps
+	ww := metrics.NewWrapResponseWriter(cw, 1)
+	_, isFlusher := ww.(http.Flusher)
+	_, isHijacker := ww.(http.Hijacker)
+	rf, isReaderFrom := ww.(io.ReaderFrom)
+	require.True(t, isFlusher && isHijacker && isReaderFrom)
+
+	ww.Header().Set("Content-Type", "text/plain")
+	_, err := rf.ReadFrom(strings.NewReader("streamed through the encoder"))
+	require.NoError(t, err)
+	ww.(http.Flusher).Flush()
+	assert.Equal(t, http.StatusOK, ww.Status())
+	require.NoError(t, cw.Close())
+
+	assert.Equal(t, Gzip, rec.Header().Get("Content-Encoding"))
+	gz, err := gzip.NewReader(bytes.NewReader(rec.Body.Bytes()))
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, "streamed through the encoder", string(decoded))
+}
@@ -0,0 +1,161 @@
+package compression
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// compressWriter holds back the body until MinSize bytes are written, then decides whether to
+// compress it. It implements http.Flusher, http.Hijacker and io.ReaderFrom, so a
+// metrics.WrapResponseWriter around it keeps its full method set.
+type compressWriter struct {
+	http.ResponseWriter
+	compressor *Compressor
+	encoding   string
+
+	code     int
+	buf      []byte
+	decided  bool
+	hijacked bool
+	encoder  Encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided || cw.code != 0 {
+		return
+	}
+	if code < http.StatusOK {
+		// informational responses go out as they are and don't end the header
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.code = code
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		cw.decide()
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.compressor.MinSize {
+			return len(p), nil
+		}
+		if err := cw.flushBuffer(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide sends the header, compressed when the buffered body qualifies.
+func (cw *compressWriter) decide() {
+	cw.decided = true
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	if len(cw.buf) >= cw.compressor.MinSize &&
+		cw.code != http.StatusNoContent && cw.code != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" &&
+		cw.compressor.compressible(h.Get("Content-Type")) {
+		if e, ok := cw.compressor.pool(cw.encoding).Get().(Encoder); ok {
+			e.Reset(cw.ResponseWriter)
+			cw.encoder = e
+			h.Set("Content-Encoding", cw.encoding)
+			h.Del("Content-Length")
+			if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				// the compressed body is not byte for byte the one the strong etag names
+				h.Set("ETag", "W/"+etag)
+			}
+		}
+	}
+	if cw.code != 0 {
+		cw.ResponseWriter.WriteHeader(cw.code)
+	}
+}
+
+func (cw *compressWriter) flushBuffer() error {
+	if !cw.decided {
+		cw.decide()
+	}
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (cw *compressWriter) Flush() {
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+	_ = cw.flushBuffer()
+	if cw.encoder != nil {
+		_ = cw.encoder.Flush()
+	}
+	if fl, ok := cw.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("failed hijacking: %w", http.ErrNotSupported)
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		cw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// ReadFrom copies through Write, the underlying ReaderFrom would skip the encoder.
+func (cw *compressWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{cw}, r)
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close writes what is still buffered and finishes the compressed stream.
+func (cw *compressWriter) Close() error {
+	if cw.hijacked {
+		return nil
+	}
+	err := cw.flushBuffer()
+	if cw.encoder == nil {
+		return err
+	}
+	if closeErr := cw.encoder.Close(); err == nil {
+		err = closeErr
+	}
+	cw.encoder.Reset(io.Discard)
+	cw.compressor.pool(cw.encoding).Put(cw.encoder)
+	cw.encoder = nil
+	return err
+}
+
+var _ http.Flusher = &compressWriter{}
+var _ http.Hijacker = &compressWriter{}
+var _ io.ReaderFrom = &compressWriter{}
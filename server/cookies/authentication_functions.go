@@ -1,9 +1,6 @@
 package cookies
 
-import "net/http"
+import "github.com/Seann-Moser/go-serve/server/auth"
 
-type AuthFunctions interface {
-	HasAccessToEndpoint(id string, string, path string, r *http.Request) (bool, error)
-	ValidDevice(id string, deviceId string, path string, r *http.Request) (bool, error)
-	CanSkipValidation(r *http.Request) bool
-}
+// AuthFunctions is kept for existing callers; new code should use auth.AuthFunctions.
+type AuthFunctions = auth.AuthFunctions
@@ -1,18 +1,19 @@
 package cookies
 
 import (
+	"context"
+	"fmt"
 	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
-	"github.com/gorilla/mux"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 
 	"github.com/Seann-Moser/go-serve/pkg/response"
+	"github.com/Seann-Moser/go-serve/server/auth"
 	"github.com/Seann-Moser/go-serve/server/device"
 )
 
@@ -21,7 +22,17 @@ type Cookies struct {
 	Salt                   string
 	VerifySignature        bool
 	Response               *response.Response
-	authFunctions          AuthFunctions
+	// Keyring signs cookies with versioned HMAC-SHA256 keys. When nil the legacy salted hash is used.
+	Keyring *Keyring
+	// AcceptLegacySignature lets cookies signed with the salted hash verify while a Keyring is
+	// configured, so enabling the keyring does not log everyone out. They are re-signed on use.
+	AcceptLegacySignature bool
+	// SkipDeviceValidation stops the auth chain from checking cookie callers with
+	// AuthFunctions.ValidDevice. By default every cookie caller is checked.
+	SkipDeviceValidation bool
+	// KeyringFile is the file the Keyring was loaded from, reloaded by WatchKeyring.
+	KeyringFile   string
+	authFunctions AuthFunctions
 }
 
 const (
@@ -29,6 +40,9 @@ const (
 	cookiesSaltFlag            = "cookies-salt"
 	cookiesVerifySignatureFlag = "cookies-verify-signature-flag"
 	cookiesShowErrFlag         = "cookies-show-err"
+	cookiesKeyringFileFlag     = "cookies-keyring-file"
+	cookiesKeyringEnvFlag      = "cookies-keyring-env"
+	cookiesAcceptLegacyFlag    = "cookies-accept-legacy-signature"
 )
 
 func Flags() *pflag.FlagSet {
@@ -37,19 +51,52 @@ func Flags() *pflag.FlagSet {
 	fs.String(cookiesSaltFlag, "12345678", "")
 	fs.Bool(cookiesVerifySignatureFlag, false, "verify cookie signature")
 	fs.Bool(cookiesShowErrFlag, false, "return error in http response(not secure)")
+	fs.String(cookiesKeyringFileFlag, "", "json file with versioned cookie signing keys")
+	fs.String(cookiesKeyringEnvFlag, "", "environment variable with cookie signing keys as id:secret pairs, oldest first")
+	fs.Bool(cookiesAcceptLegacyFlag, true, "accept cookies signed with the salted hash while a keyring is configured")
 	return fs
 }
 
+// NewFromFlags signs cookies with the salted hash and ignores the keyring flags, use
+// NewFromFlagsWithKeyring to load them.
 func NewFromFlags(authFunctions AuthFunctions) *Cookies {
 	return &Cookies{
 		DefaultExpiresDuration: viper.GetDuration(cookiesDefaultExpiresFlag),
 		Salt:                   viper.GetString(cookiesSaltFlag),
 		VerifySignature:        viper.GetBool(cookiesVerifySignatureFlag),
 		Response:               response.NewResponse(viper.GetBool(cookiesShowErrFlag)),
+		AcceptLegacySignature:  viper.GetBool(cookiesAcceptLegacyFlag),
 		authFunctions:          authFunctions,
 	}
 }
 
+// NewFromFlagsWithKeyring is NewFromFlags with the keyring loaded from cookies-keyring-file or
+// cookies-keyring-env. A keyring that cannot be loaded is an error.
+func NewFromFlagsWithKeyring(authFunctions AuthFunctions) (*Cookies, error) {
+	c := NewFromFlags(authFunctions)
+	var err error
+	switch {
+	case viper.GetString(cookiesKeyringFileFlag) != "":
+		c.KeyringFile = viper.GetString(cookiesKeyringFileFlag)
+		c.Keyring, err = LoadKeyringFile(c.KeyringFile)
+	case viper.GetString(cookiesKeyringEnvFlag) != "":
+		c.Keyring, err = LoadKeyringEnv(viper.GetString(cookiesKeyringEnvFlag))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed loading cookie keyring: %w", err)
+	}
+	return c, nil
+}
+
+// WatchKeyring reloads the Keyring when KeyringFile changes until ctx is done, so keys rotated
+// with RotateKeyringFile reach every replica. It returns right away without a keyring file.
+func (c *Cookies) WatchKeyring(ctx context.Context) error {
+	if c.Keyring == nil || c.KeyringFile == "" {
+		return nil
+	}
+	return c.Keyring.Watch(ctx, c.KeyringFile)
+}
+
 func New(salt string, verifySignature bool, defaultExpires time.Duration, showError bool, authFunctions AuthFunctions) *Cookies {
 	return &Cookies{
 		DefaultExpiresDuration: defaultExpires,
@@ -67,40 +114,17 @@ func (c *Cookies) DeviceIDMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// AuthMiddleware authenticates the signed cookies and checks the caller with the AuthFunctions.
+// It is an auth.Chain with the cookie Authenticator only.
 func (c *Cookies) AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		//canSkip := c.authFunctions.CanSkipValidation(r)
-
-		auth := AuthFromCookies(r)
-		if c.VerifySignature && auth.ContainsFields() {
-			authSignature := c.GetAuthSignature(auth.ID, auth.Key, &auth.Expires, r)
-			if auth.Signature != authSignature.Signature {
-				c.RemoveCookies(w, r)
-				ctxLogger.Warn(r.Context(), "invalid signature", zap.String("current", auth.Signature), zap.String("expected", authSignature.Signature))
-				c.Response.Error(r, w, nil, http.StatusUnauthorized, "invalid signature")
-				return
-			}
-		}
-		path := r.URL.Path
-		for _, v := range mux.Vars(r) {
-			path = strings.ReplaceAll(path, v, "%")
-		}
-		if access, err := c.authFunctions.HasAccessToEndpoint(auth.ID, auth.Key, path, r); !access || err != nil {
-			c.RemoveCookies(w, r)
-			c.Response.Error(r, w, nil, http.StatusUnauthorized, "unauthorized access to endpoint")
-			return
-		}
-
-		if access, err := c.authFunctions.ValidDevice(auth.ID, auth.DeviceID, path, r); !access || err != nil {
-			c.RemoveCookies(w, r)
-			c.Response.Error(r, w, nil, http.StatusUnauthorized, "invalid device")
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
+	return auth.NewChain(c.Response, c.authFunctions, c.Authenticator()).Middleware(next)
 }
+
 func (c *Cookies) GetAuthSignature(id, key string, expires *time.Time, r *http.Request) *AuthSignature {
+	return c.getAuthSignature(id, key, "", expires, r)
+}
+
+func (c *Cookies) getAuthSignature(id, key, mfa string, expires *time.Time, r *http.Request) *AuthSignature {
 	var auth *AuthSignature
 	if r == nil {
 		auth = &AuthSignature{
@@ -119,11 +143,42 @@ func (c *Cookies) GetAuthSignature(id, key string, expires *time.Time, r *http.R
 	if expires != nil {
 		auth.Expires = *expires
 	}
-	auth.computeSignature(c.Salt)
+	auth.MFA = mfa
+	if c.Keyring == nil {
+		auth.computeSignature(c.Salt)
+		return auth
+	}
+	if err := auth.SignWithKeyring(c.Keyring); err != nil {
+		ctxLogger.Error(context.Background(), "failed signing cookies", zap.Error(err))
+	}
 	return auth
 }
+
+// verify checks the cookie signature against the request. Cookies signed with an older key of
+// the keyring, or with the legacy salted hash, get a fresh signature from the current key.
+func (c *Cookies) verify(w http.ResponseWriter, r *http.Request, auth *AuthSignature) bool {
+	expected := c.getAuthSignature(auth.ID, auth.Key, auth.MFA, &auth.Expires, r)
+	if c.Keyring == nil {
+		return auth.Signature == expected.Signature
+	}
+	kid, ok := c.Keyring.Verify(expected.payload(), auth.Signature)
+	if !ok && !(c.AcceptLegacySignature && auth.Signature == expected.GetSignature(c.Salt)) {
+		return false
+	}
+	if current, err := c.Keyring.Current(); err == nil && current.ID != kid {
+		cookie := getCookie(expected, CookieSignature, expected.Signature, issuedPath(r))
+		r.AddCookie(cookie)
+		http.SetCookie(w, cookie)
+	}
+	return true
+}
 func (c *Cookies) SetAuthCookies(w http.ResponseWriter, r *http.Request, id string, key string, path string) error {
 	auth := c.GetAuthSignature(id, key, nil, r)
+	previousPath := issuedPath(r)
+	issued := path
+	if len(issued) == 0 {
+		issued = defaultPath(r)
+	}
 
 	var cookies []*http.Cookie
 	cookies = append(cookies, getCookie(auth, CookieDeviceId, auth.DeviceID, path))
@@ -133,10 +188,50 @@ func (c *Cookies) SetAuthCookies(w http.ResponseWriter, r *http.Request, id stri
 	cookies = append(cookies, getCookie(auth, CookieTimestamp, strconv.Itoa(int(time.Now().Unix())), path))
 	cookies = append(cookies, getCookie(auth, CookieExpires, strconv.Itoa(int(auth.Expires.Unix())), path))
 	cookies = append(cookies, getCookie(auth, CookieMaxAge, strconv.Itoa(int(auth.MaxAge)), path))
+	cookies = append(cookies, getCookie(auth, CookiePath, issued, path))
 	for _, cookie := range cookies {
 		r.AddCookie(cookie)
 		http.SetCookie(w, cookie)
 	}
+	if getCookieValue(CookieMFA, r) != "" {
+		// the mfa state of an earlier login is signed with it and would break the new signature
+		http.SetCookie(w, &http.Cookie{Name: CookieMFA, Path: previousPath, MaxAge: -1})
+	}
+	return nil
+}
+
+// SetMFAPending marks the login of the auth cookies as waiting for its second factor. Call it
+// right after SetAuthCookies for users with mfa enrolled; until MarkMFAVerified the mfa
+// middleware only lets the login reach public endpoints and endpoints that set AllowMFAPending.
+// The state is part of the signature, so it fails without VerifySignature.
+func (c *Cookies) SetMFAPending(w http.ResponseWriter, r *http.Request) error {
+	return c.setMFA(w, r, MFAPending)
+}
+
+// MarkMFAVerified records that the login of the auth cookies passed a second factor. It fits
+// mfa.Manager.OnVerified.
+func (c *Cookies) MarkMFAVerified(w http.ResponseWriter, r *http.Request) error {
+	return c.setMFA(w, r, strconv.FormatInt(time.Now().Unix(), 10))
+}
+
+func (c *Cookies) setMFA(w http.ResponseWriter, r *http.Request, value string) error {
+	if !c.VerifySignature {
+		// without the signature check the caller could drop or forge the mfa cookie
+		return fmt.Errorf("mfa state requires cookie signature verification")
+	}
+	current := AuthFromCookies(r)
+	if len(current.ID) == 0 {
+		return fmt.Errorf("request has no auth cookies")
+	}
+	auth := c.getAuthSignature(current.ID, current.Key, value, &current.Expires, r)
+	path := issuedPath(r)
+	for _, cookie := range []*http.Cookie{
+		getCookie(auth, CookieSignature, auth.Signature, path),
+		getCookie(auth, CookieMFA, auth.MFA, path),
+	} {
+		r.AddCookie(cookie)
+		http.SetCookie(w, cookie)
+	}
 	return nil
 }
 
@@ -3,15 +3,25 @@ package cookies
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/server/auth"
 )
 
+// AuthMethod is the Principal.Method set for cookie authenticated callers.
+const AuthMethod = "cookie"
+
 func AuthFromCookies(r *http.Request) *AuthSignature {
 	auth := &AuthSignature{}
 	auth.ID = getCookieValue(CookieID, r)
 	auth.Key = getCookieValue(CookieKey, r)
 	auth.Signature = getCookieValue(CookieSignature, r)
 	auth.DeviceID = getCookieValue(CookieDeviceId, r)
+	auth.MFA = getCookieValue(CookieMFA, r)
 	expires, _ := strconv.Atoi(getCookieValue(CookieExpires, r))
 
 	auth.Expires = time.Unix(int64(expires), 0)
@@ -29,6 +39,24 @@ func getCookieValue(key string, r *http.Request) string {
 	return cookie.Value
 }
 
+// issuedPath returns the path the auth cookies of r were issued with. Cookies issued before it
+// was recorded used "/".
+func issuedPath(r *http.Request) string {
+	if path := getCookieValue(CookiePath, r); strings.HasPrefix(path, "/") {
+		return path
+	}
+	return "/"
+}
+
+// defaultPath is the path a browser gives a cookie set without one on r, see RFC 6265 5.1.4.
+func defaultPath(r *http.Request) string {
+	i := strings.LastIndex(r.URL.Path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return r.URL.Path[:i]
+}
+
 func getCookie(auth *AuthSignature, key, value, path string) *http.Cookie {
 	if len(path) == 0 {
 		return &http.Cookie{
@@ -46,3 +74,62 @@ func getCookie(auth *AuthSignature, key, value, path string) *http.Cookie {
 		MaxAge:  auth.MaxAge,
 	}
 }
+
+var (
+	_ auth.Authenticator = &cookieAuthenticator{}
+	_ auth.Denier        = &cookieAuthenticator{}
+	_ auth.DeviceBinder  = &cookieAuthenticator{}
+)
+
+type cookieAuthenticator struct {
+	cookies *Cookies
+}
+
+// Authenticator returns the auth.Authenticator for the signed id/key cookies.
+func (c *Cookies) Authenticator() auth.Authenticator {
+	return &cookieAuthenticator{cookies: c}
+}
+
+func (a *cookieAuthenticator) Authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
+	signature := AuthFromCookies(r)
+	if !signature.ContainsFields() {
+		return r, auth.ErrNoCredentials
+	}
+	if a.cookies.VerifySignature && !a.cookies.verify(w, r, signature) {
+		a.cookies.RemoveCookies(w, r)
+		ctxLogger.Warn(r.Context(), "invalid signature", zap.String("current", signature.Signature))
+		return r, auth.Unauthorized("invalid signature")
+	}
+	if len(signature.ID) == 0 {
+		return r, auth.ErrNoCredentials
+	}
+	return withPrincipal(r, signature, a.cookies.VerifySignature), nil
+}
+
+func (a *cookieAuthenticator) BindsDevice() bool {
+	return !a.cookies.SkipDeviceValidation
+}
+
+func (a *cookieAuthenticator) Denied(w http.ResponseWriter, r *http.Request) {
+	a.cookies.RemoveCookies(w, r)
+}
+
+// withPrincipal stores the cookie identity as the request principal when one is present. The
+// mfa state is only trusted when the signature covering it was verified.
+func withPrincipal(r *http.Request, a *AuthSignature, verified bool) *http.Request {
+	if len(a.ID) == 0 {
+		return r
+	}
+	principal := &auth.Principal{
+		ID:           a.ID,
+		Key:          a.Key,
+		DeviceID:     a.DeviceID,
+		Method:       AuthMethod,
+		MFAPending:   a.MFA == MFAPending,
+		MFAUntrusted: !verified,
+	}
+	if verifiedAt, err := strconv.ParseInt(a.MFA, 10, 64); err == nil && verifiedAt > 0 {
+		principal.MFAVerifiedAt = time.Unix(verifiedAt, 0)
+	}
+	return auth.SetPrincipal(r, principal)
+}
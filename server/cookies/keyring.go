@@ -0,0 +1,319 @@
+package cookies
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+)
+
+var ErrNoSigningKey = errors.New("keyring has no active signing key")
+
+// SigningKey is one version of the cookie signing secret. A key verifies signatures until
+// RetireAt; the newest active key signs.
+type SigningKey struct {
+	ID        string    `json:"id"`
+	Secret    string    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+	RetireAt  time.Time `json:"retire_at,omitempty"`
+}
+
+func (k *SigningKey) active(now time.Time) bool {
+	return k.RetireAt.IsZero() || now.Before(k.RetireAt)
+}
+
+// Keyring holds versioned HMAC-SHA256 secrets. Signatures have the form "<key id>.<mac>", so
+// any active key can verify a cookie while only the newest one signs new cookies.
+type Keyring struct {
+	mu   sync.RWMutex
+	keys []*SigningKey
+	now  func() time.Time
+}
+
+func NewKeyring(keys ...*SigningKey) (*Keyring, error) {
+	k := &Keyring{now: time.Now}
+	for _, key := range keys {
+		if err := k.Add(key); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Add inserts a key, replacing any key with the same id.
+func (k *Keyring) Add(key *SigningKey) error {
+	if key.ID == "" || strings.Contains(key.ID, ".") {
+		return fmt.Errorf("invalid signing key id %q", key.ID)
+	}
+	if len(key.Secret) < 16 {
+		return fmt.Errorf("signing key %s secret must be at least 16 characters", key.ID)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for i, existing := range k.keys {
+		if existing.ID == key.ID {
+			k.keys = append(k.keys[:i], k.keys[i+1:]...)
+			break
+		}
+	}
+	k.keys = append(k.keys, key)
+	sort.SliceStable(k.keys, func(i, j int) bool {
+		return k.keys[i].CreatedAt.Before(k.keys[j].CreatedAt)
+	})
+	return nil
+}
+
+// Current returns the newest active key.
+func (k *Keyring) Current() (*SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	now := k.now()
+	for i := len(k.keys) - 1; i >= 0; i-- {
+		if k.keys[i].active(now) {
+			return k.keys[i], nil
+		}
+	}
+	return nil, ErrNoSigningKey
+}
+
+// Keys returns a copy of all keys, oldest first.
+func (k *Keyring) Keys() []*SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	output := make([]*SigningKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		c := *key
+		output = append(output, &c)
+	}
+	return output
+}
+
+// Sign returns "<key id>.<HMAC-SHA256(payload)>" using the current key.
+func (k *Keyring) Sign(payload string) (string, error) {
+	key, err := k.Current()
+	if err != nil {
+		return "", err
+	}
+	return key.ID + "." + mac(key.Secret, payload), nil
+}
+
+// Verify checks a signature created by Sign with any active key and returns the key id used.
+func (k *Keyring) Verify(payload, signature string) (string, bool) {
+	kid, sig, found := strings.Cut(signature, ".")
+	if !found {
+		return "", false
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	now := k.now()
+	for _, key := range k.keys {
+		if key.ID != kid || !key.active(now) {
+			continue
+		}
+		return kid, hmac.Equal([]byte(sig), []byte(mac(key.Secret, payload)))
+	}
+	return kid, false
+}
+
+// Rotate adds a new random key, which becomes the signing key, and schedules every older key
+// to retire after gracePeriod. Cookies signed with older keys keep verifying until then and are
+// re-signed with the new key when they are next used, so nobody is logged out. Keys already
+// past their retirement are dropped. The new key only exists in this Keyring, use
+// RotateKeyringFile when several replicas share the keys.
+func (k *Keyring) Rotate(gracePeriod time.Duration) (*SigningKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	now := k.now()
+	key := &SigningKey{
+		ID:        "k" + strconv.FormatInt(now.UnixNano(), 36),
+		Secret:    base64.RawURLEncoding.EncodeToString(secret),
+		CreatedAt: now,
+	}
+	k.mu.Lock()
+	kept := k.keys[:0]
+	for _, existing := range k.keys {
+		if !existing.active(now) {
+			continue
+		}
+		if retireAt := now.Add(gracePeriod); existing.RetireAt.IsZero() || existing.RetireAt.After(retireAt) {
+			existing.RetireAt = retireAt
+		}
+		kept = append(kept, existing)
+	}
+	k.keys = append(kept, key)
+	k.mu.Unlock()
+	return key, nil
+}
+
+// Retire stops a key from verifying immediately, e.g. when it leaked.
+func (k *Keyring) Retire(id string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, key := range k.keys {
+		if key.ID == id {
+			key.RetireAt = k.now()
+		}
+	}
+}
+
+// Replace swaps every key for keys, e.g. after the keyring file was rotated elsewhere.
+func (k *Keyring) Replace(keys ...*SigningKey) error {
+	next, err := NewKeyring(keys...)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	k.keys = next.keys
+	k.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the keyring from path when the file changes until ctx is done. Every replica
+// watches the same file, e.g. a mounted secret, so a key added with RotateKeyringFile is picked up
+// everywhere and cookies signed by one replica verify on the others. The directory is watched
+// rather than the file so atomic renames and kubernetes secret symlink swaps are seen.
+func (k *Keyring) Watch(ctx context.Context, path string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed creating keyring watcher: %w", err)
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("failed watching %s: %w", filepath.Dir(path), err)
+	}
+
+	const debounce = 100 * time.Millisecond
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			timer.Reset(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			ctxLogger.Warn(ctx, "keyring watcher error", zap.Error(err))
+		case <-timer.C:
+			f, err := readKeyringFile(path)
+			if err == nil {
+				err = k.Replace(f.Keys...)
+			}
+			if err != nil {
+				ctxLogger.Error(ctx, "failed reloading cookie keyring, keeping the previous keys", zap.Error(err))
+				continue
+			}
+			ctxLogger.Info(ctx, "reloaded cookie keyring", zap.String("path", path))
+		}
+	}
+}
+
+// RotateKeyringFile adds a new signing key to the keyring file at path and retires the older keys
+// after gracePeriod. It is meant to run once per rotation, from a job or an operator, against the
+// file every replica watches; rotating in each replica would give every replica its own key.
+func RotateKeyringFile(path string, gracePeriod time.Duration) (*SigningKey, error) {
+	k, err := LoadKeyringFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := k.Rotate(gracePeriod)
+	if err != nil {
+		return nil, err
+	}
+	if err := SaveKeyringFile(path, k); err != nil {
+		return nil, fmt.Errorf("failed saving keyring: %w", err)
+	}
+	return key, nil
+}
+
+type keyringFile struct {
+	Keys []*SigningKey `json:"keys"`
+}
+
+// LoadKeyringFile reads a JSON file of the form {"keys":[{"id","secret","created_at","retire_at"}]}.
+func LoadKeyringFile(path string) (*Keyring, error) {
+	f, err := readKeyringFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(f.Keys...)
+}
+
+func readKeyringFile(path string) (*keyringFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading keyring: %w", err)
+	}
+	var f keyringFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed decoding keyring: %w", err)
+	}
+	return &f, nil
+}
+
+// SaveKeyringFile writes the keyring in the format read by LoadKeyringFile.
+func SaveKeyringFile(path string, k *Keyring) error {
+	data, err := json.MarshalIndent(keyringFile{Keys: k.Keys()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadKeyringEnv reads keys from an environment variable holding "id:secret" pairs separated by
+// commas, oldest first, e.g. COOKIES_SIGNING_KEYS="2024a:...,2024b:...".
+func LoadKeyringEnv(name string) (*Keyring, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil, fmt.Errorf("environment variable %s is empty", name)
+	}
+	var keys []*SigningKey
+	created := time.Unix(0, 0)
+	for _, pair := range strings.Split(value, ",") {
+		id, secret, found := strings.Cut(strings.TrimSpace(pair), ":")
+		if !found {
+			return nil, fmt.Errorf("invalid signing key entry in %s", name)
+		}
+		// the order of the entries decides which key is newest
+		created = created.Add(time.Second)
+		keys = append(keys, &SigningKey{ID: id, Secret: secret, CreatedAt: created})
+	}
+	return NewKeyring(keys...)
+}
+
+func mac(secret, payload string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,222 @@
+package cookies
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Seann-Moser/go-serve/server/auth"
+)
+
+func testKeyring(t *testing.T) *Keyring {
+	k, err := NewKeyring(&SigningKey{ID: "v1", Secret: "first-secret-0123456789", CreatedAt: time.Unix(1, 0)})
+	require.NoError(t, err)
+	return k
+}
+
+func TestKeyring_SignVerify(t *testing.T) {
+	k := testKeyring(t)
+	sig, err := k.Sign("payload")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sig, "v1."))
+
+	kid, ok := k.Verify("payload", sig)
+	assert.True(t, ok)
+	assert.Equal(t, "v1", kid)
+
+	_, ok = k.Verify("other", sig)
+	assert.False(t, ok)
+	_, ok = k.Verify("payload", "v2."+strings.TrimPrefix(sig, "v1."))
+	assert.False(t, ok)
+}
+
+func TestKeyring_Rotate(t *testing.T) {
+	k := testKeyring(t)
+	old, err := k.Sign("payload")
+	require.NoError(t, err)
+
+	key, err := k.Rotate(time.Hour)
+	require.NoError(t, err)
+	current, err := k.Current()
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, current.ID)
+
+	_, ok := k.Verify("payload", old)
+	assert.True(t, ok, "old key must verify during the grace period")
+
+	k.Retire("v1")
+	_, ok = k.Verify("payload", old)
+	assert.False(t, ok)
+}
+
+func TestKeyring_LoadEnvAndFile(t *testing.T) {
+	t.Setenv("TEST_COOKIE_KEYS", "a:aaaaaaaaaaaaaaaaaaaa,b:bbbbbbbbbbbbbbbbbbbb")
+	k, err := LoadKeyringEnv("TEST_COOKIE_KEYS")
+	require.NoError(t, err)
+	current, err := k.Current()
+	require.NoError(t, err)
+	assert.Equal(t, "b", current.ID)
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, SaveKeyringFile(path, k))
+	loaded, err := LoadKeyringFile(path)
+	require.NoError(t, err)
+	assert.Len(t, loaded.Keys(), 2)
+	current, err = loaded.Current()
+	require.NoError(t, err)
+	assert.Equal(t, "b", current.ID)
+}
+
+func TestKeyring_WatchRotatedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, SaveKeyringFile(path, testKeyring(t)))
+	replica, err := LoadKeyringFile(path)
+	require.NoError(t, err)
+	old, err := replica.Sign("payload")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = replica.Watch(ctx, path) }()
+	time.Sleep(50 * time.Millisecond)
+
+	key, err := RotateKeyringFile(path, time.Hour)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		current, err := replica.Current()
+		return err == nil && current.ID == key.ID
+	}, 5*time.Second, 20*time.Millisecond)
+	_, ok := replica.Verify("payload", old)
+	assert.True(t, ok, "old key must verify during the grace period")
+
+	require.NoError(t, os.WriteFile(path, []byte("broken"), 0o600))
+	time.Sleep(300 * time.Millisecond)
+	current, err := replica.Current()
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, current.ID, "a broken file keeps the previous keys")
+}
+
+func TestCookies_ResignAfterRotation(t *testing.T) {
+	c := New("1234", true, time.Hour, false, nil)
+	c.Keyring = testKeyring(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	login := httptest.NewRecorder()
+	require.NoError(t, c.SetAuthCookies(login, r, "1", "1", "/"))
+	auth := AuthFromCookies(r)
+	assert.True(t, strings.HasPrefix(auth.Signature, "v1."))
+
+	_, err := c.Keyring.Rotate(time.Hour)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	assert.True(t, c.verify(w, r, auth))
+	var resigned string
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == CookieSignature {
+			resigned = cookie.Value
+		}
+	}
+	current, err := c.Keyring.Current()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(resigned, current.ID+"."))
+
+	auth.Signature = "v1.forged"
+	assert.False(t, c.verify(httptest.NewRecorder(), r, auth))
+}
+
+func TestCookies_ReissueKeepsPath(t *testing.T) {
+	for _, tc := range []struct {
+		Name     string
+		Path     string
+		Expected string
+	}{
+		{Name: "explicit path", Path: "/app", Expected: "/app"},
+		{Name: "browser default path", Path: "", Expected: "/account"},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			c := New("1234", true, time.Hour, false, nil)
+			c.Keyring = testKeyring(t)
+			r := httptest.NewRequest(http.MethodPost, "/account/login", nil)
+			require.NoError(t, c.SetAuthCookies(httptest.NewRecorder(), r, "1", "1", tc.Path))
+			_, err := c.Keyring.Rotate(time.Hour)
+			require.NoError(t, err)
+
+			paths := func(w *httptest.ResponseRecorder) map[string]string {
+				output := map[string]string{}
+				for _, cookie := range w.Result().Cookies() {
+					output[cookie.Name] = cookie.Path
+				}
+				return output
+			}
+			w := httptest.NewRecorder()
+			require.True(t, c.verify(w, r, AuthFromCookies(r)))
+			assert.Equal(t, tc.Expected, paths(w)[CookieSignature], "the re-signed cookie replaces the issued one")
+
+			w = httptest.NewRecorder()
+			require.NoError(t, c.MarkMFAVerified(w, r))
+			assert.Equal(t, tc.Expected, paths(w)[CookieSignature])
+			assert.Equal(t, tc.Expected, paths(w)[CookieMFA])
+		})
+	}
+}
+
+func TestCookies_MFAState(t *testing.T) {
+	c := New("1234", true, time.Hour, false, nil)
+	c.Keyring = testKeyring(t)
+	jar := map[string]*http.Cookie{}
+	request := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, cookie := range jar {
+			r.AddCookie(cookie)
+		}
+		return r
+	}
+	store := func(w *httptest.ResponseRecorder) {
+		for _, cookie := range w.Result().Cookies() {
+			jar[cookie.Name] = cookie
+		}
+	}
+	principal := func() *auth.Principal {
+		r, err := c.Authenticator().Authenticate(httptest.NewRecorder(), request())
+		require.NoError(t, err)
+		p, found := auth.GetPrincipal(r.Context())
+		require.True(t, found)
+		return p
+	}
+
+	w := httptest.NewRecorder()
+	require.NoError(t, c.SetAuthCookies(w, request(), "1", "1", "/"))
+	store(w)
+	w = httptest.NewRecorder()
+	require.NoError(t, c.SetMFAPending(w, request()))
+	store(w)
+	assert.True(t, principal().MFAPending)
+
+	jar[CookieMFA] = &http.Cookie{Name: CookieMFA, Value: "1"}
+	_, err := c.Authenticator().Authenticate(httptest.NewRecorder(), request())
+	assert.Error(t, err, "the mfa state is signed")
+	jar[CookieMFA] = &http.Cookie{Name: CookieMFA, Value: MFAPending}
+
+	w = httptest.NewRecorder()
+	require.NoError(t, c.MarkMFAVerified(w, request()))
+	store(w)
+	p := principal()
+	assert.False(t, p.MFAPending)
+	assert.False(t, p.MFAVerifiedAt.IsZero())
+	assert.False(t, p.MFAUntrusted)
+
+	// unsigned cookies cannot carry the mfa state, the caller could drop or forge it
+	c.VerifySignature = false
+	assert.Error(t, c.SetMFAPending(httptest.NewRecorder(), request()))
+	assert.Error(t, c.MarkMFAVerified(httptest.NewRecorder(), request()))
+	assert.True(t, principal().MFAUntrusted)
+}
@@ -15,14 +15,24 @@ const (
 	CookieExpires   = "expires"
 	CookieDeviceId  = "device_id"
 	CookieMaxAge    = "max_age"
+	CookieMFA       = "mfa"
+	// CookiePath holds the path the auth cookies were issued with, so cookies set later on, such
+	// as a re-signed signature, replace them instead of shadowing them.
+	CookiePath = "path"
+
+	// MFAPending is the CookieMFA value of a login that still owes its second factor. Once it
+	// passed, the cookie holds the unix time of the verification.
+	MFAPending = "pending"
 )
 
 type AuthSignature struct {
-	ID        string
-	Key       string
-	DeviceID  string
-	Expires   time.Time
-	MaxAge    int
+	ID       string
+	Key      string
+	DeviceID string
+	Expires  time.Time
+	MaxAge   int
+	// MFA is empty, MFAPending or the unix time the login passed its second factor.
+	MFA       string
 	Signature string
 }
 
@@ -41,10 +51,31 @@ func (c *AuthSignature) computeSignature(salt string) {
 	c.Signature = c.GetSignature(salt)
 }
 
+// GetSignature returns the legacy salted sha256 signature, used when no Keyring is configured.
 func (c *AuthSignature) GetSignature(salt string) string {
-	c.MaxAge = int(c.Expires.Unix())
-	signatureRaw := fmt.Sprintf("%s-%s-%s-%d-%d-%s", c.ID, c.Key, c.DeviceID, c.MaxAge, c.Expires.Unix(), salt)
+	signatureRaw := fmt.Sprintf("%s-%s", c.payload(), salt)
 	hasher := sha256.New()
 	hasher.Write([]byte(signatureRaw))
 	return base64.URLEncoding.EncodeToString(hasher.Sum(nil))
 }
+
+// payload is the signed content of the cookies.
+func (c *AuthSignature) payload() string {
+	c.MaxAge = int(c.Expires.Unix())
+	payload := fmt.Sprintf("%s-%s-%s-%d-%d", c.ID, c.Key, c.DeviceID, c.MaxAge, c.Expires.Unix())
+	if c.MFA != "" {
+		// only appended when set so cookies from before the mfa state keep verifying
+		payload += "-mfa:" + c.MFA
+	}
+	return payload
+}
+
+// SignWithKeyring sets an HMAC-SHA256 signature made with the current key of the keyring.
+func (c *AuthSignature) SignWithKeyring(k *Keyring) error {
+	signature, err := k.Sign(c.payload())
+	if err != nil {
+		return err
+	}
+	c.Signature = signature
+	return nil
+}
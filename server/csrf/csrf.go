@@ -0,0 +1,309 @@
+package csrf
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/response"
+	"github.com/Seann-Moser/go-serve/server/cors"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+const (
+	csrfSecretFlag         = "csrf-secret"
+	csrfCookieNameFlag     = "csrf-cookie-name"
+	csrfHeaderNameFlag     = "csrf-header-name"
+	csrfTokenPathFlag      = "csrf-token-path"
+	csrfSecureCookieFlag   = "csrf-secure-cookie"
+	csrfCookieDomainFlag   = "csrf-cookie-domain"
+	csrfSessionCookiesFlag = "csrf-session-cookies"
+	csrfShowErrFlag        = "csrf-show-err"
+
+	DefaultCookieName = "csrf_token"
+	DefaultHeaderName = "X-CSRF-Token"
+	// FormField is accepted instead of the header for html form posts.
+	FormField = "csrf_token"
+)
+
+// DefaultSessionCookies are the session id cookie of session.Manager and the key cookie of
+// cookies.Cookies.
+var DefaultSessionCookies = []string{"session_id", "key"}
+
+var (
+	ErrInvalidOrigin = errors.New("request origin is not allowed")
+	ErrInvalidToken  = errors.New("missing or invalid csrf token")
+)
+
+func Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("csrf", pflag.ExitOnError)
+	fs.String(csrfSecretFlag, "", "secret used to sign csrf tokens, random per process when empty")
+	fs.String(csrfCookieNameFlag, DefaultCookieName, "name of the csrf token cookie")
+	fs.String(csrfHeaderNameFlag, DefaultHeaderName, "header the client echoes the csrf token in")
+	fs.String(csrfTokenPathFlag, "/csrf", "path of the endpoint returning a csrf token")
+	fs.Bool(csrfSecureCookieFlag, true, "only send the csrf cookie over https")
+	fs.String(csrfCookieDomainFlag, "", "domain of the csrf cookie")
+	fs.StringSlice(csrfSessionCookiesFlag, DefaultSessionCookies, "cookies identifying the login, tokens are only valid with the values they were issued for")
+	fs.Bool(csrfShowErrFlag, false, "return error in http response(not secure)")
+	return fs
+}
+
+// CSRF protects cookie authenticated endpoints with signed double-submit tokens. Unsafe requests
+// that carry cookies must come from an allowed origin and echo the token cookie in HeaderName
+// (or the FormField form value). Endpoints with SkipCSRF set are not checked.
+type CSRF struct {
+	CookieName     string
+	HeaderName     string
+	TokenPath      string
+	Secure         bool
+	Domain         string
+	AllowedOrigins []*regexp.Regexp
+	Response       *response.Response
+	// SessionCookies name the cookies identifying the login. Tokens are signed together with
+	// their values, so a token fetched by someone else and planted in the browser does not
+	// verify for the victim's login. Tokens issued before a login stop verifying after it and
+	// are replaced on the next request.
+	SessionCookies []string
+
+	secret []byte
+	exempt endpoints.RouteOptions[bool]
+}
+
+// NewFromFlags builds a CSRF whose allowed origins are the CORS origins. c may be nil, in which
+// case only same-origin requests are accepted.
+func NewFromFlags(c *cors.Cors) (*CSRF, error) {
+	csrf, err := New([]byte(viper.GetString(csrfSecretFlag)), c, viper.GetBool(csrfShowErrFlag))
+	if err != nil {
+		return nil, err
+	}
+	csrf.CookieName = viper.GetString(csrfCookieNameFlag)
+	csrf.HeaderName = viper.GetString(csrfHeaderNameFlag)
+	csrf.TokenPath = viper.GetString(csrfTokenPathFlag)
+	csrf.Secure = viper.GetBool(csrfSecureCookieFlag)
+	csrf.Domain = viper.GetString(csrfCookieDomainFlag)
+	csrf.SessionCookies = viper.GetStringSlice(csrfSessionCookiesFlag)
+	return csrf, nil
+}
+
+// ClientConfig returns the cookie, header and token path configured by Flags, for the generated
+// clients. Unset values fall back to the defaults of New.
+func ClientConfig() (cookieName, headerName, tokenPath string) {
+	cookieName, headerName, tokenPath = DefaultCookieName, DefaultHeaderName, "/csrf"
+	if v := viper.GetString(csrfCookieNameFlag); v != "" {
+		cookieName = v
+	}
+	if v := viper.GetString(csrfHeaderNameFlag); v != "" {
+		headerName = v
+	}
+	if v := viper.GetString(csrfTokenPathFlag); v != "" {
+		tokenPath = v
+	}
+	return cookieName, headerName, tokenPath
+}
+
+func New(secret []byte, c *cors.Cors, showError bool) (*CSRF, error) {
+	if len(secret) == 0 {
+		// tokens issued by other instances will not verify, set csrf-secret when load balancing
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	csrf := &CSRF{
+		CookieName:     DefaultCookieName,
+		HeaderName:     DefaultHeaderName,
+		TokenPath:      "/csrf",
+		Secure:         true,
+		Response:       response.NewResponse(showError),
+		SessionCookies: DefaultSessionCookies,
+		secret:         secret,
+	}
+	if c != nil {
+		csrf.AllowedOrigins = c.AllowedOrigins
+	}
+	return csrf, nil
+}
+
+// Register records the endpoints that opted out with SkipCSRF.
+func (c *CSRF) Register(eps ...*endpoints.Endpoint) {
+	for _, e := range eps {
+		if e != nil && e.SkipCSRF {
+			c.exempt.Set(e.URLPath, true)
+		}
+	}
+}
+
+// Endpoint returns the endpoint serving a fresh token at TokenPath.
+func (c *CSRF) Endpoint(prefix string) *endpoints.Endpoint {
+	if prefix == "" {
+		prefix = "/"
+	}
+	e := endpoints.NewEndpoint(prefix, c.TokenPath, "", c.TokenHandler, http.MethodGet)
+	e.SkipCSRF = true
+	e.Public = true
+	e.Description = "returns a csrf token and sets the csrf cookie"
+	return e
+}
+
+type tokenResponse struct {
+	Token  string `json:"token"`
+	Header string `json:"header"`
+}
+
+// TokenHandler sets a new token cookie and returns the token, for clients that cannot read the
+// cookie, e.g. when the api is on another domain.
+func (c *CSRF) TokenHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := c.newToken(r)
+	if err != nil {
+		c.Response.Error(r, w, err, http.StatusInternalServerError, "failed creating csrf token")
+		return
+	}
+	c.setCookie(w, token)
+	c.Response.DataResponse(r, w, tokenResponse{Token: token, Header: c.HeaderName}, http.StatusOK)
+}
+
+func (c *CSRF) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if safeMethod(r.Method) {
+			if cookie, err := r.Cookie(c.CookieName); err != nil || !c.validToken(r, cookie.Value) {
+				c.refresh(w, r)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		// without cookies there are no ambient credentials to forge, e.g. bearer or api key callers
+		if len(r.Cookies()) == 0 || c.isExempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !c.validOrigin(r) {
+			ctxLogger.Warn(r.Context(), "csrf origin rejected", zap.String("origin", r.Header.Get("Origin")), zap.String("referer", r.Referer()))
+			c.Response.Error(r, w, ErrInvalidOrigin, http.StatusForbidden, "invalid origin")
+			return
+		}
+		cookie, err := r.Cookie(c.CookieName)
+		if err != nil || !c.validToken(r, cookie.Value) {
+			// e.g. a token issued before the login, the client may retry with the new one
+			c.refresh(w, r)
+			c.Response.Error(r, w, ErrInvalidToken, http.StatusForbidden, "invalid csrf token")
+			return
+		}
+		sent := r.Header.Get(c.HeaderName)
+		if sent == "" {
+			sent = r.PostFormValue(FormField)
+		}
+		if !hmac.Equal([]byte(sent), []byte(cookie.Value)) {
+			c.Response.Error(r, w, ErrInvalidToken, http.StatusForbidden, "invalid csrf token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *CSRF) isExempt(r *http.Request) bool {
+	exempt, _ := c.exempt.Get(r)
+	return exempt
+}
+
+// validOrigin accepts requests whose Origin, or Referer when Origin is missing, is the request
+// host or matches an allowed origin. Requests carrying neither are left to the token check.
+func (c *CSRF) validOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		referer := r.Referer()
+		if referer == "" {
+			return true
+		}
+		u, err := url.Parse(referer)
+		if err != nil {
+			return false
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range c.AllowedOrigins {
+		if o.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// newToken returns "<random>.<HMAC-SHA256(random, session)>" for the login of r. A cookie planted
+// by a sibling domain is rejected: forging one needs the secret, and a token fetched from the
+// token endpoint is bound to the login of whoever fetched it.
+func (c *CSRF) newToken(r *http.Request) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+	return nonce + "." + c.mac(nonce, c.session(r)), nil
+}
+
+func (c *CSRF) validToken(r *http.Request, token string) bool {
+	nonce, sig, found := strings.Cut(token, ".")
+	if !found {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(c.mac(nonce, c.session(r))))
+}
+
+func (c *CSRF) mac(nonce, session string) string {
+	h := hmac.New(sha256.New, c.secret)
+	h.Write([]byte(nonce))
+	h.Write([]byte{0})
+	h.Write([]byte(session))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// session returns the values of the SessionCookies of r, empty for anonymous callers.
+func (c *CSRF) session(r *http.Request) string {
+	var values []string
+	for _, name := range c.SessionCookies {
+		if cookie, err := r.Cookie(name); err == nil {
+			values = append(values, name+"="+cookie.Value)
+		}
+	}
+	return strings.Join(values, ";")
+}
+
+func (c *CSRF) refresh(w http.ResponseWriter, r *http.Request) {
+	if token, err := c.newToken(r); err == nil {
+		c.setCookie(w, token)
+	}
+}
+
+func (c *CSRF) setCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:   c.CookieName,
+		Value:  token,
+		Path:   "/",
+		Domain: c.Domain,
+		Secure: c.Secure,
+		// readable by javascript so the generated clients can echo it
+		HttpOnly: false,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
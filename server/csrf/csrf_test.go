@@ -0,0 +1,128 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Seann-Moser/go-serve/server/cors"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+func testRouter(t *testing.T) (*mux.Router, *CSRF) {
+	c, err := cors.New([]string{`^https://app\.example\.com$`}, nil, nil, true)
+	require.NoError(t, err)
+	csrf, err := New([]byte("secret"), c, false)
+	require.NoError(t, err)
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	webhook := endpoints.NewEndpoint("/", "/webhook", "", ok, http.MethodPost)
+	webhook.SkipCSRF = true
+	csrf.Register(webhook)
+
+	router := mux.NewRouter()
+	router.Use(csrf.Middleware)
+	router.HandleFunc("/items", ok).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc(webhook.URLPath, ok).Methods(http.MethodPost)
+	router.HandleFunc(csrf.TokenPath, csrf.TokenHandler).Methods(http.MethodGet)
+	return router, csrf
+}
+
+func fetchToken(t *testing.T, router http.Handler, csrf *CSRF) string {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, csrf.TokenPath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == csrf.CookieName {
+			return cookie.Value
+		}
+	}
+	t.Fatal("token cookie not set")
+	return ""
+}
+
+func TestCSRF_Middleware(t *testing.T) {
+	router, csrf := testRouter(t)
+	token := fetchToken(t, router, csrf)
+
+	tcs := []struct {
+		Name     string
+		Path     string
+		Origin   string
+		Cookie   string
+		Header   string
+		NoCookie bool
+		Expected int
+	}{
+		{Name: "valid", Path: "/items", Origin: "https://app.example.com", Cookie: token, Header: token, Expected: http.StatusOK},
+		{Name: "same origin", Path: "/items", Origin: "http://example.com", Cookie: token, Header: token, Expected: http.StatusOK},
+		{Name: "missing header", Path: "/items", Origin: "https://app.example.com", Cookie: token, Expected: http.StatusForbidden},
+		{Name: "mismatched header", Path: "/items", Cookie: token, Header: "other", Expected: http.StatusForbidden},
+		{Name: "forged cookie", Path: "/items", Cookie: "a.b", Header: "a.b", Expected: http.StatusForbidden},
+		{Name: "bad origin", Path: "/items", Origin: "https://evil.com", Cookie: token, Header: token, Expected: http.StatusForbidden},
+		{Name: "no cookies", Path: "/items", NoCookie: true, Expected: http.StatusOK},
+		{Name: "exempt", Path: "/webhook", Origin: "https://evil.com", Cookie: token, Expected: http.StatusOK},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tc.Path, nil)
+			if tc.Origin != "" {
+				r.Header.Set("Origin", tc.Origin)
+			}
+			if !tc.NoCookie {
+				r.AddCookie(&http.Cookie{Name: csrf.CookieName, Value: tc.Cookie})
+			}
+			if tc.Header != "" {
+				r.Header.Set(csrf.HeaderName, tc.Header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			assert.Equal(t, tc.Expected, w.Code)
+		})
+	}
+}
+
+func TestCSRF_TokenBoundToSession(t *testing.T) {
+	router, csrf := testRouter(t)
+	fetch := func(session string) string {
+		r := httptest.NewRequest(http.MethodGet, csrf.TokenPath, nil)
+		if session != "" {
+			r.AddCookie(&http.Cookie{Name: "session_id", Value: session})
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == csrf.CookieName {
+				return cookie.Value
+			}
+		}
+		t.Fatal("token cookie not set")
+		return ""
+	}
+	post := func(session, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/items", nil)
+		r.AddCookie(&http.Cookie{Name: "session_id", Value: session})
+		r.AddCookie(&http.Cookie{Name: csrf.CookieName, Value: token})
+		r.Header.Set(csrf.HeaderName, token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, post("victim", fetch("victim")).Code)
+	assert.Equal(t, http.StatusForbidden, post("victim", fetch("attacker")).Code, "tokens of another login are rejected")
+	w := post("victim", fetch(""))
+	assert.Equal(t, http.StatusForbidden, w.Code, "tokens issued before the login are rejected")
+	var refreshed string
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == csrf.CookieName {
+			refreshed = cookie.Value
+		}
+	}
+	assert.Equal(t, http.StatusOK, post("victim", refreshed).Code, "the rejection sets a token for the current login")
+}
@@ -0,0 +1,118 @@
+package device
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	deviceTrustedProxiesFlag = "device-trusted-proxies"
+	deviceTrustedHopsFlag    = "device-trusted-proxy-hops"
+)
+
+func Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("device", pflag.ExitOnError)
+	fs.StringSlice(deviceTrustedProxiesFlag, nil, "ips or cidrs of the proxies in front of the server, their X-Forwarded-For entries are trusted")
+	fs.Int(deviceTrustedHopsFlag, 0, "number of proxies in front of the server, used when no trusted proxies are listed")
+	return fs
+}
+
+// TrustedProxies decides how much of X-Forwarded-For is believed when resolving the client ip.
+// Every entry left of the last proxy is written by the caller, so the client is the rightmost
+// entry that was not added by a trusted proxy. The zero value trusts no header and uses the
+// connection address.
+type TrustedProxies struct {
+	// Networks are the proxies in front of the server. Entries added by them are skipped.
+	Networks []*net.IPNet
+	// Hops is the number of proxies in front of the server, used when Networks is empty.
+	Hops int
+}
+
+func TrustedProxiesFromFlags() (*TrustedProxies, error) {
+	return NewTrustedProxies(viper.GetInt(deviceTrustedHopsFlag), viper.GetStringSlice(deviceTrustedProxiesFlag)...)
+}
+
+// NewTrustedProxies parses proxies given as ips or cidrs.
+func NewTrustedProxies(hops int, proxies ...string) (*TrustedProxies, error) {
+	t := &TrustedProxies{Hops: hops}
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			proxy = fmt.Sprintf("%s/%d", proxy, bits)
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		t.Networks = append(t.Networks, network)
+	}
+	return t, nil
+}
+
+// ClientIP returns the ip of the caller of r. A nil TrustedProxies trusts no header.
+func (t *TrustedProxies) ClientIP(r *http.Request) string {
+	remote := hostOnly(r.RemoteAddr)
+	if t == nil || (len(t.Networks) == 0 && t.Hops <= 0) {
+		return remote
+	}
+	// the connection address is the last hop of the chain
+	var chain []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, entry := range strings.Split(header, ",") {
+			if entry = hostOnly(strings.TrimSpace(entry)); entry != "" {
+				chain = append(chain, entry)
+			}
+		}
+	}
+	chain = append(chain, remote)
+
+	if len(t.Networks) == 0 {
+		if t.Hops >= len(chain) {
+			return chain[0]
+		}
+		return chain[len(chain)-1-t.Hops]
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !t.trusted(chain[i]) {
+			return chain[i]
+		}
+	}
+	return chain[0]
+}
+
+func (t *TrustedProxies) trusted(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range t.Networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostOnly strips the port and brackets of an address.
+func hostOnly(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return strings.Trim(address, "[]")
+}
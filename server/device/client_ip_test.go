@@ -0,0 +1,43 @@
+package device
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	byNetwork, err := NewTrustedProxies(0, "10.0.0.0/8", "192.168.1.1")
+	require.NoError(t, err)
+	tcs := []struct {
+		Name       string
+		Proxies    *TrustedProxies
+		RemoteAddr string
+		Forwarded  string
+		Expected   string
+	}{
+		{Name: "no proxies ignores header", RemoteAddr: "203.0.113.9:1234", Forwarded: "1.1.1.1", Expected: "203.0.113.9"},
+		{Name: "one hop", Proxies: &TrustedProxies{Hops: 1}, RemoteAddr: "10.0.0.1:1234", Forwarded: "203.0.113.9", Expected: "203.0.113.9"},
+		{Name: "one hop spoofed", Proxies: &TrustedProxies{Hops: 1}, RemoteAddr: "10.0.0.1:1234", Forwarded: "1.1.1.1, 203.0.113.9", Expected: "203.0.113.9"},
+		{Name: "more hops than entries", Proxies: &TrustedProxies{Hops: 3}, RemoteAddr: "10.0.0.1:1234", Forwarded: "203.0.113.9", Expected: "203.0.113.9"},
+		{Name: "trusted networks", Proxies: byNetwork, RemoteAddr: "10.0.0.1:1234", Forwarded: "1.1.1.1, 203.0.113.9, 192.168.1.1", Expected: "203.0.113.9"},
+		{Name: "untrusted remote", Proxies: byNetwork, RemoteAddr: "203.0.113.9:1234", Forwarded: "1.1.1.1", Expected: "203.0.113.9"},
+		{Name: "ipv6 remote", RemoteAddr: "[2001:db8::1]:1234", Expected: "2001:db8::1"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.RemoteAddr
+			if tc.Forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tc.Forwarded)
+			}
+			assert.Equal(t, tc.Expected, tc.Proxies.ClientIP(r))
+		})
+	}
+
+	_, err = NewTrustedProxies(0, "not-an-ip")
+	assert.Error(t, err)
+}
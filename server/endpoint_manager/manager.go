@@ -23,6 +23,9 @@ type EndpointHandler interface {
 type Manager struct {
 	Router                  *mux.Router
 	ExtraAddEndpointProcess func(ctx context.Context, endpoint *endpoints.Endpoint) error
+	// HandlerMiddleware wraps every endpoint handler inside its otel instrumentation, so it
+	// sees the request span.
+	HandlerMiddleware []mux.MiddlewareFunc
 }
 
 func NewManager(router *mux.Router) *Manager {
@@ -57,6 +60,13 @@ func (m *Manager) AddEndpoints(ctx context.Context, handlers []EndpointHandler)
 	return nil
 }
 
+func (m *Manager) wrap(handler http.Handler) http.Handler {
+	for i := len(m.HandlerMiddleware) - 1; i >= 0; i-- {
+		handler = m.HandlerMiddleware[i](handler)
+	}
+	return handler
+}
+
 func (m *Manager) AddEndpoint(ctx context.Context, endpoint *endpoints.Endpoint) error {
 	if endpoint == nil {
 		return nil
@@ -75,12 +85,12 @@ func (m *Manager) AddEndpoint(ctx context.Context, endpoint *endpoints.Endpoint)
 	}
 	handleFunc := func(pattern string, handlerFunc func(http.ResponseWriter, *http.Request)) *mux.Route {
 		// Configure the "http.route" for the HTTP instrumentation.
-		handler := otelhttp.WithRouteTag(pattern, otelhttp.NewHandler(http.HandlerFunc(handlerFunc), pattern))
+		handler := otelhttp.WithRouteTag(pattern, otelhttp.NewHandler(m.wrap(http.HandlerFunc(handlerFunc)), pattern))
 		return m.Router.Handle(pattern, handler)
 	}
 	handle := func(pattern string, handlerFunc http.Handler) *mux.Route {
 		// Configure the "http.route" for the HTTP instrumentation.\
-		handler := otelhttp.WithRouteTag(pattern, otelhttp.NewHandler(handlerFunc, pattern))
+		handler := otelhttp.WithRouteTag(pattern, otelhttp.NewHandler(m.wrap(handlerFunc), pattern))
 		return m.Router.Handle(pattern, handler)
 	}
 
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/Seann-Moser/QueryHelper"
 	"github.com/gorilla/mux"
@@ -21,6 +22,16 @@ const (
 	SuperAdmin = Permission(int(^uint(0) >> 1))
 )
 
+// Priority orders endpoints for load shedding: low priority requests are shed first and critical
+// ones, such as health checks, never.
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityLow
+	PriorityCritical
+)
+
 type Endpoint struct {
 	SubDomain       string           `json:"sub_domain" db:"sub_domain" qc:"primary;where::="`
 	Redirect        string           `json:"redirect" db:"redirect" qc:"join;update"`
@@ -48,7 +59,22 @@ type Endpoint struct {
 	QueryParams     []string               `json:"-" db:"-"`
 	SkipGenerate    bool                   `json:"-" db:"-"`
 	Public          bool                   `json:"-" db:"-"`
-	Group           string                 `json:"-" db:"-"`
+	SkipCSRF        bool                   `json:"-" db:"-"`
+	// RequireMFA demands a second factor, passed within MFAMaxAge when it is set.
+	RequireMFA bool          `json:"-" db:"-"`
+	MFAMaxAge  time.Duration `json:"-" db:"-"`
+	// AllowMFAPending lets a login that still owes its second factor reach the endpoint, e.g. the
+	// mfa verify endpoint or a logout. Every other non public endpoint rejects such logins.
+	AllowMFAPending bool `json:"-" db:"-"`
+	// RequireClientCert demands a verified client certificate when mTLS verification is optional.
+	RequireClientCert bool   `json:"-" db:"-"`
+	Group             string `json:"-" db:"-"`
+	// RateLimit names the rate limit policy of the endpoint, Group's policy is used when empty.
+	RateLimit string `json:"-" db:"-"`
+	// Priority decides when requests to the endpoint are shed under load.
+	Priority Priority `json:"-" db:"-"`
+	// SkipCompression sends responses as they are, for bodies that are already compressed.
+	SkipCompression bool `json:"-" db:"-"`
 
 	CustomData       string   `json:"-" db:"-"`
 	CustomDataParams []string `json:"-" db:"-"`
@@ -0,0 +1,52 @@
+package endpoints
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// RouteTemplate returns the path template of the route mux matched for r, which is the URLPath
+// its endpoint was added with.
+func RouteTemplate(r *http.Request) (string, bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", false
+	}
+	tmpl, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+	return tmpl, true
+}
+
+// RouteOptions holds a per endpoint option, keyed by URLPath, for middlewares that look up the
+// endpoint of a request. The zero value is ready to use and safe for concurrent use.
+type RouteOptions[T any] struct {
+	mu      sync.RWMutex
+	options map[string]T
+}
+
+// Set stores the option of the endpoint added under urlPath.
+func (o *RouteOptions[T]) Set(urlPath string, value T) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.options == nil {
+		o.options = map[string]T{}
+	}
+	o.options[urlPath] = value
+}
+
+// Get returns the option of the endpoint matched for r.
+func (o *RouteOptions[T]) Get(r *http.Request) (T, bool) {
+	var value T
+	tmpl, found := RouteTemplate(r)
+	if !found {
+		return value, false
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	value, found = o.options[tmpl]
+	return value, found
+}
@@ -123,3 +123,35 @@ func TestNewAdvancedHealthCheck_NoPings(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Empty(t, rr.Body.String())
 }
+
+type testPinger struct {
+	err error
+}
+
+func (p *testPinger) Ping(ctx context.Context, timeout time.Duration) error {
+	return p.err
+}
+
+// Test Probes.HealthCheck includes pings added after it was created
+func TestProbes_HealthCheckPing(t *testing.T) {
+	probes := NewProbes(time.Second)
+	endpoint := probes.HealthCheck(nil)
+	pinger := &testPinger{}
+	probes.AddPing("pubsub", PingFromPinger(pinger, time.Second))
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/healthcheck", nil)
+	endpoint.HandlerFunc(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	pinger.err = assert.AnError
+	rr = httptest.NewRecorder()
+	endpoint.HandlerFunc(rr, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "failed to ping:pubsub")
+
+	// pings stay on the instance they were added to
+	rr = httptest.NewRecorder()
+	NewProbes(time.Second).HealthCheck(nil).HandlerFunc(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 	"net/http"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/Seann-Moser/go-serve/server/endpoints"
@@ -15,6 +18,7 @@ import (
 var HealthCheck = &endpoints.Endpoint{
 	URLPath:         "/healthcheck",
 	PermissionLevel: endpoints.All,
+	Priority:        endpoints.PriorityCritical,
 	HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	},
@@ -24,6 +28,7 @@ var HealthCheck = &endpoints.Endpoint{
 var AdvancedHealthCheck = &endpoints.Endpoint{
 	URLPath:         "/healthcheck",
 	PermissionLevel: endpoints.All,
+	Priority:        endpoints.PriorityCritical,
 	HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	},
@@ -32,27 +37,58 @@ var AdvancedHealthCheck = &endpoints.Endpoint{
 
 type Ping func(ctx context.Context) bool
 
+// Pinger is implemented by dependencies that can report their own health, such as ps.PubSub.
+type Pinger interface {
+	Ping(ctx context.Context, timeout time.Duration) error
+}
+
+// PingFromPinger adapts a Pinger to a Ping that fails when Ping returns an error.
+func PingFromPinger(p Pinger, timeout time.Duration) Ping {
+	return func(ctx context.Context) bool {
+		if err := p.Ping(ctx, timeout); err != nil {
+			ctxLogger.Warn(ctx, "ping failed", zap.Error(err))
+			return false
+		}
+		return true
+	}
+}
+
 func NewAdvancedHealthCheck(timeout time.Duration, pings map[string]Ping) *endpoints.Endpoint {
+	return advancedHealthCheck(timeout, func() map[string]Ping { return pings })
+}
+
+// advancedHealthCheck runs the pings returned by pings on every request.
+func advancedHealthCheck(timeout time.Duration, pings func() map[string]Ping) *endpoints.Endpoint {
 	return &endpoints.Endpoint{
 		URLPath:         "/healthcheck",
 		PermissionLevel: endpoints.All,
+		Priority:        endpoints.PriorityCritical,
 		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
 			ctx, cancel := context.WithTimeout(r.Context(), timeout)
 			defer cancel()
-			eg, ctx := errgroup.WithContext(ctx)
-			for k, v := range pings {
+			// every ping runs to completion so the response names all failing dependencies
+			var mu sync.Mutex
+			var failed []string
+			eg := errgroup.Group{}
+			for k, v := range pings() {
 				eg.Go(func() error {
 					if !v(ctx) {
-						return fmt.Errorf("failed to ping:%s", k)
+						mu.Lock()
+						failed = append(failed, k)
+						mu.Unlock()
 					}
 					return nil
 				})
-				//if !v(ctx) {
-				//	missing = append(missing, fmt.Sprintf("failed to ping:%s", k))
-				//}
 			}
+			_ = eg.Wait()
 
-			if err := eg.Wait(); err != nil {
+			if len(failed) > 0 {
+				sort.Strings(failed)
+				errs := make([]error, 0, len(failed))
+				for _, k := range failed {
+					errs = append(errs, fmt.Errorf("failed to ping:%s", k))
+				}
+				err := errors.Join(errs...)
 				w.WriteHeader(http.StatusServiceUnavailable)
 				_, _ = w.Write([]byte(err.Error()))
 				ctxLogger.Error(r.Context(), "failed to ping all dependencies", zap.Error(err))
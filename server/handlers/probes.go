@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+// Check reports the health of one dependency or subsystem.
+type Check func(ctx context.Context) error
+
+// CheckFromPing adapts a Ping.
+func CheckFromPing(ping Ping) Check {
+	return func(ctx context.Context) error {
+		if !ping(ctx) {
+			return errors.New("ping failed")
+		}
+		return nil
+	}
+}
+
+// Probe kinds, matching the kubernetes probes.
+const (
+	ProbeLiveness  = "livez"
+	ProbeReadiness = "readyz"
+	ProbeStartup   = "startupz"
+)
+
+var (
+	errDraining   = errors.New("server is shutting down")
+	errNotStarted = errors.New("server has not started")
+)
+
+// CheckResult is one check of a ProbeReport. LastError and LastFailure persist across calls so
+// a flapping dependency shows up even when the current run passed.
+type CheckResult struct {
+	Name        string     `json:"name"`
+	Healthy     bool       `json:"healthy"`
+	Latency     float64    `json:"latency_ms"`
+	Error       string     `json:"error,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastFailure *time.Time `json:"last_failure,omitempty"`
+}
+
+// ProbeReport is the body of every probe endpoint.
+type ProbeReport struct {
+	Probe   string         `json:"probe"`
+	Healthy bool           `json:"healthy"`
+	Checks  []*CheckResult `json:"checks"`
+}
+
+// Probes serves /livez, /readyz and /startupz from checks registered by name.
+//
+// Liveness only runs its own checks, so a slow dependency never gets the pod restarted.
+// Readiness runs its checks and the pings added with AddPing, and fails from Drain on, so
+// load balancers stop sending traffic before the server shuts down. Startup fails until
+// MarkStarted and then runs its checks.
+type Probes struct {
+	Timeout time.Duration
+
+	mu       sync.RWMutex
+	checks   map[string]map[string]Check
+	pings    map[string]Ping
+	failures map[string]*CheckResult
+	started  atomic.Bool
+	draining atomic.Bool
+}
+
+func NewProbes(timeout time.Duration) *Probes {
+	return &Probes{
+		Timeout: timeout,
+		checks: map[string]map[string]Check{
+			ProbeLiveness:  {},
+			ProbeReadiness: {},
+			ProbeStartup:   {},
+		},
+		pings:    map[string]Ping{},
+		failures: map[string]*CheckResult{},
+	}
+}
+
+func (p *Probes) add(probe, name string, check Check) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checks[probe][name] = check
+}
+
+func (p *Probes) AddLiveness(name string, check Check) {
+	p.add(ProbeLiveness, name, check)
+}
+
+func (p *Probes) AddReadiness(name string, check Check) {
+	p.add(ProbeReadiness, name, check)
+}
+
+func (p *Probes) AddStartup(name string, check Check) {
+	p.add(ProbeStartup, name, check)
+}
+
+// AddPing adds a dependency ping to readiness and to the health check returned by HealthCheck.
+func (p *Probes) AddPing(name string, ping Ping) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pings[name] = ping
+}
+
+func (p *Probes) pingsWith(extra map[string]Ping) map[string]Ping {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	output := make(map[string]Ping, len(p.pings)+len(extra))
+	for k, v := range p.pings {
+		output[k] = v
+	}
+	for k, v := range extra {
+		output[k] = v
+	}
+	return output
+}
+
+// HealthCheck is NewAdvancedHealthCheck running pings and the pings added with AddPing, including
+// those added after it was created.
+func (p *Probes) HealthCheck(pings map[string]Ping) *endpoints.Endpoint {
+	return advancedHealthCheck(p.Timeout, func() map[string]Ping { return p.pingsWith(pings) })
+}
+
+// MarkStarted lets startup pass once its checks do.
+func (p *Probes) MarkStarted() {
+	p.started.Store(true)
+}
+
+// Drain makes readiness fail for the rest of the process lifetime.
+func (p *Probes) Drain() {
+	p.draining.Store(true)
+}
+
+func (p *Probes) Draining() bool {
+	return p.draining.Load()
+}
+
+func (p *Probes) checksOf(probe string) map[string]Check {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	output := map[string]Check{}
+	for k, v := range p.checks[probe] {
+		output[k] = v
+	}
+	if probe == ProbeReadiness {
+		for k, v := range p.pings {
+			if _, found := output[k]; !found {
+				output[k] = CheckFromPing(v)
+			}
+		}
+	}
+	return output
+}
+
+// Run runs the checks of probe concurrently.
+func (p *Probes) Run(ctx context.Context, probe string) *ProbeReport {
+	report := &ProbeReport{Probe: probe, Healthy: true, Checks: []*CheckResult{}}
+	switch {
+	case probe == ProbeReadiness && p.Draining():
+		report.Checks = append(report.Checks, &CheckResult{Name: "shutdown", Error: errDraining.Error()})
+	case probe != ProbeLiveness && !p.started.Load():
+		report.Checks = append(report.Checks, &CheckResult{Name: "startup", Error: errNotStarted.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range p.checksOf(probe) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := check(ctx)
+			result := &CheckResult{Name: name, Healthy: err == nil, Latency: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			mu.Lock()
+			report.Checks = append(report.Checks, result)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(report.Checks, func(i, j int) bool {
+		return report.Checks[i].Name < report.Checks[j].Name
+	})
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, result := range report.Checks {
+		if !result.Healthy {
+			report.Healthy = false
+			now := time.Now()
+			p.failures[probe+"/"+result.Name] = &CheckResult{LastError: result.Error, LastFailure: &now}
+		}
+		if last, found := p.failures[probe+"/"+result.Name]; found {
+			result.LastError = last.LastError
+			result.LastFailure = last.LastFailure
+		}
+	}
+	return report
+}
+
+// Handler serves the report of probe, 503 when it is unhealthy.
+func (p *Probes) Handler(probe string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := p.Run(r.Context(), probe)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		status := http.StatusOK
+		if !report.Healthy {
+			status = http.StatusServiceUnavailable
+			ctxLogger.Warn(r.Context(), "probe failing", zap.String("probe", probe))
+		}
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			ctxLogger.Debug(r.Context(), "failed writing probe report", zap.Error(err))
+		}
+	}
+}
+
+// Endpoints returns the three probe endpoints under prefix. They are public and skipped by the
+// generators.
+func (p *Probes) Endpoints(prefix string) []*endpoints.Endpoint {
+	var output []*endpoints.Endpoint
+	for _, probe := range []string{ProbeLiveness, ProbeReadiness, ProbeStartup} {
+		e := endpoints.NewEndpoint(prefix, "/"+probe, "", p.Handler(probe), http.MethodGet)
+		e.Public = true
+		e.SkipGenerate = true
+		e.Priority = endpoints.PriorityCritical
+		e.Description = probe + " probe report"
+		output = append(output, e)
+	}
+	return output
+}
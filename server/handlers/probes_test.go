@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func probe(t *testing.T, p *Probes, name string) (int, *ProbeReport) {
+	w := httptest.NewRecorder()
+	p.Handler(name)(w, httptest.NewRequest(http.MethodGet, "/"+name, nil))
+	report := &ProbeReport{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), report))
+	return w.Code, report
+}
+
+func TestProbes(t *testing.T) {
+	p := NewProbes(time.Second)
+	var dbErr error
+	p.AddReadiness("db", func(ctx context.Context) error { return dbErr })
+	p.AddLiveness("loop", func(ctx context.Context) error { return nil })
+
+	code, _ := probe(t, p, ProbeLiveness)
+	assert.Equal(t, http.StatusOK, code, "liveness does not wait for startup")
+	code, _ = probe(t, p, ProbeStartup)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	code, _ = probe(t, p, ProbeReadiness)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	p.MarkStarted()
+	code, _ = probe(t, p, ProbeStartup)
+	assert.Equal(t, http.StatusOK, code)
+
+	dbErr = errors.New("connection refused")
+	code, report := probe(t, p, ProbeReadiness)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	require.Len(t, report.Checks, 1)
+	assert.Equal(t, "connection refused", report.Checks[0].Error)
+
+	dbErr = nil
+	code, report = probe(t, p, ProbeReadiness)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, report.Checks[0].Healthy)
+	assert.Equal(t, "connection refused", report.Checks[0].LastError, "the last error is kept after recovery")
+	assert.NotNil(t, report.Checks[0].LastFailure)
+
+	p.Drain()
+	code, report = probe(t, p, ProbeReadiness)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "shutdown", report.Checks[len(report.Checks)-1].Name)
+	code, _ = probe(t, p, ProbeLiveness)
+	assert.Equal(t, http.StatusOK, code, "draining does not fail liveness")
+}
@@ -0,0 +1,199 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Seann-Moser/go-serve/server/auth"
+)
+
+func testKeys(t *testing.T) []*Key {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return []*Key{
+		NewHMACKey("hmac", []byte("secret")),
+		NewRSAKey("rsa", rsaKey),
+		NewECKey("ec", ecKey),
+	}
+}
+
+func TestSignAndParse(t *testing.T) {
+	ctx := context.Background()
+	for _, key := range testKeys(t) {
+		t.Run(key.Algorithm, func(t *testing.T) {
+			issuer := NewIssuer(key, "go-serve", time.Minute, "api")
+			token, err := issuer.Issue("user-1", &Claims{Roles: []string{"admin"}, Scope: "read write", Extra: map[string]interface{}{"tenant": "t1"}})
+			require.NoError(t, err)
+
+			validator := NewValidator(NewKeySet(key), "go-serve", "api", 0)
+			claims, err := validator.Parse(ctx, token)
+			require.NoError(t, err)
+			assert.Equal(t, "user-1", claims.Subject)
+			assert.Equal(t, []string{"admin"}, claims.Roles)
+			assert.Equal(t, []string{"read", "write"}, claims.Scopes())
+			assert.Equal(t, "t1", claims.Extra["tenant"])
+		})
+	}
+}
+
+func TestValidator_RejectsInvalidTokens(t *testing.T) {
+	ctx := context.Background()
+	key := NewHMACKey("hmac", []byte("secret"))
+	now := time.Now()
+	tcs := []struct {
+		Name     string
+		Claims   *Claims
+		Expected error
+	}{
+		{Name: "Expired", Claims: &Claims{ExpiresAt: now.Add(-time.Minute).Unix(), Issuer: "go-serve", Audience: Audience{"api"}}, Expected: ErrExpired},
+		{Name: "Not Yet Valid", Claims: &Claims{NotBefore: now.Add(time.Minute).Unix(), Issuer: "go-serve", Audience: Audience{"api"}}, Expected: ErrNotYetValid},
+		{Name: "Wrong Issuer", Claims: &Claims{Issuer: "other", Audience: Audience{"api"}}, Expected: ErrInvalidIssuer},
+		{Name: "Wrong Audience", Claims: &Claims{Issuer: "go-serve", Audience: Audience{"web"}}, Expected: ErrInvalidAudience},
+	}
+	validator := NewValidator(NewKeySet(key), "go-serve", "api", time.Second)
+	for _, tc := range tcs {
+		t.Run(tc.Name, func(t *testing.T) {
+			token, err := Sign(key, tc.Claims)
+			require.NoError(t, err)
+			_, err = validator.Parse(ctx, token)
+			assert.ErrorIs(t, err, tc.Expected)
+		})
+	}
+
+	token, err := Sign(key, &Claims{Issuer: "go-serve", Audience: Audience{"api"}})
+	require.NoError(t, err)
+	_, err = validator.Parse(ctx, token)
+	assert.ErrorIs(t, err, ErrMissingExpiry)
+	validator.AllowMissingExpiry = true
+	_, err = validator.Parse(ctx, token)
+	assert.NoError(t, err)
+	validator.AllowMissingExpiry = false
+
+	token, err = Sign(NewHMACKey("hmac", []byte("other-secret")), &Claims{Issuer: "go-serve", Audience: Audience{"api"}})
+	require.NoError(t, err)
+	_, err = validator.Parse(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestValidator_RejectsAlgorithmMismatch(t *testing.T) {
+	keys := testKeys(t)
+	rsaKey := keys[1]
+	// an HS256 token signed with the RSA key id must not be accepted
+	forged, err := Sign(&Key{ID: rsaKey.ID, Algorithm: HS256, Secret: []byte("public")}, &Claims{Subject: "attacker"})
+	require.NoError(t, err)
+	_, err = NewValidator(NewKeySet(rsaKey), "", "", 0).Parse(context.Background(), forged)
+	assert.ErrorIs(t, err, ErrUnsupportedAlg)
+}
+
+func TestJWKS_RotatesKeys(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeys(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	data, err := MarshalJWKS(keys[1])
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	jwks := NewJWKS(path, time.Hour)
+	jwks.MinRefreshInterval = 0
+	validator := NewValidator(jwks, "", "", 0)
+
+	token, err := Sign(keys[1], &Claims{Subject: "user-1", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	require.NoError(t, err)
+	_, err = validator.Parse(ctx, token)
+	require.NoError(t, err)
+
+	data, err = MarshalJWKS(keys[1], keys[2])
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	token, err = Sign(keys[2], &Claims{Subject: "user-2", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	require.NoError(t, err)
+	claims, err := validator.Parse(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "user-2", claims.Subject)
+}
+
+func TestJWKS_ServesCachedKeysWhileReloading(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeys(t)
+	data, err := MarshalJWKS(keys[1])
+	require.NoError(t, err)
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			<-release
+		}
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	jwks := NewJWKS(server.URL, time.Hour)
+	_, err = jwks.Key(ctx, keys[1].ID)
+	require.NoError(t, err)
+
+	// the set is stale, the reload blocks on the server
+	jwks.mu.Lock()
+	jwks.fetchedAt = time.Now().Add(-2 * time.Hour)
+	jwks.mu.Unlock()
+	for i := 0; i < 5; i++ {
+		done := make(chan error, 1)
+		go func() {
+			_, err := jwks.Key(ctx, keys[1].ID)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("Key waited for the reload")
+		}
+	}
+	require.Eventually(t, func() bool { return requests.Load() == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestMiddleware_SetsPrincipal(t *testing.T) {
+	key := NewHMACKey("hmac", []byte("secret"))
+	m := New(NewValidator(NewKeySet(key), "", "", 0), false, nil)
+	token, err := NewIssuer(key, "", time.Minute).Issue("user-1", &Claims{Roles: []string{"admin"}})
+	require.NoError(t, err)
+
+	var principal *auth.Principal
+	handler := m.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = auth.GetPrincipal(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	require.NotNil(t, principal)
+	assert.Equal(t, "user-1", principal.ID)
+	assert.Equal(t, AuthMethod, principal.Method)
+	assert.True(t, principal.HasRole("admin"))
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer invalid")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Header().Get("WWW-Authenticate"), "invalid_token")
+}
@@ -0,0 +1,350 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+var ErrKeyNotFound = errors.New("signing key not found")
+
+// Key is a signing or verification key identified by its kid.
+type Key struct {
+	ID         string
+	Algorithm  string
+	Secret     []byte
+	PublicKey  crypto.PublicKey
+	PrivateKey crypto.Signer
+}
+
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, Algorithm: HS256, Secret: secret}
+}
+
+func NewRSAKey(id string, key *rsa.PrivateKey) *Key {
+	return &Key{ID: id, Algorithm: RS256, PublicKey: &key.PublicKey, PrivateKey: key}
+}
+
+func NewECKey(id string, key *ecdsa.PrivateKey) *Key {
+	return &Key{ID: id, Algorithm: ES256, PublicKey: &key.PublicKey, PrivateKey: key}
+}
+
+// ParsePrivateKeyPEM reads an RSA or P-256 EC private key in PKCS#1, SEC1 or PKCS#8 form.
+func ParsePrivateKeyPEM(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no pem block found")
+	}
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing private key: %w", err)
+	}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return NewRSAKey(id, k), nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported curve %s", k.Curve.Params().Name)
+		}
+		return NewECKey(id, k), nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+}
+
+// KeyProvider looks up verification keys by kid. An empty kid is only resolved when the
+// provider holds a single key.
+type KeyProvider interface {
+	Key(ctx context.Context, kid string) (*Key, error)
+}
+
+var _ KeyProvider = &KeySet{}
+var _ KeyProvider = &JWKS{}
+
+// KeySet is a static set of keys.
+type KeySet struct {
+	keys map[string]*Key
+}
+
+func NewKeySet(keys ...*Key) *KeySet {
+	ks := &KeySet{keys: map[string]*Key{}}
+	for _, k := range keys {
+		ks.keys[k.ID] = k
+	}
+	return ks
+}
+
+func (ks *KeySet) Key(ctx context.Context, kid string) (*Key, error) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k, nil
+		}
+	}
+	k, found := ks.keys[kid]
+	if !found {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, kid)
+	}
+	return k, nil
+}
+
+// jwk is the JSON form of a single key in a JWKS document (RFC 7517).
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	K   string `json:"k,omitempty"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// ParseJWKS decodes a JWKS document. Keys with an unsupported type or curve are skipped.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var set jwkSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed decoding jwks: %w", err)
+	}
+	ks := NewKeySet()
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.key()
+		if err != nil {
+			continue
+		}
+		ks.keys[key.ID] = key
+	}
+	return ks, nil
+}
+
+func (k jwk) key() (*Key, error) {
+	switch k.Kty {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return nil, err
+		}
+		return NewHMACKey(k.Kid, secret), nil
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{ID: k.Kid, Algorithm: RS256, PublicKey: &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{ID: k.Kid, Algorithm: ES256, PublicKey: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+// MarshalJWKS encodes the public parts of the asymmetric keys so they can be served to verifiers.
+func MarshalJWKS(keys ...*Key) ([]byte, error) {
+	set := jwkSet{Keys: []jwk{}}
+	for _, k := range keys {
+		switch pub := k.PublicKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, jwk{
+				Kty: "RSA", Kid: k.ID, Alg: RS256, Use: "sig",
+				N: base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			set.Keys = append(set.Keys, jwk{
+				Kty: "EC", Kid: k.ID, Alg: ES256, Use: "sig", Crv: "P-256",
+				X: base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+				Y: base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+			})
+		}
+	}
+	return json.Marshal(set)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// JWKS loads keys from a local file or URL and caches them. The set is reloaded once
+// RefreshInterval has passed, and early when a token names an unknown kid so rotated keys are
+// picked up, but no more often than MinRefreshInterval. Reloads run outside the lock, one at a
+// time, and the cached set keeps being served while a scheduled reload is running.
+type JWKS struct {
+	Source             string
+	RefreshInterval    time.Duration
+	MinRefreshInterval time.Duration
+	Client             *http.Client
+
+	mu        sync.RWMutex
+	set       *KeySet
+	fetchedAt time.Time
+	loads     singleflight.Group
+}
+
+func NewJWKS(source string, refreshInterval time.Duration) *JWKS {
+	return &JWKS{
+		Source:             source,
+		RefreshInterval:    refreshInterval,
+		MinRefreshInterval: time.Minute,
+		Client:             &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (j *JWKS) Key(ctx context.Context, kid string) (*Key, error) {
+	set, fetchedAt := j.cached()
+	if set == nil {
+		var err error
+		if set, err = j.refresh(ctx); err != nil {
+			return nil, err
+		}
+		fetchedAt = time.Now()
+	} else if j.RefreshInterval > 0 && time.Since(fetchedAt) > j.RefreshInterval {
+		// the reload finishes in the background, this request uses the cached keys
+		j.reload(ctx)
+	}
+	k, err := set.Key(ctx, kid)
+	if err == nil || time.Since(fetchedAt) < j.MinRefreshInterval {
+		return k, err
+	}
+	if set, err = j.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return set.Key(ctx, kid)
+}
+
+// Refresh reloads the key set from the source.
+func (j *JWKS) Refresh(ctx context.Context) error {
+	_, err := j.refresh(ctx)
+	return err
+}
+
+func (j *JWKS) cached() (*KeySet, time.Time) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.set, j.fetchedAt
+}
+
+// refresh waits for a reload, joining the one already running.
+func (j *JWKS) refresh(ctx context.Context) (*KeySet, error) {
+	select {
+	case result := <-j.reload(ctx):
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(*KeySet), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// reload starts loading the key set unless a load is already running. The load outlives the
+// request that started it, it is bounded by the Client timeout.
+func (j *JWKS) reload(ctx context.Context) <-chan singleflight.Result {
+	ctx = context.WithoutCancel(ctx)
+	return j.loads.DoChan(j.Source, func() (interface{}, error) {
+		data, err := j.load(ctx)
+		if err != nil {
+			ctxLogger.Warn(ctx, "failed loading jwks", zap.String("source", j.Source), zap.Error(err))
+			j.mu.Lock()
+			if j.set != nil {
+				// keep serving the cached keys and retry after MinRefreshInterval
+				j.fetchedAt = time.Now().Add(-j.RefreshInterval).Add(j.MinRefreshInterval)
+			}
+			j.mu.Unlock()
+			return nil, fmt.Errorf("failed loading jwks from %s: %w", j.Source, err)
+		}
+		set, err := ParseJWKS(data)
+		if err != nil {
+			return nil, err
+		}
+		j.mu.Lock()
+		j.set = set
+		j.fetchedAt = time.Now()
+		j.mu.Unlock()
+		return set, nil
+	})
+}
+
+func (j *JWKS) load(ctx context.Context) ([]byte, error) {
+	if !isURL(j.Source) {
+		return os.ReadFile(j.Source)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.Source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
@@ -0,0 +1,119 @@
+package jwt
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/response"
+	"github.com/Seann-Moser/go-serve/server/auth"
+)
+
+const (
+	jwtJWKSFlag        = "jwt-jwks"
+	jwtJWKSRefreshFlag = "jwt-jwks-refresh"
+	jwtHMACSecretFlag  = "jwt-hmac-secret"
+	jwtIssuerFlag      = "jwt-issuer"
+	jwtAudienceFlag    = "jwt-audience"
+	jwtLeewayFlag      = "jwt-leeway"
+	jwtAllowNoExpFlag  = "jwt-allow-missing-exp"
+	jwtShowErrFlag     = "jwt-show-err"
+
+	// AuthMethod is the Principal.Method set for bearer token callers.
+	AuthMethod = "jwt"
+)
+
+func Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("jwt", pflag.ExitOnError)
+	fs.String(jwtJWKSFlag, "", "path or url of the jwks used to verify tokens")
+	fs.Duration(jwtJWKSRefreshFlag, time.Hour, "how often the jwks is reloaded")
+	fs.String(jwtHMACSecretFlag, "", "shared secret for HS256 tokens, used when no jwks is set")
+	fs.String(jwtIssuerFlag, "", "required iss claim")
+	fs.String(jwtAudienceFlag, "", "required aud claim")
+	fs.Duration(jwtLeewayFlag, 30*time.Second, "allowed clock skew for exp and nbf")
+	fs.Bool(jwtAllowNoExpFlag, false, "accept tokens without an exp claim, they never expire")
+	fs.Bool(jwtShowErrFlag, false, "return error in http response(not secure)")
+	return fs
+}
+
+// Middleware authenticates "Authorization: Bearer" tokens and stores the caller as an
+// auth.Principal. The principal is then checked with the same AuthFunctions the cookie
+// middleware uses; requests without a token are checked as an anonymous caller.
+type Middleware struct {
+	Validator     *Validator
+	Response      *response.Response
+	authFunctions auth.AuthFunctions
+}
+
+func NewFromFlags(authFunctions auth.AuthFunctions) (*Middleware, error) {
+	var keys KeyProvider
+	switch {
+	case viper.GetString(jwtJWKSFlag) != "":
+		keys = NewJWKS(viper.GetString(jwtJWKSFlag), viper.GetDuration(jwtJWKSRefreshFlag))
+	case viper.GetString(jwtHMACSecretFlag) != "":
+		keys = NewKeySet(NewHMACKey("", []byte(viper.GetString(jwtHMACSecretFlag))))
+	default:
+		return nil, fmt.Errorf("%s or %s is required", jwtJWKSFlag, jwtHMACSecretFlag)
+	}
+	validator := NewValidator(keys, viper.GetString(jwtIssuerFlag), viper.GetString(jwtAudienceFlag), viper.GetDuration(jwtLeewayFlag))
+	validator.AllowMissingExpiry = viper.GetBool(jwtAllowNoExpFlag)
+	return New(validator, viper.GetBool(jwtShowErrFlag), authFunctions), nil
+}
+
+func New(validator *Validator, showError bool, authFunctions auth.AuthFunctions) *Middleware {
+	return &Middleware{
+		Validator:     validator,
+		Response:      response.NewResponse(showError),
+		authFunctions: authFunctions,
+	}
+}
+
+func (m *Middleware) AuthMiddleware(next http.Handler) http.Handler {
+	return auth.NewChain(m.Response, m.authFunctions, m.Authenticator()).Middleware(next)
+}
+
+// Authenticator returns the auth.Authenticator for "Authorization: Bearer" tokens.
+func (m *Middleware) Authenticator() auth.Authenticator {
+	return auth.AuthenticatorFunc(func(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
+		token, found := BearerToken(r)
+		if !found {
+			return r, auth.ErrNoCredentials
+		}
+		claims, err := m.Validator.Parse(r.Context(), token)
+		if err != nil {
+			ctxLogger.Warn(r.Context(), "invalid bearer token", zap.Error(err))
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			return r, auth.Unauthorized("invalid token")
+		}
+		return auth.SetPrincipal(r, PrincipalFromClaims(claims)), nil
+	})
+}
+
+// BearerToken returns the token of an "Authorization: Bearer" header.
+func BearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+// PrincipalFromClaims maps sub, key, device_id, roles and scope onto a Principal.
+func PrincipalFromClaims(claims *Claims) *auth.Principal {
+	return &auth.Principal{
+		ID:       claims.Subject,
+		Key:      claims.Key,
+		DeviceID: claims.DeviceID,
+		Method:   AuthMethod,
+		Roles:    claims.Roles,
+		Scopes:   claims.Scopes(),
+		Claims:   claims.Extra,
+	}
+}
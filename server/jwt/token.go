@@ -0,0 +1,353 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed        = errors.New("malformed token")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrUnsupportedAlg   = errors.New("unsupported token algorithm")
+	ErrExpired          = errors.New("token is expired")
+	ErrMissingExpiry    = errors.New("token has no exp claim")
+	ErrNotYetValid      = errors.New("token is not valid yet")
+	ErrInvalidIssuer    = errors.New("invalid token issuer")
+	ErrInvalidAudience  = errors.New("invalid token audience")
+)
+
+// Audience is the aud claim, which may be a single string or a list.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a Audience) Contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// Claims are the registered claims plus the roles, scope and key used for endpoint permissions.
+// Unknown claims are kept in Extra.
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	Key       string   `json:"key,omitempty"`
+	DeviceID  string   `json:"device_id,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+
+	Extra map[string]interface{} `json:"-"`
+}
+
+var registeredClaims = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti", "key", "device_id", "roles", "scope"}
+
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	type plain Claims
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+	var all map[string]interface{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	for _, k := range registeredClaims {
+		delete(all, k)
+	}
+	if len(all) > 0 {
+		c.Extra = all
+	}
+	return nil
+}
+
+func (c Claims) MarshalJSON() ([]byte, error) {
+	type plain Claims
+	b, err := json.Marshal(plain(c))
+	if err != nil || len(c.Extra) == 0 {
+		return b, err
+	}
+	all := map[string]interface{}{}
+	for k, v := range c.Extra {
+		all[k] = v
+	}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, err
+	}
+	return json.Marshal(all)
+}
+
+// Scopes splits the space separated scope claim.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Sign encodes claims as a compact JWS signed with key.
+func Sign(key *Key, claims *Claims) (string, error) {
+	h, err := json.Marshal(header{Alg: key.Algorithm, Kid: key.ID, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	sig, err := sign(key, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func sign(key *Key, input []byte) ([]byte, error) {
+	switch key.Algorithm {
+	case HS256:
+		if len(key.Secret) == 0 {
+			return nil, fmt.Errorf("hmac key %q has no secret", key.ID)
+		}
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	case RS256:
+		priv, ok := key.PrivateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("key %q has no rsa private key", key.ID)
+		}
+		digest := sha256.Sum256(input)
+		return rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+	case ES256:
+		priv, ok := key.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("key %q has no ecdsa private key", key.ID)
+		}
+		digest := sha256.Sum256(input)
+		r, s, err := ecdsa.Sign(rand.Reader, priv, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlg, key.Algorithm)
+	}
+}
+
+func verify(key *Key, alg string, input, sig []byte) error {
+	// the key decides the algorithm, so a token cannot downgrade RS256 to HS256 with the public key
+	if alg != key.Algorithm {
+		return fmt.Errorf("%w: token uses %s, key %q is %s", ErrUnsupportedAlg, alg, key.ID, key.Algorithm)
+	}
+	digest := sha256.Sum256(input)
+	switch alg {
+	case HS256:
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write(input)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrInvalidSignature
+		}
+	case RS256:
+		pub, ok := key.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key %q has no rsa public key", key.ID)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			return ErrInvalidSignature
+		}
+	case ES256:
+		pub, ok := key.PublicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key %q has no ecdsa public key", key.ID)
+		}
+		if len(sig) != 64 {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedAlg, alg)
+	}
+	return nil
+}
+
+// Validator verifies token signatures against a KeyProvider and checks exp, nbf, iss and aud.
+// Tokens without exp never expire, so they are rejected unless AllowMissingExpiry is set.
+type Validator struct {
+	Keys               KeyProvider
+	Issuer             string
+	Audience           string
+	Leeway             time.Duration
+	AllowMissingExpiry bool
+	now                func() time.Time
+}
+
+func NewValidator(keys KeyProvider, issuer, audience string, leeway time.Duration) *Validator {
+	return &Validator{
+		Keys:     keys,
+		Issuer:   issuer,
+		Audience: audience,
+		Leeway:   leeway,
+		now:      time.Now,
+	}
+}
+
+// Parse verifies the token and returns its claims.
+func (v *Validator) Parse(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	key, err := v.Keys.Key(ctx, h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(key, h.Alg, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := v.validate(&claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+func (v *Validator) validate(c *Claims) error {
+	now := time.Now()
+	if v.now != nil {
+		now = v.now()
+	}
+	if c.ExpiresAt > 0 && now.After(time.Unix(c.ExpiresAt, 0).Add(v.Leeway)) {
+		return ErrExpired
+	}
+	if c.NotBefore > 0 && now.Add(v.Leeway).Before(time.Unix(c.NotBefore, 0)) {
+		return ErrNotYetValid
+	}
+	if v.Issuer != "" && c.Issuer != v.Issuer {
+		return ErrInvalidIssuer
+	}
+	if v.Audience != "" && !c.Audience.Contains(v.Audience) {
+		return ErrInvalidAudience
+	}
+	if c.ExpiresAt == 0 && !v.AllowMissingExpiry {
+		return ErrMissingExpiry
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrMalformed
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return nil
+}
+
+// Issuer creates signed tokens with the registered claims filled in.
+type Issuer struct {
+	Key      *Key
+	Issuer   string
+	Audience Audience
+	TTL      time.Duration
+}
+
+func NewIssuer(key *Key, issuer string, ttl time.Duration, audience ...string) *Issuer {
+	return &Issuer{
+		Key:      key,
+		Issuer:   issuer,
+		Audience: audience,
+		TTL:      ttl,
+	}
+}
+
+// Issue signs a token for subject. Fields already set on claims are kept, except sub.
+func (i *Issuer) Issue(subject string, claims *Claims) (string, error) {
+	if claims == nil {
+		claims = &Claims{}
+	}
+	c := *claims
+	now := time.Now()
+	c.Subject = subject
+	if c.Issuer == "" {
+		c.Issuer = i.Issuer
+	}
+	if len(c.Audience) == 0 {
+		c.Audience = i.Audience
+	}
+	if c.IssuedAt == 0 {
+		c.IssuedAt = now.Unix()
+	}
+	if c.ExpiresAt == 0 && i.TTL > 0 {
+		c.ExpiresAt = now.Add(i.TTL).Unix()
+	}
+	if c.ID == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		c.ID = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return Sign(i.Key, &c)
+}
@@ -0,0 +1,185 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+)
+
+// Phases of a HookResult.
+const (
+	PhaseStart = "start"
+	PhaseStop  = "stop"
+)
+
+// Hook is a named step of starting or stopping a service.
+type Hook struct {
+	Name    string
+	Timeout time.Duration
+	Fn      func(ctx context.Context) error
+}
+
+// HookResult reports how a hook ran.
+type HookResult struct {
+	Name     string        `json:"name"`
+	Phase    string        `json:"phase"`
+	Duration time.Duration `json:"duration"`
+	Error    error         `json:"-"`
+	TimedOut bool          `json:"timed_out"`
+}
+
+// Manager runs OnStart hooks in the order they were added and OnStop hooks in reverse order,
+// like defers, so something started early, such as a database, stops after what depends on it.
+// Every hook gets its own timeout; a hook that overruns is abandoned and the next one runs.
+type Manager struct {
+	DefaultTimeout time.Duration
+
+	mu      sync.Mutex
+	start   []Hook
+	stop    []Hook
+	stopped bool
+	results []HookResult
+}
+
+func New(defaultTimeout time.Duration) *Manager {
+	return &Manager{DefaultTimeout: defaultTimeout}
+}
+
+// OnStart adds a hook run before the server accepts requests. A timeout of 0 uses DefaultTimeout.
+func (m *Manager) OnStart(name string, timeout time.Duration, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.start = append(m.start, Hook{Name: name, Timeout: timeout, Fn: fn})
+}
+
+// OnStop adds a hook run after the server stopped accepting requests. A timeout of 0 uses
+// DefaultTimeout.
+func (m *Manager) OnStop(name string, timeout time.Duration, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stop = append(m.stop, Hook{Name: name, Timeout: timeout, Fn: fn})
+}
+
+// Start runs the start hooks and stops at the first failure.
+func (m *Manager) Start(ctx context.Context) ([]HookResult, error) {
+	m.mu.Lock()
+	hooks := append([]Hook(nil), m.start...)
+	m.mu.Unlock()
+	var results []HookResult
+	for _, h := range hooks {
+		result := m.run(ctx, PhaseStart, h)
+		results = append(results, result)
+		m.record(result)
+		if result.Error != nil {
+			return results, fmt.Errorf("failed starting %s: %w", h.Name, result.Error)
+		}
+	}
+	return results, nil
+}
+
+// Stop runs every stop hook once, even when some fail, and returns their joined errors. Later
+// calls do nothing.
+func (m *Manager) Stop(ctx context.Context) ([]HookResult, error) {
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return nil, nil
+	}
+	m.stopped = true
+	hooks := append([]Hook(nil), m.stop...)
+	m.mu.Unlock()
+
+	var results []HookResult
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		result := m.run(ctx, PhaseStop, hooks[i])
+		results = append(results, result)
+		m.record(result)
+		if result.Error != nil {
+			errs = append(errs, fmt.Errorf("failed stopping %s: %w", hooks[i].Name, result.Error))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+func (m *Manager) record(result HookResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results = append(m.results, result)
+}
+
+// Results returns how every hook run so far went, in the order they ran.
+func (m *Manager) Results() []HookResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]HookResult(nil), m.results...)
+}
+
+func (m *Manager) run(ctx context.Context, phase string, h Hook) HookResult {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = m.DefaultTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- h.Fn(ctx)
+	}()
+	result := HookResult{Name: h.Name, Phase: phase}
+	select {
+	case result.Error = <-done:
+	case <-ctx.Done():
+		result.Error = ctx.Err()
+		result.TimedOut = true
+	}
+	result.Duration = time.Since(start)
+
+	fields := []zap.Field{zap.String("hook", h.Name), zap.String("phase", phase), zap.Duration("duration", result.Duration)}
+	if result.Error != nil {
+		ctxLogger.Error(ctx, "lifecycle hook failed", append(fields, zap.Bool("timed_out", result.TimedOut), zap.Error(result.Error))...)
+	} else {
+		ctxLogger.Info(ctx, "lifecycle hook finished", fields...)
+	}
+	return result
+}
+
+// Closer adapts an io.Closer, e.g. a ps.PubSub, to a hook function.
+func Closer(c io.Closer) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return c.Close()
+	}
+}
+
+// FlushOTel flushes the global tracer and meter providers when they support it.
+func FlushOTel(ctx context.Context) error {
+	type flusher interface {
+		ForceFlush(ctx context.Context) error
+	}
+	var errs []error
+	if p, ok := otel.GetTracerProvider().(flusher); ok {
+		errs = append(errs, p.ForceFlush(ctx))
+	}
+	if p, ok := otel.GetMeterProvider().(flusher); ok {
+		errs = append(errs, p.ForceFlush(ctx))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,69 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager(t *testing.T) {
+	m := New(time.Second)
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, name)
+	}
+	hook := func(name string, err error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			record(name)
+			return err
+		}
+	}
+	m.OnStart("db", 0, hook("start db", nil))
+	m.OnStart("consumer", 0, hook("start consumer", nil))
+	m.OnStop("db", 0, hook("stop db", nil))
+	m.OnStop("pubsub", 0, hook("stop pubsub", errors.New("already closed")))
+	m.OnStop("consumer", 20*time.Millisecond, func(ctx context.Context) error {
+		record("stop consumer")
+		<-time.After(time.Second)
+		return nil
+	})
+
+	_, err := m.Start(context.Background())
+	require.NoError(t, err)
+
+	start := time.Now()
+	results, err := m.Stop(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "overrunning hooks are abandoned")
+	assert.ErrorContains(t, err, "failed stopping pubsub")
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"start db", "start consumer", "stop consumer", "stop pubsub", "stop db"}, order)
+	require.Len(t, results, 3)
+	assert.True(t, results[0].TimedOut)
+	assert.Len(t, m.Results(), 5)
+
+	results, err = m.Stop(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, results, "stop hooks run once")
+}
+
+func TestManager_StartFailure(t *testing.T) {
+	m := New(time.Second)
+	ran := false
+	m.OnStart("migrate", 0, func(ctx context.Context) error { panic("boom") })
+	m.OnStart("next", 0, func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	_, err := m.Start(context.Background())
+	assert.ErrorContains(t, err, "failed starting migrate: panic: boom")
+	assert.False(t, ran)
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+)
+
+// Networks a Listener can bind.
+const (
+	NetworkTCP  = "tcp"
+	NetworkUnix = "unix"
+)
+
+// Listener is an additional address the server accepts requests on, e.g. an internal port or a
+// unix socket for a sidecar proxy. Every listener is shut down together with the server.
+type Listener struct {
+	Name    string
+	Network string
+	// Address is ":port" for tcp and the socket path for unix.
+	Address string
+	// Handler defaults to the server router.
+	Handler http.Handler
+	// TLSConfig serves https; it is not inherited from the server.
+	TLSConfig *tls.Config
+	// H2C serves HTTP/2 without TLS, for proxies that speak prior knowledge h2c.
+	H2C bool
+	// SocketMode is applied to the unix socket file when set.
+	SocketMode os.FileMode
+	// SocketCleanup removes a stale socket file before binding and the socket on shutdown.
+	SocketCleanup bool
+	// ReadHeaderTimeout limits how long reading the request headers may take, 0 means no limit.
+	ReadHeaderTimeout time.Duration
+}
+
+// AddListener serves on l in addition to the serving port once the server starts.
+func (s *Server) AddListener(l *Listener) {
+	s.listeners = append(s.listeners, l)
+}
+
+func (l *Listener) listen() (net.Listener, error) {
+	network := l.Network
+	if network == "" {
+		network = NetworkTCP
+	}
+	if network != NetworkUnix {
+		return net.Listen(network, l.Address)
+	}
+	if l.SocketCleanup {
+		if info, err := os.Lstat(l.Address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(l.Address); err != nil {
+				return nil, fmt.Errorf("failed removing stale socket: %w", err)
+			}
+		}
+	}
+	ln, err := net.Listen(NetworkUnix, l.Address)
+	if err != nil {
+		return nil, err
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(l.SocketCleanup)
+	if l.SocketMode != 0 {
+		if err := os.Chmod(l.Address, l.SocketMode); err != nil {
+			_ = ln.Close()
+			return nil, fmt.Errorf("failed setting socket mode: %w", err)
+		}
+	}
+	return ln, nil
+}
+
+type boundServer struct {
+	name     string
+	server   *http.Server
+	listener net.Listener
+}
+
+// bind listens on the serving port and every added listener. Nothing is left bound when one of
+// them fails.
+func (s *Server) bind(ctx context.Context, main *http.Server) ([]*boundServer, error) {
+	listeners := append([]*Listener{{
+		Name:      "public",
+		Address:   main.Addr,
+		Handler:   main.Handler,
+		TLSConfig: main.TLSConfig,
+		H2C:       s.H2C,
+	}}, s.listeners...)
+	if s.UnixSocket != "" {
+		listeners = append(listeners, &Listener{
+			Name:          "unix",
+			Network:       NetworkUnix,
+			Address:       s.UnixSocket,
+			Handler:       main.Handler,
+			H2C:           s.H2C,
+			SocketMode:    s.UnixSocketMode,
+			SocketCleanup: s.UnixSocketCleanup,
+		})
+	}
+
+	var bound []*boundServer
+	for i, l := range listeners {
+		ln, err := l.listen()
+		if err != nil {
+			for _, b := range bound {
+				_ = b.listener.Close()
+			}
+			return nil, fmt.Errorf("failed listening on %s %s: %w", l.Name, l.Address, err)
+		}
+		server := main
+		if i > 0 {
+			server = &http.Server{
+				Addr:              l.Address,
+				TLSConfig:         l.TLSConfig,
+				BaseContext:       main.BaseContext,
+				ReadHeaderTimeout: l.ReadHeaderTimeout,
+			}
+		}
+		handler := l.Handler
+		if handler == nil {
+			handler = s.router
+		}
+		if l.H2C && l.TLSConfig == nil {
+			handler = h2c.NewHandler(handler, &http2.Server{})
+		}
+		server.Handler = handler
+		bound = append(bound, &boundServer{name: l.Name, server: server, listener: ln})
+	}
+	return bound, nil
+}
+
+func (b *boundServer) serve(ctx context.Context) {
+	var err error
+	if b.server.TLSConfig != nil {
+		err = b.server.ServeTLS(b.listener, "", "")
+	} else {
+		err = b.server.Serve(b.listener)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		ctxLogger.Error(ctx, "failed serving", zap.String("listener", b.name), zap.Error(err))
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+
+	"github.com/Seann-Moser/go-serve/server/tlsconfig"
+)
+
+func TestServer_Listeners(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewServer(ctx, "0", "", 1024, false, time.Second)
+	s.router.HandleFunc("/proto", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	})
+	s.H2C = true
+	s.UnixSocket = filepath.Join(t.TempDir(), "app.sock")
+	s.UnixSocketMode = 0o600
+	s.UnixSocketCleanup = true
+	require.NoError(t, os.WriteFile(s.UnixSocket, nil, 0o600))
+
+	_, err := s.bind(ctx, &http.Server{Addr: "127.0.0.1:0", Handler: s.router})
+	require.Error(t, err, "regular files are not removed as stale sockets")
+	require.NoError(t, os.Remove(s.UnixSocket))
+
+	bound, err := s.bind(ctx, &http.Server{Addr: "127.0.0.1:0", Handler: s.router})
+	require.NoError(t, err)
+	require.Len(t, bound, 2)
+	for _, b := range bound {
+		go b.serve(ctx)
+	}
+	info, err := os.Stat(s.UnixSocket)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	h2cClient := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	assert.Equal(t, "HTTP/2.0", get(t, h2cClient, "http://"+bound[0].listener.Addr().String()+"/proto"))
+
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, NetworkUnix, s.UnixSocket)
+		},
+	}}
+	assert.Equal(t, "HTTP/1.1", get(t, unixClient, "http://unix/proto"))
+
+	for _, b := range bound {
+		require.NoError(t, b.server.Shutdown(ctx))
+	}
+	_, err = os.Stat(s.UnixSocket)
+	assert.True(t, os.IsNotExist(err), "the socket is removed on shutdown")
+}
+
+func TestServer_TLSRedirectListener(t *testing.T) {
+	ctx := context.Background()
+	s := NewServer(ctx, "8443", "", 1024, false, time.Second)
+	s.AddTLS(&tlsconfig.TLS{RedirectPort: "0"})
+
+	bound, err := s.bind(ctx, &http.Server{Addr: "127.0.0.1:0", Handler: s.router})
+	require.NoError(t, err)
+	require.Len(t, bound, 2)
+	redirect := bound[1]
+	assert.Equal(t, "https-redirect", redirect.name)
+	go redirect.serve(ctx)
+	defer func() {
+		_ = bound[0].listener.Close()
+		require.NoError(t, redirect.server.Shutdown(ctx))
+	}()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	r, err := http.NewRequest(http.MethodGet, "http://"+redirect.listener.Addr().String()+"/items?id=1", nil)
+	require.NoError(t, err)
+	r.Host = "example.com"
+	resp, err := client.Do(r)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal(t, "https://example.com:8443/items?id=1", resp.Header.Get("Location"))
+}
+
+func get(t *testing.T, c *http.Client, url string) string {
+	resp, err := c.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b := make([]byte, 64)
+	n, _ := resp.Body.Read(b)
+	return string(b[:n])
+}
@@ -0,0 +1,263 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/response"
+	"github.com/Seann-Moser/go-serve/server/device"
+)
+
+const (
+	lockoutMaxAttemptsFlag   = "lockout-max-attempts"
+	lockoutMaxIPAttemptsFlag = "lockout-max-ip-attempts"
+	lockoutWindowFlag        = "lockout-window"
+	lockoutDurationFlag      = "lockout-duration"
+	lockoutDelayAfterFlag    = "lockout-delay-after"
+	lockoutBaseDelayFlag     = "lockout-base-delay"
+	lockoutMaxDelayFlag      = "lockout-max-delay"
+	lockoutShowErrFlag       = "lockout-show-err"
+)
+
+// Kinds of keys failures are counted under.
+const (
+	KindPrincipal = "principal"
+	KindDevice    = "device"
+	KindIP        = "ip"
+)
+
+// ErrLocked is wrapped by *LockedError.
+var ErrLocked = errors.New("too many failed attempts")
+
+// LockedError is returned while a principal, device or ip is locked out or delayed.
+type LockedError struct {
+	Kind       string
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s: %s locked for %s", ErrLocked, e.Kind, e.RetryAfter)
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrLocked
+}
+
+// Event describes a lockout, passed to Tracker.OnLockout.
+type Event struct {
+	Kind     string
+	Key      string
+	Attempts int
+	Until    time.Time
+}
+
+func Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("lockout", pflag.ExitOnError)
+	fs.Int(lockoutMaxAttemptsFlag, 5, "failed attempts per principal or device before a lockout")
+	fs.Int(lockoutMaxIPAttemptsFlag, 50, "failed attempts per ip before a lockout")
+	fs.Duration(lockoutWindowFlag, 15*time.Minute, "window failed attempts are counted in")
+	fs.Duration(lockoutDurationFlag, 15*time.Minute, "length of a lockout")
+	fs.Int(lockoutDelayAfterFlag, 3, "failed attempts before progressive delays start, 0 disables delays")
+	fs.Duration(lockoutBaseDelayFlag, time.Second, "first delay, doubled with every further failure")
+	fs.Duration(lockoutMaxDelayFlag, 30*time.Second, "longest delay between attempts")
+	fs.Bool(lockoutShowErrFlag, false, "return error in http response(not secure)")
+	fs.AddFlagSet(device.Flags())
+	return fs
+}
+
+// Tracker counts failed login attempts per principal id, device key and ip. After DelayAfter
+// failures every further attempt has to wait a doubling delay, and after MaxAttempts (MaxIPAttempts
+// for ips) the key is locked for LockoutDuration. Login handlers call Check before verifying
+// credentials and report the outcome with Failure or Success.
+type Tracker struct {
+	Store           Store
+	MaxAttempts     int
+	MaxIPAttempts   int
+	Window          time.Duration
+	LockoutDuration time.Duration
+	DelayAfter      int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	Response        *response.Response
+	// Proxies resolves the client ip from forwarding headers. When nil the connection address is
+	// used, so configure it behind a load balancer or every caller shares the balancer ip.
+	Proxies *device.TrustedProxies
+	// OnLockout is called when a key gets locked out.
+	OnLockout func(ctx context.Context, e Event)
+}
+
+// NewFromFlags also reads the trusted proxies from the device flags.
+func NewFromFlags(store Store) (*Tracker, error) {
+	proxies, err := device.TrustedProxiesFromFlags()
+	if err != nil {
+		return nil, err
+	}
+	t := New(store, viper.GetBool(lockoutShowErrFlag))
+	t.Proxies = proxies
+	t.MaxAttempts = viper.GetInt(lockoutMaxAttemptsFlag)
+	t.MaxIPAttempts = viper.GetInt(lockoutMaxIPAttemptsFlag)
+	t.Window = viper.GetDuration(lockoutWindowFlag)
+	t.LockoutDuration = viper.GetDuration(lockoutDurationFlag)
+	t.DelayAfter = viper.GetInt(lockoutDelayAfterFlag)
+	t.BaseDelay = viper.GetDuration(lockoutBaseDelayFlag)
+	t.MaxDelay = viper.GetDuration(lockoutMaxDelayFlag)
+	return t, nil
+}
+
+func New(store Store, showError bool) *Tracker {
+	return &Tracker{
+		Store:           store,
+		MaxAttempts:     5,
+		MaxIPAttempts:   50,
+		Window:          15 * time.Minute,
+		LockoutDuration: 15 * time.Minute,
+		DelayAfter:      3,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		Response:        response.NewResponse(showError),
+	}
+}
+
+type key struct {
+	kind  string
+	value string
+}
+
+func (k key) String() string {
+	return k.kind + ":" + k.value
+}
+
+// keys returns the keys a login attempt for principalID from r counts against. principalID is
+// the submitted user name or id and may be empty. The device key is derived from the client ip
+// and user agent, so a caller can always change it; the principal and ip keys are the ones an
+// attacker cannot shed.
+func (t *Tracker) keys(r *http.Request, principalID string) []key {
+	ip := t.Proxies.ClientIP(r)
+	d := &device.Device{IPv4: ip, UserAgent: r.UserAgent()}
+	output := []key{{kind: KindDevice, value: d.GenerateDeviceKey("")}}
+	if principalID != "" {
+		output = append(output, key{kind: KindPrincipal, value: principalID})
+	}
+	if ip != "" {
+		output = append(output, key{kind: KindIP, value: ip})
+	}
+	return output
+}
+
+// Check returns a *LockedError when any key of the attempt is locked or still delayed.
+func (t *Tracker) Check(r *http.Request, principalID string) error {
+	var locked *LockedError
+	for _, k := range t.keys(r, principalID) {
+		remaining, err := t.Store.LockedFor(r.Context(), k.String())
+		if err != nil {
+			return fmt.Errorf("failed checking lockout: %w", err)
+		}
+		if remaining > 0 && (locked == nil || remaining > locked.RetryAfter) {
+			locked = &LockedError{Kind: k.kind, RetryAfter: remaining}
+		}
+	}
+	if locked != nil {
+		return locked
+	}
+	return nil
+}
+
+// Failure records a failed attempt and returns a *LockedError when the failure delays or locks
+// further attempts.
+func (t *Tracker) Failure(r *http.Request, principalID string) error {
+	var locked *LockedError
+	for _, k := range t.keys(r, principalID) {
+		attempts, err := t.Store.Increment(r.Context(), k.String(), t.Window)
+		if err != nil {
+			return fmt.Errorf("failed recording login failure: %w", err)
+		}
+		wait := t.wait(k.kind, attempts)
+		if wait <= 0 {
+			continue
+		}
+		if err := t.Store.Lock(r.Context(), k.String(), wait); err != nil {
+			return fmt.Errorf("failed locking %s: %w", k.kind, err)
+		}
+		if limit := t.limit(k.kind); limit > 0 && attempts >= limit {
+			ctxLogger.Warn(r.Context(), "login locked out", zap.String("kind", k.kind), zap.Int("attempts", attempts))
+			if t.OnLockout != nil {
+				t.OnLockout(r.Context(), Event{Kind: k.kind, Key: k.value, Attempts: attempts, Until: time.Now().Add(wait)})
+			}
+		}
+		if locked == nil || wait > locked.RetryAfter {
+			locked = &LockedError{Kind: k.kind, RetryAfter: wait}
+		}
+	}
+	if locked != nil {
+		return locked
+	}
+	return nil
+}
+
+// Success clears the failures of the principal and device. The ip count is left to expire, so
+// an attacker who owns one account cannot reset it.
+func (t *Tracker) Success(r *http.Request, principalID string) error {
+	for _, k := range t.keys(r, principalID) {
+		if k.kind == KindIP {
+			continue
+		}
+		if err := t.Store.Reset(r.Context(), k.String()); err != nil {
+			return fmt.Errorf("failed resetting login failures: %w", err)
+		}
+	}
+	return nil
+}
+
+func (t *Tracker) limit(kind string) int {
+	if kind == KindIP {
+		return t.MaxIPAttempts
+	}
+	return t.MaxAttempts
+}
+
+// wait returns how long a key has to wait after its attempts-th failure.
+func (t *Tracker) wait(kind string, attempts int) time.Duration {
+	if limit := t.limit(kind); limit > 0 && attempts >= limit {
+		return t.LockoutDuration
+	}
+	if kind == KindIP || t.DelayAfter <= 0 || attempts < t.DelayAfter {
+		return 0
+	}
+	delay := time.Duration(float64(t.BaseDelay) * math.Pow(2, float64(attempts-t.DelayAfter)))
+	if t.MaxDelay > 0 && (delay > t.MaxDelay || delay <= 0) {
+		delay = t.MaxDelay
+	}
+	return delay
+}
+
+// Locked checks the attempt and, when it is locked, writes 429 with Retry-After and returns
+// true. Errors of the store are logged and let the attempt through.
+func (t *Tracker) Locked(w http.ResponseWriter, r *http.Request, principalID string) bool {
+	err := t.Check(r, principalID)
+	if err == nil {
+		return false
+	}
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		ctxLogger.Error(r.Context(), "failed checking lockout", zap.Error(err))
+		return false
+	}
+	t.WriteLocked(w, r, locked)
+	return true
+}
+
+// WriteLocked responds 429 with the Retry-After of locked.
+func (t *Tracker) WriteLocked(w http.ResponseWriter, r *http.Request, locked *LockedError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+	t.Response.Error(r, w, locked, http.StatusTooManyRequests, "too many failed attempts, try again later")
+}
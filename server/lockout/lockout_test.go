@@ -0,0 +1,95 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func request(ip string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+	r.RemoteAddr = ip + ":1234"
+	return r
+}
+
+func TestTracker_ProgressiveDelayAndLockout(t *testing.T) {
+	store := NewInMemoryStore()
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+	tracker := New(store, false)
+	tracker.MaxAttempts = 4
+	tracker.DelayAfter = 2
+	tracker.BaseDelay = time.Second
+	var events []Event
+	tracker.OnLockout = func(ctx context.Context, e Event) {
+		events = append(events, e)
+	}
+
+	r := request("10.0.0.1")
+	assert.NoError(t, tracker.Failure(r, "user-1"))
+
+	var locked *LockedError
+	require.True(t, errors.As(tracker.Failure(r, "user-1"), &locked))
+	assert.Equal(t, time.Second, locked.RetryAfter)
+	assert.ErrorIs(t, tracker.Check(r, "user-1"), ErrLocked)
+
+	now = now.Add(time.Second)
+	require.NoError(t, tracker.Check(r, "user-1"))
+	require.True(t, errors.As(tracker.Failure(r, "user-1"), &locked))
+	assert.Equal(t, 2*time.Second, locked.RetryAfter, "delays double")
+
+	now = now.Add(2 * time.Second)
+	require.True(t, errors.As(tracker.Failure(r, "user-1"), &locked))
+	assert.Equal(t, tracker.LockoutDuration, locked.RetryAfter)
+	require.NotEmpty(t, events)
+	assert.Equal(t, 4, events[0].Attempts)
+
+	// the principal stays locked from other devices and ips
+	assert.ErrorIs(t, tracker.Check(request("10.0.0.2"), "user-1"), ErrLocked)
+	assert.NoError(t, tracker.Check(request("10.0.0.2"), "user-2"))
+
+	w := httptest.NewRecorder()
+	assert.True(t, tracker.Locked(w, r, "user-1"))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "900", w.Header().Get("Retry-After"))
+
+	now = now.Add(tracker.LockoutDuration)
+	assert.NoError(t, tracker.Check(r, "user-1"))
+}
+
+func TestTracker_SuccessResetsPrincipalNotIP(t *testing.T) {
+	tracker := New(NewInMemoryStore(), false)
+	tracker.MaxIPAttempts = 3
+	tracker.DelayAfter = 0
+
+	assert.NoError(t, tracker.Failure(request("10.0.0.1"), "user-1"))
+	assert.NoError(t, tracker.Failure(request("10.0.0.1"), "user-2"))
+	require.NoError(t, tracker.Success(request("10.0.0.1"), "user-1"))
+
+	var locked *LockedError
+	require.True(t, errors.As(tracker.Failure(request("10.0.0.1"), "user-3"), &locked))
+	assert.Equal(t, KindIP, locked.Kind)
+}
+
+func TestTracker_SpoofedForwardedForSharesIP(t *testing.T) {
+	tracker := New(NewInMemoryStore(), false)
+	tracker.MaxIPAttempts = 2
+	tracker.MaxAttempts = 0
+	tracker.DelayAfter = 0
+
+	for _, spoofed := range []string{"1.1.1.1", "2.2.2.2"} {
+		r := request("10.0.0.1")
+		r.Header.Set("X-Forwarded-For", spoofed)
+		r.Header.Set("User-Agent", spoofed)
+		_ = tracker.Failure(r, "")
+	}
+	var locked *LockedError
+	require.True(t, errors.As(tracker.Check(request("10.0.0.1"), ""), &locked))
+	assert.Equal(t, KindIP, locked.Kind)
+}
@@ -0,0 +1,19 @@
+package lockout
+
+import (
+	"context"
+	"time"
+)
+
+// Store counts failures and holds locks per key.
+type Store interface {
+	// Increment adds a failure to key and returns the failures since the first one, counted
+	// for window from the first failure.
+	Increment(ctx context.Context, key string, window time.Duration) (int, error)
+	// Lock blocks key for d.
+	Lock(ctx context.Context, key string, d time.Duration) error
+	// LockedFor returns how long key stays locked, 0 when it is not.
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	// Reset clears the failures and lock of key.
+	Reset(ctx context.Context, key string) error
+}
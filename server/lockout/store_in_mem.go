@@ -0,0 +1,89 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var _ Store = &InMemoryStore{}
+
+type entry struct {
+	attempts    int
+	expires     time.Time
+	lockedUntil time.Time
+}
+
+// InMemoryStore keeps counters in a map. It is meant for tests and single instance services.
+type InMemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	now     func() time.Time
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		entries: map[string]*entry{},
+		now:     time.Now,
+	}
+}
+
+func (m *InMemoryStore) get(key string, now time.Time) *entry {
+	e, found := m.entries[key]
+	if !found {
+		return nil
+	}
+	if now.After(e.expires) && now.After(e.lockedUntil) {
+		delete(m.entries, key)
+		return nil
+	}
+	return e
+}
+
+func (m *InMemoryStore) Increment(ctx context.Context, key string, window time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	e := m.get(key, now)
+	if e == nil {
+		e = &entry{}
+		m.entries[key] = e
+	}
+	if now.After(e.expires) {
+		e.attempts = 0
+		e.expires = now.Add(window)
+	}
+	e.attempts++
+	return e.attempts, nil
+}
+
+func (m *InMemoryStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	e := m.get(key, now)
+	if e == nil {
+		e = &entry{}
+		m.entries[key] = e
+	}
+	e.lockedUntil = now.Add(d)
+	return nil
+}
+
+func (m *InMemoryStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	e := m.get(key, now)
+	if e == nil || !e.lockedUntil.After(now) {
+		return 0, nil
+	}
+	return e.lockedUntil.Sub(now), nil
+}
+
+func (m *InMemoryStore) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
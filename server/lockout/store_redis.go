@@ -0,0 +1,76 @@
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var _ Store = &RedisStore{}
+
+// incrementScript starts the window with the first failure, so later failures do not extend it.
+var incrementScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// RedisStore keeps a counter and a lock key per key, both expiring on their own, so every
+// instance behind a load balancer shares the same counts.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "lockout"
+	}
+	return &RedisStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (r *RedisStore) countKey(key string) string {
+	return fmt.Sprintf("%s:count:%s", r.prefix, key)
+}
+
+func (r *RedisStore) lockKey(key string) string {
+	return fmt.Sprintf("%s:lock:%s", r.prefix, key)
+}
+
+func (r *RedisStore) Increment(ctx context.Context, key string, window time.Duration) (int, error) {
+	count, err := incrementScript.Run(ctx, r.client, []string{r.countKey(key)}, window.Milliseconds()).Int()
+	if err != nil {
+		return 0, fmt.Errorf("failed incrementing login failures: %w", err)
+	}
+	return count, nil
+}
+
+func (r *RedisStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	if err := r.client.Set(ctx, r.lockKey(key), 1, d).Err(); err != nil {
+		return fmt.Errorf("failed storing lockout: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.client.PTTL(ctx, r.lockKey(key)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed loading lockout: %w", err)
+	}
+	if ttl < 0 {
+		// -2 is a missing key and -1 a key without expiry, neither is set by Lock
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (r *RedisStore) Reset(ctx context.Context, key string) error {
+	return r.client.Del(ctx, r.countKey(key), r.lockKey(key)).Err()
+}
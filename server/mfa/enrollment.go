@@ -0,0 +1,48 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var ErrNotFound = errors.New("mfa enrollment not found")
+
+// Enrollment is the second factor of a user. Secret has to be kept in the clear to compute
+// codes, so the table should be protected like other credentials. RecoveryCodes holds comma
+// separated hashes of the unused recovery codes.
+type Enrollment struct {
+	UserID        string `db:"user_id" json:"user_id" qc:"primary;data_type::varchar(256);where::="`
+	Secret        string `db:"secret" json:"-" qc:"data_type::varchar(128);update"`
+	ConfirmedAt   int64  `db:"confirmed_at" json:"confirmed_at" qc:"data_type::bigint;update"`
+	LastCounter   int64  `db:"last_counter" json:"-" qc:"data_type::bigint;update"`
+	RecoveryCodes string `db:"recovery_codes" json:"-" qc:"data_type::text;update"`
+	CreatedAt     int64  `db:"created_at" json:"created_at" qc:"data_type::bigint;update"`
+}
+
+// Confirmed reports whether the user proved the authenticator works. Unconfirmed enrollments
+// are not enforced at login.
+func (e *Enrollment) Confirmed() bool {
+	return e.ConfirmedAt > 0
+}
+
+func (e *Enrollment) recoveryCodes() []string {
+	if e.RecoveryCodes == "" {
+		return nil
+	}
+	return strings.Split(e.RecoveryCodes, ",")
+}
+
+// Store persists enrollments. Get returns ErrNotFound for users without one.
+type Store interface {
+	Create(ctx context.Context, e *Enrollment) error
+	Get(ctx context.Context, userID string) (*Enrollment, error)
+	Update(ctx context.Context, e *Enrollment) error
+	Delete(ctx context.Context, userID string) error
+	// AdvanceCounter sets LastCounter to counter if it is below it, and returns ErrNotFound
+	// otherwise, so a TOTP code is used once even by concurrent requests.
+	AdvanceCounter(ctx context.Context, userID string, counter int64) error
+	// ReplaceRecoveryCodes sets RecoveryCodes to codes if they still are current, and returns
+	// ErrNotFound otherwise, so a recovery code is used once even by concurrent requests.
+	ReplaceRecoveryCodes(ctx context.Context, userID, current, codes string) error
+}
@@ -0,0 +1,156 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/request"
+	"github.com/Seann-Moser/go-serve/server/auth"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+	"github.com/Seann-Moser/go-serve/server/lockout"
+)
+
+// EnrollRequest is the body of the enroll endpoint. Account is the label shown in the
+// authenticator app and defaults to the user id.
+type EnrollRequest struct {
+	Account string `json:"account"`
+}
+
+// CodeRequest carries a TOTP or recovery code.
+type CodeRequest struct {
+	Code string `json:"code"`
+}
+
+// Endpoints returns the enroll, confirm, verify and disable endpoints under prefix. They act on
+// the current principal, so they need an auth middleware in front of them. Disable requires a
+// recent step-up; verify is the only one a login waiting for its second factor can reach.
+func (m *Manager) Endpoints(prefix string) []*endpoints.Endpoint {
+	enroll := endpoints.NewEndpoint(prefix, "/mfa/enroll", "", m.EnrollHandler, http.MethodPost)
+	enroll.Description = "starts a totp enrollment, the secret and recovery codes are only returned once"
+	enroll.SetRequestType(EnrollRequest{}, http.MethodPost)
+	enroll.SetResponseType(EnrollResponse{})
+
+	confirm := endpoints.NewEndpoint(prefix, "/mfa/confirm", "", m.ConfirmHandler, http.MethodPost)
+	confirm.Description = "activates a totp enrollment with a code from the authenticator"
+	confirm.SetRequestType(CodeRequest{}, http.MethodPost)
+
+	verify := endpoints.NewEndpoint(prefix, "/mfa/verify", "", m.VerifyHandler, http.MethodPost)
+	verify.Description = "verifies a totp or recovery code and marks the login as step-up verified"
+	verify.SetRequestType(CodeRequest{}, http.MethodPost)
+	verify.AllowMFAPending = true
+
+	disable := endpoints.NewEndpoint(prefix, "/mfa", "", m.DisableHandler, http.MethodDelete)
+	disable.Description = "removes the totp enrollment"
+	disable.RequireMFA = true
+	return []*endpoints.Endpoint{enroll, confirm, verify, disable}
+}
+
+func (m *Manager) EnrollHandler(w http.ResponseWriter, r *http.Request) {
+	principal, found := auth.GetPrincipal(r.Context())
+	if !found || principal.ID == "" {
+		m.Response.Error(r, w, nil, http.StatusUnauthorized, "login required")
+		return
+	}
+	body, err := request.GetBody[EnrollRequest](r)
+	if err != nil {
+		body = &EnrollRequest{}
+	}
+	enrollment, err := m.Enroll(r.Context(), principal.ID, body.Account)
+	if errors.Is(err, ErrEnrolled) {
+		m.Response.Error(r, w, err, http.StatusConflict, "mfa is already enrolled")
+		return
+	}
+	if err != nil {
+		ctxLogger.Error(r.Context(), "failed enrolling mfa", zap.Error(err))
+		m.Response.Error(r, w, err, http.StatusInternalServerError, "failed enrolling mfa")
+		return
+	}
+	m.Response.DataResponse(r, w, enrollment, http.StatusCreated)
+}
+
+func (m *Manager) ConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	m.codeHandler(w, r, m.Confirm)
+}
+
+func (m *Manager) VerifyHandler(w http.ResponseWriter, r *http.Request) {
+	m.codeHandler(w, r, m.Verify)
+}
+
+func (m *Manager) codeHandler(w http.ResponseWriter, r *http.Request, check func(ctx context.Context, userID, code string) error) {
+	principal, found := auth.GetPrincipal(r.Context())
+	if !found || principal.ID == "" {
+		m.Response.Error(r, w, nil, http.StatusUnauthorized, "login required")
+		return
+	}
+	body, err := request.GetBody[CodeRequest](r)
+	if err != nil {
+		m.Response.Error(r, w, err, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if m.Lockout == nil {
+		// unthrottled, a six digit code falls to guessing
+		m.Response.Error(r, w, nil, http.StatusServiceUnavailable, "mfa lockout is not configured")
+		return
+	}
+	if m.Lockout.Locked(w, r, principal.ID) {
+		return
+	}
+	err = check(r.Context(), principal.ID, body.Code)
+	m.recordAttempt(r, principal.ID, err)
+	switch {
+	case errors.Is(err, ErrInvalidCode):
+		m.Response.Error(r, w, err, http.StatusUnauthorized, "invalid mfa code")
+		return
+	case errors.Is(err, ErrNotEnrolled):
+		m.Response.Error(r, w, err, http.StatusBadRequest, "mfa is not enrolled")
+		return
+	case err != nil:
+		ctxLogger.Error(r.Context(), "failed checking mfa code", zap.Error(err))
+		m.Response.Error(r, w, err, http.StatusInternalServerError, "failed checking mfa code")
+		return
+	}
+	if m.OnVerified != nil {
+		if err := m.OnVerified(w, r); err != nil {
+			ctxLogger.Error(r.Context(), "failed recording mfa verification", zap.Error(err))
+			m.Response.Error(r, w, err, http.StatusInternalServerError, "failed recording mfa verification")
+			return
+		}
+	}
+	m.Response.DataResponse(r, w, map[string]bool{"verified": true}, http.StatusOK)
+}
+
+func (m *Manager) DisableHandler(w http.ResponseWriter, r *http.Request) {
+	principal, found := auth.GetPrincipal(r.Context())
+	if !found || principal.ID == "" {
+		m.Response.Error(r, w, nil, http.StatusUnauthorized, "login required")
+		return
+	}
+	if err := m.Disable(r.Context(), principal.ID); err != nil {
+		m.Response.Error(r, w, err, http.StatusInternalServerError, "failed disabling mfa")
+		return
+	}
+	m.Response.DataResponse(r, w, map[string]bool{"enabled": false}, http.StatusOK)
+}
+
+// recordAttempt reports the outcome of a code check to the Lockout. A failure that locks the
+// principal is returned on the next attempt, this one still answers with the invalid code.
+func (m *Manager) recordAttempt(r *http.Request, userID string, err error) {
+	if m.Lockout == nil {
+		return
+	}
+	switch {
+	case err == nil:
+		err = m.Lockout.Success(r, userID)
+	case errors.Is(err, ErrInvalidCode):
+		err = m.Lockout.Failure(r, userID)
+	default:
+		return
+	}
+	if err != nil && !errors.Is(err, lockout.ErrLocked) {
+		ctxLogger.Error(r.Context(), "failed recording mfa attempt", zap.Error(err))
+	}
+}
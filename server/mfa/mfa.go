@@ -0,0 +1,267 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/Seann-Moser/go-serve/pkg/response"
+	"github.com/Seann-Moser/go-serve/server/auth"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+	"github.com/Seann-Moser/go-serve/server/lockout"
+)
+
+const (
+	mfaIssuerFlag        = "mfa-issuer"
+	mfaSkewFlag          = "mfa-skew"
+	mfaRecoveryCodesFlag = "mfa-recovery-codes"
+	mfaShowErrFlag       = "mfa-show-err"
+)
+
+var (
+	ErrInvalidCode = errors.New("invalid mfa code")
+	ErrNotEnrolled = errors.New("mfa is not enrolled")
+	ErrEnrolled    = errors.New("mfa is already enrolled")
+)
+
+func Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("mfa", pflag.ExitOnError)
+	fs.String(mfaIssuerFlag, "", "issuer shown in authenticator apps")
+	fs.Int(mfaSkewFlag, 1, "number of 30s time steps a code may be early or late")
+	fs.Int(mfaRecoveryCodesFlag, 10, "number of recovery codes generated on enrollment")
+	fs.Bool(mfaShowErrFlag, false, "return error in http response(not secure)")
+	return fs
+}
+
+// Manager enrolls and verifies TOTP second factors and guards endpoints that set
+// Endpoint.RequireMFA. A login becomes step-up verified when the verify endpoint accepts a code
+// and OnVerified records it, e.g. with session.Manager.MarkMFAVerified, so that later requests
+// carry auth.Principal.MFAVerifiedAt. Logins marked as waiting for their second factor, see
+// session.Manager.SetMFAPending and cookies.Cookies.SetMFAPending, only reach public endpoints
+// and endpoints that set AllowMFAPending, such as verify.
+type Manager struct {
+	Store         Store
+	Issuer        string
+	Skew          int
+	RecoveryCodes int
+	Response      *response.Response
+	// OnVerified is called after the verify endpoint accepted a code for the current principal.
+	OnVerified func(w http.ResponseWriter, r *http.Request) error
+	// Lockout throttles the confirm and verify endpoints. Wrong codes count as failed attempts
+	// of the principal, so guessing codes locks the account like guessing passwords does. The
+	// endpoints refuse to check codes without it.
+	Lockout *lockout.Tracker
+
+	required endpoints.RouteOptions[time.Duration]
+	pending  endpoints.RouteOptions[bool]
+}
+
+// NewFromFlags throttles codes with tracker, e.g. the lockout.Tracker of the login endpoint so
+// wrong passwords and wrong codes share one budget.
+func NewFromFlags(store Store, tracker *lockout.Tracker) *Manager {
+	m := New(store, tracker, viper.GetString(mfaIssuerFlag), viper.GetBool(mfaShowErrFlag))
+	m.Skew = viper.GetInt(mfaSkewFlag)
+	m.RecoveryCodes = viper.GetInt(mfaRecoveryCodesFlag)
+	return m
+}
+
+func New(store Store, tracker *lockout.Tracker, issuer string, showError bool) *Manager {
+	return &Manager{
+		Store:         store,
+		Lockout:       tracker,
+		Issuer:        issuer,
+		Skew:          1,
+		RecoveryCodes: 10,
+		Response:      response.NewResponse(showError),
+	}
+}
+
+// EnrollResponse is returned once when a user enrolls; the secret and recovery codes are not
+// retrievable afterwards.
+type EnrollResponse struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Enroll starts a new enrollment for userID, replacing an unconfirmed one. It fails when the
+// user already has a confirmed enrollment; Disable it first.
+func (m *Manager) Enroll(ctx context.Context, userID, account string) (*EnrollResponse, error) {
+	existing, err := m.Store.Get(ctx, userID)
+	switch {
+	case err == nil && existing.Confirmed():
+		return nil, ErrEnrolled
+	case err == nil:
+		if err := m.Store.Delete(ctx, userID); err != nil {
+			return nil, fmt.Errorf("failed removing unconfirmed mfa enrollment: %w", err)
+		}
+	case !errors.Is(err, ErrNotFound):
+		return nil, fmt.Errorf("failed loading mfa enrollment: %w", err)
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	codes, hashes, err := GenerateRecoveryCodes(m.RecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+	e := &Enrollment{
+		UserID:        userID,
+		Secret:        secret,
+		RecoveryCodes: strings.Join(hashes, ","),
+		CreatedAt:     time.Now().Unix(),
+	}
+	if err := m.Store.Create(ctx, e); err != nil {
+		return nil, fmt.Errorf("failed storing mfa enrollment: %w", err)
+	}
+	if account == "" {
+		account = userID
+	}
+	return &EnrollResponse{Secret: secret, URI: URI(m.Issuer, account, secret), RecoveryCodes: codes}, nil
+}
+
+// Confirm activates a pending enrollment once the user shows a code from the authenticator.
+func (m *Manager) Confirm(ctx context.Context, userID, code string) error {
+	e, err := m.enrollment(ctx, userID)
+	if err != nil {
+		return err
+	}
+	counter, ok := Validate(e.Secret, code, time.Now(), m.Skew)
+	if !ok {
+		return ErrInvalidCode
+	}
+	e.ConfirmedAt = time.Now().Unix()
+	e.LastCounter = counter
+	if err := m.Store.Update(ctx, e); err != nil {
+		return fmt.Errorf("failed confirming mfa enrollment: %w", err)
+	}
+	return nil
+}
+
+// Verify checks a TOTP code, or consumes a recovery code, for a confirmed enrollment. A TOTP
+// code is accepted once; replaying it, even within the skew window, fails.
+func (m *Manager) Verify(ctx context.Context, userID, code string) error {
+	e, err := m.enrollment(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !e.Confirmed() {
+		return ErrNotEnrolled
+	}
+	if counter, ok := Validate(e.Secret, code, time.Now(), m.Skew); ok {
+		if counter <= e.LastCounter {
+			return ErrInvalidCode
+		}
+		// the store only moves the counter forward, so of concurrent replays only one passes
+		err = m.Store.AdvanceCounter(ctx, userID, counter)
+	} else {
+		hashes := e.recoveryCodes()
+		i := matchRecoveryCode(hashes, code)
+		if i < 0 {
+			return ErrInvalidCode
+		}
+		remaining := strings.Join(append(hashes[:i], hashes[i+1:]...), ",")
+		err = m.Store.ReplaceRecoveryCodes(ctx, userID, e.RecoveryCodes, remaining)
+	}
+	if errors.Is(err, ErrNotFound) {
+		return ErrInvalidCode
+	}
+	if err != nil {
+		return fmt.Errorf("failed updating mfa enrollment: %w", err)
+	}
+	return nil
+}
+
+// Enrolled reports whether userID has a confirmed enrollment, i.e. whether a login needs a
+// second factor before step-up endpoints are reachable.
+func (m *Manager) Enrolled(ctx context.Context, userID string) (bool, error) {
+	e, err := m.Store.Get(ctx, userID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed loading mfa enrollment: %w", err)
+	}
+	return e.Confirmed(), nil
+}
+
+// Disable removes the enrollment of userID.
+func (m *Manager) Disable(ctx context.Context, userID string) error {
+	return m.Store.Delete(ctx, userID)
+}
+
+func (m *Manager) enrollment(ctx context.Context, userID string) (*Enrollment, error) {
+	e, err := m.Store.Get(ctx, userID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrNotEnrolled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed loading mfa enrollment: %w", err)
+	}
+	return e, nil
+}
+
+// Register records the endpoints that set RequireMFA and the endpoints a login waiting for its
+// second factor may reach. Endpoints that were not registered reject such logins.
+func (m *Manager) Register(eps ...*endpoints.Endpoint) {
+	for _, e := range eps {
+		if e == nil {
+			continue
+		}
+		if e.RequireMFA {
+			m.required.Set(e.URLPath, e.MFAMaxAge)
+		}
+		if e.Public || e.AllowMFAPending {
+			m.pending.Set(e.URLPath, true)
+		}
+	}
+}
+
+// Middleware rejects requests of logins that still owe their second factor or whose mfa state
+// cannot be trusted, such as cookies without signature verification, and requests to
+// RequireMFA endpoints unless the principal passed a second factor, within MFAMaxAge of now
+// when the endpoint sets it, with 403. It must run after the auth middleware that sets the
+// principal.
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if principal, found := auth.GetPrincipal(r.Context()); found && !m.allowsPending(r) {
+			switch {
+			case principal.MFAUntrusted:
+				// e.g. unsigned cookies, whose pending or verified state the caller controls
+				m.Response.Error(r, w, nil, http.StatusForbidden, "mfa state of the login cannot be verified")
+				return
+			case principal.MFAPending:
+				m.Response.Error(r, w, nil, http.StatusForbidden, "mfa verification required")
+				return
+			}
+		}
+		maxAge, required := m.routeMaxAge(r)
+		if !required {
+			next.ServeHTTP(w, r)
+			return
+		}
+		principal, _ := auth.GetPrincipal(r.Context())
+		if !principal.MFASatisfied(maxAge, time.Now()) {
+			m.Response.Error(r, w, nil, http.StatusForbidden, "mfa step-up required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (m *Manager) routeMaxAge(r *http.Request) (time.Duration, bool) {
+	return m.required.Get(r)
+}
+
+func (m *Manager) allowsPending(r *http.Request) bool {
+	allowed, _ := m.pending.Get(r)
+	return allowed
+}
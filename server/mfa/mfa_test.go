@@ -0,0 +1,192 @@
+package mfa
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Seann-Moser/go-serve/server/auth"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+	"github.com/Seann-Moser/go-serve/server/lockout"
+)
+
+func TestCode_RFC6238(t *testing.T) {
+	// RFC 6238 appendix B secret "12345678901234567890", truncated to 6 digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	tcs := []struct {
+		Time     int64
+		Expected string
+	}{
+		{Time: 59, Expected: "287082"},
+		{Time: 1111111109, Expected: "081804"},
+		{Time: 2000000000, Expected: "279037"},
+	}
+	for _, tc := range tcs {
+		code, err := Code(secret, Counter(time.Unix(tc.Time, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, tc.Expected, code)
+	}
+
+	_, ok := Validate(secret, "287082", time.Unix(59+30, 0), 1)
+	assert.True(t, ok, "one step late is within skew")
+	_, ok = Validate(secret, "287082", time.Unix(59+60, 0), 1)
+	assert.False(t, ok, "two steps late is outside skew")
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("Acme", "jo@example.com", "ABC"))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/Acme:jo@example.com", u.Path)
+	assert.Equal(t, "ABC", u.Query().Get("secret"))
+	assert.Equal(t, "Acme", u.Query().Get("issuer"))
+}
+
+func TestManager_EnrollAndVerify(t *testing.T) {
+	ctx := context.Background()
+	m := New(NewInMemoryStore(), lockout.New(lockout.NewInMemoryStore(), false), "Acme", false)
+	m.RecoveryCodes = 2
+
+	enrollment, err := m.Enroll(ctx, "user-1", "")
+	require.NoError(t, err)
+	assert.Len(t, enrollment.RecoveryCodes, 2)
+	assert.ErrorIs(t, m.Verify(ctx, "user-1", enrollment.RecoveryCodes[0]), ErrNotEnrolled, "unconfirmed enrollments do not verify")
+
+	now := time.Now()
+	code, err := Code(enrollment.Secret, Counter(now)-1)
+	require.NoError(t, err)
+	require.NoError(t, m.Confirm(ctx, "user-1", code))
+	enrolled, err := m.Enrolled(ctx, "user-1")
+	require.NoError(t, err)
+	assert.True(t, enrolled)
+	_, err = m.Enroll(ctx, "user-1", "")
+	assert.ErrorIs(t, err, ErrEnrolled)
+
+	assert.ErrorIs(t, m.Verify(ctx, "user-1", code), ErrInvalidCode, "codes are single use")
+	code, err = Code(enrollment.Secret, Counter(now))
+	require.NoError(t, err)
+	assert.NoError(t, m.Verify(ctx, "user-1", code))
+
+	assert.NoError(t, m.Verify(ctx, "user-1", enrollment.RecoveryCodes[1]))
+	assert.ErrorIs(t, m.Verify(ctx, "user-1", enrollment.RecoveryCodes[1]), ErrInvalidCode, "recovery codes are single use")
+	assert.ErrorIs(t, m.Verify(ctx, "user-1", "000000"), ErrInvalidCode)
+}
+
+func TestManager_StepUp(t *testing.T) {
+	m := New(NewInMemoryStore(), nil, "", false)
+	handler := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	open := endpoints.NewEndpoint("/", "/open", "", handler, http.MethodGet)
+	sensitive := endpoints.NewEndpoint("/", "/sensitive", "", handler, http.MethodGet)
+	sensitive.RequireMFA = true
+	sensitive.MFAMaxAge = 5 * time.Minute
+	public := endpoints.NewEndpoint("/", "/public", "", handler, http.MethodGet)
+	public.Public = true
+	verify := endpoints.NewEndpoint("/", "/verify", "", handler, http.MethodGet)
+	verify.AllowMFAPending = true
+	m.Register(open, sensitive, public, verify)
+
+	tcs := []struct {
+		Name      string
+		Path      string
+		Principal *auth.Principal
+		Expected  int
+	}{
+		{Name: "open endpoint", Path: "/open", Principal: &auth.Principal{ID: "u"}, Expected: http.StatusOK},
+		{Name: "no second factor", Path: "/sensitive", Principal: &auth.Principal{ID: "u"}, Expected: http.StatusForbidden},
+		{Name: "anonymous", Path: "/sensitive", Expected: http.StatusForbidden},
+		{Name: "recent second factor", Path: "/sensitive", Principal: &auth.Principal{ID: "u", MFAVerifiedAt: time.Now()}, Expected: http.StatusOK},
+		{Name: "stale second factor", Path: "/sensitive", Principal: &auth.Principal{ID: "u", MFAVerifiedAt: time.Now().Add(-time.Hour)}, Expected: http.StatusForbidden},
+		{Name: "pending login", Path: "/open", Principal: &auth.Principal{ID: "u", MFAPending: true}, Expected: http.StatusForbidden},
+		{Name: "pending login on public endpoint", Path: "/public", Principal: &auth.Principal{ID: "u", MFAPending: true}, Expected: http.StatusOK},
+		{Name: "pending login on verify", Path: "/verify", Principal: &auth.Principal{ID: "u", MFAPending: true}, Expected: http.StatusOK},
+		{Name: "pending login on unregistered endpoint", Path: "/other", Principal: &auth.Principal{ID: "u", MFAPending: true}, Expected: http.StatusForbidden},
+		{Name: "untrusted mfa state", Path: "/open", Principal: &auth.Principal{ID: "u", MFAUntrusted: true}, Expected: http.StatusForbidden},
+		{Name: "untrusted mfa state on public endpoint", Path: "/public", Principal: &auth.Principal{ID: "u", MFAUntrusted: true}, Expected: http.StatusOK},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.Name, func(t *testing.T) {
+			router := mux.NewRouter()
+			router.Use(m.Middleware)
+			router.HandleFunc(open.URLPath, handler)
+			router.HandleFunc(sensitive.URLPath, handler)
+			router.HandleFunc(public.URLPath, handler)
+			router.HandleFunc(verify.URLPath, handler)
+			router.HandleFunc("/other", handler)
+			r := httptest.NewRequest(http.MethodGet, tc.Path, nil)
+			if tc.Principal != nil {
+				r = auth.SetPrincipal(r, tc.Principal)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			assert.Equal(t, tc.Expected, w.Code)
+		})
+	}
+}
+
+func TestManager_VerifyLockout(t *testing.T) {
+	ctx := context.Background()
+	m := New(NewInMemoryStore(), lockout.New(lockout.NewInMemoryStore(), false), "", false)
+	m.Lockout.MaxAttempts = 2
+	m.Lockout.DelayAfter = 0
+	enrollment, err := m.Enroll(ctx, "user-1", "")
+	require.NoError(t, err)
+	code, err := Code(enrollment.Secret, Counter(time.Now())-1)
+	require.NoError(t, err)
+	require.NoError(t, m.Confirm(ctx, "user-1", code))
+
+	verify := func(code string) int {
+		r := httptest.NewRequest(http.MethodPost, "/mfa/verify", strings.NewReader(`{"code":"`+code+`"}`))
+		r = auth.SetPrincipal(r, &auth.Principal{ID: "user-1"})
+		w := httptest.NewRecorder()
+		m.VerifyHandler(w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, verify("000000"))
+	assert.Equal(t, http.StatusUnauthorized, verify("000001"))
+	code, err = Code(enrollment.Secret, Counter(time.Now()))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, verify(code), "a locked principal cannot verify, even with a valid code")
+
+	m.Lockout = nil
+	assert.Equal(t, http.StatusServiceUnavailable, verify(code), "codes are not checked without a lockout")
+}
+
+func TestManager_ConcurrentReplay(t *testing.T) {
+	ctx := context.Background()
+	m := New(NewInMemoryStore(), lockout.New(lockout.NewInMemoryStore(), false), "", false)
+	m.RecoveryCodes = 1
+	enrollment, err := m.Enroll(ctx, "user-1", "")
+	require.NoError(t, err)
+	code, err := Code(enrollment.Secret, Counter(time.Now())-1)
+	require.NoError(t, err)
+	require.NoError(t, m.Confirm(ctx, "user-1", code))
+	code, err = Code(enrollment.Secret, Counter(time.Now()))
+	require.NoError(t, err)
+
+	for _, code := range []string{code, enrollment.RecoveryCodes[0]} {
+		var wg sync.WaitGroup
+		var passed atomic.Int64
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if m.Verify(ctx, "user-1", code) == nil {
+					passed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int64(1), passed.Load(), "a code passes once, even when replayed concurrently")
+	}
+}
@@ -0,0 +1,86 @@
+package mfa
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Seann-Moser/QueryHelper"
+
+	"github.com/Seann-Moser/go-serve/pkg/db"
+)
+
+var _ Store = &DAOStore{}
+
+// DAOStore keeps enrollments in a QueryHelper table registered on a db.DAO.
+type DAOStore struct {
+	dao   *db.DAO
+	table *QueryHelper.Table[Enrollment]
+}
+
+// NewDAOStore registers the enrollment table on the dao and returns a Store backed by it.
+func NewDAOStore(ctx context.Context, dao *db.DAO, dataset string) (*DAOStore, error) {
+	tableCtx, err := db.AddTable[Enrollment](ctx, dao, dataset, QueryHelper.QueryTypeSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed adding mfa enrollment table: %w", err)
+	}
+	table, err := QueryHelper.GetTableCtx[Enrollment](tableCtx)
+	if err != nil {
+		return nil, err
+	}
+	return &DAOStore{dao: dao, table: table}, nil
+}
+
+func (d *DAOStore) Create(ctx context.Context, e *Enrollment) error {
+	if _, err := d.table.Insert(ctx, nil, *e); err != nil {
+		return fmt.Errorf("failed inserting mfa enrollment: %w", err)
+	}
+	return nil
+}
+
+func (d *DAOStore) Get(ctx context.Context, userID string) (*Enrollment, error) {
+	q := QueryHelper.QueryTable[Enrollment](d.table)
+	enrollments, err := q.Where(q.Column("user_id"), "=", "AND", 0, userID).Run(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading mfa enrollment: %w", err)
+	}
+	if len(enrollments) == 0 {
+		return nil, ErrNotFound
+	}
+	return enrollments[0], nil
+}
+
+func (d *DAOStore) Update(ctx context.Context, e *Enrollment) error {
+	return d.table.Update(ctx, nil, *e)
+}
+
+func (d *DAOStore) AdvanceCounter(ctx context.Context, userID string, counter int64) error {
+	return d.updateOne(ctx,
+		fmt.Sprintf("UPDATE %s SET last_counter = :counter WHERE user_id = :user_id AND last_counter < :counter", d.table.FullTableName()),
+		map[string]interface{}{"user_id": userID, "counter": counter})
+}
+
+func (d *DAOStore) ReplaceRecoveryCodes(ctx context.Context, userID, current, codes string) error {
+	return d.updateOne(ctx,
+		fmt.Sprintf("UPDATE %s SET recovery_codes = :codes WHERE user_id = :user_id AND recovery_codes = :current", d.table.FullTableName()),
+		map[string]interface{}{"user_id": userID, "current": current, "codes": codes})
+}
+
+// updateOne runs a conditional update and returns ErrNotFound when it matched no row.
+func (d *DAOStore) updateOne(ctx context.Context, query string, arg map[string]interface{}) error {
+	result, err := d.dao.NamedExecResult(ctx, query, arg)
+	if err != nil {
+		return fmt.Errorf("failed updating mfa enrollment: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed updating mfa enrollment: %w", err)
+	} else if n != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (d *DAOStore) Delete(ctx context.Context, userID string) error {
+	return d.table.NamedExec(ctx, nil,
+		fmt.Sprintf("DELETE FROM %s WHERE user_id = :user_id", d.table.FullTableName()),
+		map[string]interface{}{"user_id": userID})
+}
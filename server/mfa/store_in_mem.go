@@ -0,0 +1,79 @@
+package mfa
+
+import (
+	"context"
+	"sync"
+)
+
+var _ Store = &InMemoryStore{}
+
+// InMemoryStore keeps enrollments in a map. It is meant for tests and single instance services.
+type InMemoryStore struct {
+	mu          sync.Mutex
+	enrollments map[string]*Enrollment
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		enrollments: map[string]*Enrollment{},
+	}
+}
+
+func (m *InMemoryStore) Create(ctx context.Context, e *Enrollment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := *e
+	m.enrollments[e.UserID] = &c
+	return nil
+}
+
+func (m *InMemoryStore) Get(ctx context.Context, userID string) (*Enrollment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, found := m.enrollments[userID]
+	if !found {
+		return nil, ErrNotFound
+	}
+	c := *e
+	return &c, nil
+}
+
+func (m *InMemoryStore) Update(ctx context.Context, e *Enrollment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, found := m.enrollments[e.UserID]; !found {
+		return ErrNotFound
+	}
+	c := *e
+	m.enrollments[e.UserID] = &c
+	return nil
+}
+
+func (m *InMemoryStore) AdvanceCounter(ctx context.Context, userID string, counter int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, found := m.enrollments[userID]
+	if !found || e.LastCounter >= counter {
+		return ErrNotFound
+	}
+	e.LastCounter = counter
+	return nil
+}
+
+func (m *InMemoryStore) ReplaceRecoveryCodes(ctx context.Context, userID, current, codes string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, found := m.enrollments[userID]
+	if !found || e.RecoveryCodes != current {
+		return ErrNotFound
+	}
+	e.RecoveryCodes = codes
+	return nil
+}
+
+func (m *InMemoryStore) Delete(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.enrollments, userID)
+	return nil
+}
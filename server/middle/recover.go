@@ -0,0 +1,103 @@
+package middle
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/metrics"
+	"github.com/Seann-Moser/go-serve/pkg/response"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+var (
+	panicCounterOnce sync.Once
+	panicCounter     metric.Int64Counter
+)
+
+func recordPanicMetric(r *http.Request) {
+	panicCounterOnce.Do(func() {
+		counter, err := otel.Meter("server-recovery").Int64Counter(
+			"server.panics",
+			metric.WithDescription("Number of panics recovered in handlers."),
+			metric.WithUnit("{panic}"),
+		)
+		if err != nil {
+			ctxLogger.Warn(r.Context(), "failed creating panic counter", zap.Error(err))
+			return
+		}
+		panicCounter = counter
+	})
+	if panicCounter != nil {
+		panicCounter.Add(r.Context(), 1, metric.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", getRoute(r)),
+		))
+	}
+}
+
+// getRoute returns the route template so metrics do not get a series per id.
+func getRoute(r *http.Request) string {
+	if tmpl, found := endpoints.RouteTemplate(r); found {
+		return tmpl
+	}
+	return r.URL.Path
+}
+
+// Recoverer turns handler panics into a logged, traced and counted 500 response instead of a
+// dropped connection.
+type Recoverer struct {
+	Response *response.Response
+}
+
+func NewRecoverer(resp *response.Response) *Recoverer {
+	if resp == nil {
+		resp = response.NewResponse(false)
+	}
+	return &Recoverer{Response: resp}
+}
+
+func (rc *Recoverer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := metrics.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				// the sentinel net/http uses to abort a response on purpose
+				panic(recovered)
+			}
+			err, ok := recovered.(error)
+			if !ok {
+				err = fmt.Errorf("%v", recovered)
+			}
+			stack := debug.Stack()
+			ctxLogger.Error(r.Context(), "recovered panic in handler",
+				zap.Error(err),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.ByteString("stack", stack),
+			)
+			span := trace.SpanFromContext(r.Context())
+			span.RecordError(err, trace.WithAttributes(attribute.String("exception.stacktrace", string(stack))))
+			span.SetStatus(codes.Error, "panic")
+			recordPanicMetric(r)
+
+			if ww.Status() == 0 {
+				rc.Response.Error(r, ww, nil, http.StatusInternalServerError, "internal server error")
+			}
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
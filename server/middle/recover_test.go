@@ -0,0 +1,45 @@
+package middle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoverer_Middleware(t *testing.T) {
+	rc := NewRecoverer(nil)
+
+	t.Run("panic before write returns 500", func(t *testing.T) {
+		handler := rc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))
+		rec := httptest.NewRecorder()
+		assert.NotPanics(t, func() {
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x", nil))
+		})
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Contains(t, rec.Body.String(), "internal server error")
+	})
+
+	t.Run("panic after write keeps status", func(t *testing.T) {
+		handler := rc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			panic(assert.AnError)
+		}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x", nil))
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Empty(t, rec.Body.String())
+	})
+
+	t.Run("abort handler is re-raised", func(t *testing.T) {
+		handler := rc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}))
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/x", nil))
+		})
+	})
+}
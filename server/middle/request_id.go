@@ -0,0 +1,22 @@
+package middle
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/requestid"
+)
+
+// RequestID accepts the caller's X-Request-ID, or generates one, and attaches it to the request
+// context, the context logger and the response header.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestid.FromRequest(r)
+		w.Header().Set(requestid.Header, id)
+		ctx := requestid.WithID(r.Context(), id)
+		ctx = ctxLogger.With(ctx, zap.String("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
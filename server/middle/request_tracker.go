@@ -36,6 +36,11 @@ func (rt *RequestTracker) TrackMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// InFlight returns the number of requests being served.
+func (rt *RequestTracker) InFlight() int64 {
+	return rt.inFlight.Load()
+}
+
 func (rt *RequestTracker) Done(ctx context.Context) <-chan struct{} {
 	go func() {
 		ticker := time.NewTicker(200 * time.Millisecond)
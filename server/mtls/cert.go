@@ -0,0 +1,66 @@
+package mtls
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// CertInfo is the verified client certificate of a request.
+type CertInfo struct {
+	Subject     string    `json:"subject"`
+	CommonName  string    `json:"common_name"`
+	Issuer      string    `json:"issuer"`
+	Serial      string    `json:"serial"`
+	SPIFFEID    string    `json:"spiffe_id,omitempty"`
+	DNSNames    []string  `json:"dns_names,omitempty"`
+	URIs        []string  `json:"uris,omitempty"`
+	Emails      []string  `json:"emails,omitempty"`
+	NotAfter    time.Time `json:"not_after"`
+	Fingerprint string    `json:"fingerprint"`
+}
+
+func NewCertInfo(cert *x509.Certificate) *CertInfo {
+	sum := sha256.Sum256(cert.Raw)
+	info := &CertInfo{
+		Subject:     cert.Subject.String(),
+		CommonName:  cert.Subject.CommonName,
+		Issuer:      cert.Issuer.String(),
+		Serial:      cert.SerialNumber.String(),
+		DNSNames:    cert.DNSNames,
+		Emails:      cert.EmailAddresses,
+		NotAfter:    cert.NotAfter,
+		Fingerprint: hex.EncodeToString(sum[:]),
+	}
+	for _, u := range cert.URIs {
+		info.URIs = append(info.URIs, u.String())
+		if u.Scheme == "spiffe" && info.SPIFFEID == "" {
+			info.SPIFFEID = u.String()
+		}
+	}
+	return info
+}
+
+// PeerCertInfo returns the leaf of the verified client chain of r. Certificates the handshake
+// did not verify, e.g. with tls.RequestClientCert, are ignored.
+func PeerCertInfo(r *http.Request) (*CertInfo, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	return NewCertInfo(r.TLS.VerifiedChains[0][0]), true
+}
+
+type contextKey struct{}
+
+func WithCertInfo(ctx context.Context, info *CertInfo) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// CertInfoFromContext returns the client certificate stored by MTLS.Middleware.
+func CertInfoFromContext(ctx context.Context) (*CertInfo, bool) {
+	info, ok := ctx.Value(contextKey{}).(*CertInfo)
+	return info, ok && info != nil
+}
@@ -0,0 +1,202 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/response"
+	"github.com/Seann-Moser/go-serve/server/auth"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+const (
+	mtlsClientCAFilesFlag = "mtls-client-ca-files"
+	mtlsClientAuthFlag    = "mtls-client-auth"
+	mtlsRulesFileFlag     = "mtls-rules-file"
+	mtlsShowErrFlag       = "mtls-show-err"
+
+	// AuthMethod is the Principal.Method set for client certificate callers.
+	AuthMethod = "mtls"
+)
+
+// Client verification modes accepted by the mtls-client-auth flag.
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+func Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("mtls", pflag.ExitOnError)
+	fs.StringSlice(mtlsClientCAFilesFlag, nil, "pem bundles of the CAs client certificates must chain to")
+	fs.String(mtlsClientAuthFlag, ClientAuthOptional, "client certificate verification: none, optional or require")
+	fs.String(mtlsRulesFileFlag, "", "json file of rules mapping certificates to principals")
+	fs.Bool(mtlsShowErrFlag, false, "return error in http response(not secure)")
+	return fs
+}
+
+// MTLS verifies client certificates during the TLS handshake and maps them to principals.
+// Without Rules a certificate maps to its SPIFFE ID, or its common name when it has none; with
+// Rules the first matching rule decides and unmatched certificates are rejected.
+//
+// With ClientAuthOptional endpoints can still demand a certificate by setting
+// Endpoint.RequireClientCert.
+type MTLS struct {
+	ClientCAs  *x509.CertPool
+	ClientAuth tls.ClientAuthType
+	Rules      []Rule
+	Response   *response.Response
+
+	required endpoints.RouteOptions[bool]
+}
+
+func NewFromFlags() (*MTLS, error) {
+	pool, err := LoadCAs(viper.GetStringSlice(mtlsClientCAFilesFlag)...)
+	if err != nil {
+		return nil, err
+	}
+	clientAuth, err := ParseClientAuth(viper.GetString(mtlsClientAuthFlag))
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if file := viper.GetString(mtlsRulesFileFlag); file != "" {
+		if rules, err = LoadRules(file); err != nil {
+			return nil, err
+		}
+	}
+	return New(pool, clientAuth, rules, viper.GetBool(mtlsShowErrFlag)), nil
+}
+
+func New(clientCAs *x509.CertPool, clientAuth tls.ClientAuthType, rules []Rule, showError bool) *MTLS {
+	return &MTLS{
+		ClientCAs:  clientCAs,
+		ClientAuth: clientAuth,
+		Rules:      rules,
+		Response:   response.NewResponse(showError),
+	}
+}
+
+// ParseClientAuth converts a mtls-client-auth value.
+func ParseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case ClientAuthNone, "":
+		return tls.NoClientCert, nil
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("unknown client auth mode %q", mode)
+}
+
+// LoadCAs reads pem bundles into a pool.
+func LoadCAs(files ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading client ca bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in client ca bundle %s", file)
+		}
+	}
+	return pool, nil
+}
+
+// TLSConfig returns a copy of base, or a new config, verifying client certificates.
+func (m *MTLS) TLSConfig(base *tls.Config) *tls.Config {
+	var config *tls.Config
+	if base != nil {
+		config = base.Clone()
+	} else {
+		config = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	config.ClientCAs = m.ClientCAs
+	config.ClientAuth = m.ClientAuth
+	return config
+}
+
+// Map returns the principal of a certificate, false when no rule matches.
+func (m *MTLS) Map(info *CertInfo) (*auth.Principal, bool) {
+	if len(m.Rules) == 0 {
+		id := info.SPIFFEID
+		if id == "" {
+			id = info.CommonName
+		}
+		return &auth.Principal{ID: id, Key: info.Fingerprint, Method: AuthMethod}, id != ""
+	}
+	for _, rule := range m.Rules {
+		value, found := rule.Match(info)
+		if !found {
+			continue
+		}
+		id := rule.PrincipalID
+		if id == "" {
+			id = value
+		}
+		return &auth.Principal{ID: id, Key: info.Fingerprint, Method: AuthMethod, Roles: rule.Roles}, true
+	}
+	return nil, false
+}
+
+// Register records the endpoints that set RequireClientCert.
+func (m *MTLS) Register(eps ...*endpoints.Endpoint) {
+	for _, e := range eps {
+		if e != nil && e.RequireClientCert {
+			m.required.Set(e.URLPath, true)
+		}
+	}
+}
+
+// Middleware stores the client certificate in the request context and the request logger, and
+// rejects requests without one to endpoints that set RequireClientCert.
+func (m *MTLS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, found := PeerCertInfo(r)
+		if !found {
+			if m.routeRequired(r) {
+				m.Response.Error(r, w, nil, http.StatusUnauthorized, "client certificate required")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := ctxLogger.With(WithCertInfo(r.Context(), info),
+			zap.String("client_cert_subject", info.Subject),
+			zap.String("client_cert_serial", info.Serial),
+			zap.String("client_cert_spiffe_id", info.SPIFFEID),
+		)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Authenticator returns the auth.Authenticator for client certificates.
+func (m *MTLS) Authenticator() auth.Authenticator {
+	return auth.AuthenticatorFunc(func(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
+		info, found := PeerCertInfo(r)
+		if !found {
+			return r, auth.ErrNoCredentials
+		}
+		principal, found := m.Map(info)
+		if !found {
+			ctxLogger.Warn(r.Context(), "client certificate did not match any rule", zap.String("subject", info.Subject))
+			return r, auth.Unauthorized("client certificate is not allowed")
+		}
+		return auth.SetPrincipal(r.WithContext(WithCertInfo(r.Context(), info)), principal), nil
+	})
+}
+
+func (m *MTLS) routeRequired(r *http.Request) bool {
+	required, _ := m.required.Get(r)
+	return required
+}
@@ -0,0 +1,149 @@
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Seann-Moser/go-serve/server/auth"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, cn string, uris ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, u := range uris {
+		parsed, err := url.Parse(u)
+		require.NoError(t, err)
+		tmpl.URIs = append(tmpl.URIs, parsed)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestMTLS_Map(t *testing.T) {
+	info := &CertInfo{CommonName: "billing", SPIFFEID: "spiffe://corp/ns/prod/sa/billing", DNSNames: []string{"billing.internal"}}
+	m := New(nil, tls.VerifyClientCertIfGiven, nil, false)
+	principal, found := m.Map(info)
+	require.True(t, found)
+	assert.Equal(t, "spiffe://corp/ns/prod/sa/billing", principal.ID)
+
+	m.Rules = []Rule{
+		{Field: FieldDNS, Pattern: "*.external", PrincipalID: "partner"},
+		{Field: FieldSPIFFE, Pattern: "spiffe://corp/ns/*/sa/billing", PrincipalID: "billing-svc", Roles: []string{"billing"}},
+	}
+	principal, found = m.Map(info)
+	require.True(t, found)
+	assert.Equal(t, "billing-svc", principal.ID)
+	assert.Equal(t, []string{"billing"}, principal.Roles)
+
+	_, found = m.Map(&CertInfo{CommonName: "other"})
+	assert.False(t, found)
+}
+
+func TestMTLS_Handshake(t *testing.T) {
+	ca := newTestCA(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	m := New(pool, tls.VerifyClientCertIfGiven, []Rule{{Field: FieldSPIFFE, Pattern: "spiffe://corp/*"}}, false)
+
+	var seen *auth.Principal
+	var seenCert *CertInfo
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = auth.GetPrincipal(r.Context())
+		seenCert, _ = CertInfoFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}
+	open := endpoints.NewEndpoint("/", "/open", "", handler, http.MethodGet)
+	service := endpoints.NewEndpoint("/", "/service", "", handler, http.MethodGet)
+	service.RequireClientCert = true
+	chain := auth.NewChain(nil, nil, m.Authenticator())
+	m.Register(open, service)
+	chain.Register(open, service)
+
+	router := mux.NewRouter()
+	router.Use(m.Middleware, chain.Middleware)
+	router.HandleFunc(open.URLPath, handler)
+	router.HandleFunc(service.URLPath, handler)
+	srv := httptest.NewUnstartedServer(router)
+	srv.TLS = m.TLSConfig(nil)
+	srv.StartTLS()
+	defer srv.Close()
+
+	client := func(certs ...tls.Certificate) *http.Client {
+		// a transport per client, so connections made with other certificates are not reused
+		transport := srv.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+		return &http.Client{Transport: transport}
+	}
+	get := func(c *http.Client, path string) int {
+		seen, seenCert = nil, nil
+		resp, err := c.Get(srv.URL + path)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, get(client(), "/open"))
+	assert.Equal(t, http.StatusUnauthorized, get(client(), "/service"))
+
+	trusted := client(ca.issue(t, "billing", "spiffe://corp/billing"))
+	assert.Equal(t, http.StatusOK, get(trusted, "/service"))
+	require.NotNil(t, seen)
+	assert.Equal(t, "spiffe://corp/billing", seen.ID)
+	assert.Equal(t, AuthMethod, seen.Method)
+	require.NotNil(t, seenCert)
+	assert.Equal(t, "billing", seenCert.CommonName)
+
+	unmapped := client(ca.issue(t, "intruder", "spiffe://other/intruder"))
+	assert.Equal(t, http.StatusUnauthorized, get(unmapped, "/service"))
+
+	_, err := client(newTestCA(t).issue(t, "untrusted")).Get(srv.URL + "/open")
+	assert.Error(t, err, "certificates from other CAs fail the handshake")
+}
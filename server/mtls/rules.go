@@ -0,0 +1,85 @@
+package mtls
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+)
+
+// Fields a Rule can match.
+const (
+	FieldSPIFFE     = "spiffe"
+	FieldURI        = "uri"
+	FieldDNS        = "dns"
+	FieldEmail      = "email"
+	FieldCommonName = "cn"
+)
+
+// Rule maps certificates to a principal. Pattern is a path.Match pattern against Field, e.g.
+// "spiffe://corp/ns/*/sa/billing". PrincipalID defaults to the matched value.
+type Rule struct {
+	Field       string   `json:"field"`
+	Pattern     string   `json:"pattern"`
+	PrincipalID string   `json:"principal_id"`
+	Roles       []string `json:"roles"`
+}
+
+func (rule Rule) values(info *CertInfo) []string {
+	switch rule.Field {
+	case FieldSPIFFE:
+		if info.SPIFFEID == "" {
+			return nil
+		}
+		return []string{info.SPIFFEID}
+	case FieldURI:
+		return info.URIs
+	case FieldDNS:
+		return info.DNSNames
+	case FieldEmail:
+		return info.Emails
+	case FieldCommonName:
+		return []string{info.CommonName}
+	}
+	return nil
+}
+
+// Match returns the matched certificate value.
+func (rule Rule) Match(info *CertInfo) (string, bool) {
+	for _, v := range rule.values(info) {
+		if matched, err := path.Match(rule.Pattern, v); err == nil && matched {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func (rule Rule) validate() error {
+	switch rule.Field {
+	case FieldSPIFFE, FieldURI, FieldDNS, FieldEmail, FieldCommonName:
+	default:
+		return fmt.Errorf("unknown mtls rule field %q", rule.Field)
+	}
+	if _, err := path.Match(rule.Pattern, ""); err != nil {
+		return fmt.Errorf("invalid mtls rule pattern %q: %w", rule.Pattern, err)
+	}
+	return nil
+}
+
+// LoadRules reads a JSON array of rules.
+func LoadRules(file string) ([]Rule, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading mtls rules: %w", err)
+	}
+	var rules []Rule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("failed decoding mtls rules: %w", err)
+	}
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
@@ -0,0 +1,188 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("oauth record not found")
+
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+
+	TokenKindAccess  = "access_token"
+	TokenKindRefresh = "refresh_token"
+
+	ChallengeS256  = "S256"
+	ChallengePlain = "plain"
+)
+
+// Client is a registered application. Clients without a SecretHash are public clients, which
+// must use PKCE and cannot use client_credentials. List fields are space separated.
+type Client struct {
+	ID           string `db:"id" json:"id" qc:"primary;data_type::varchar(128);where::="`
+	SecretHash   string `db:"secret_hash" json:"secret_hash" qc:"data_type::varchar(128);update"`
+	Name         string `db:"name" json:"name" qc:"data_type::varchar(256);update"`
+	RedirectURIs string `db:"redirect_uris" json:"redirect_uris" qc:"data_type::text;update"`
+	GrantTypes   string `db:"grant_types" json:"grant_types" qc:"data_type::varchar(256);update"`
+	Scopes       string `db:"scopes" json:"scopes" qc:"data_type::text;update"`
+	CreatedAt    int64  `db:"created_at" json:"created_at" qc:"data_type::bigint"`
+}
+
+// NewClient returns a client with a random id. Confidential clients also get a secret, which is
+// returned once and only stored hashed.
+func NewClient(name string, confidential bool, redirectURIs, grantTypes, scopes []string) (*Client, string, error) {
+	id, err := NewSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	c := &Client{
+		ID:           id,
+		Name:         name,
+		RedirectURIs: strings.Join(redirectURIs, " "),
+		GrantTypes:   strings.Join(grantTypes, " "),
+		Scopes:       strings.Join(scopes, " "),
+		CreatedAt:    time.Now().Unix(),
+	}
+	if !confidential {
+		return c, "", nil
+	}
+	secret, err := NewSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	c.SecretHash = HashSecret(secret)
+	return c, secret, nil
+}
+
+// Public reports whether the client cannot keep a secret.
+func (c *Client) Public() bool {
+	return c.SecretHash == ""
+}
+
+// Authenticate checks a client secret.
+func (c *Client) Authenticate(secret string) bool {
+	if c.Public() {
+		return secret == ""
+	}
+	return subtle.ConstantTimeCompare([]byte(c.SecretHash), []byte(HashSecret(secret))) == 1
+}
+
+func (c *Client) AllowsGrant(grant string) bool {
+	return contains(strings.Fields(c.GrantTypes), grant)
+}
+
+func (c *Client) AllowsRedirect(uri string) bool {
+	return uri != "" && contains(strings.Fields(c.RedirectURIs), uri)
+}
+
+// AllowsScope reports whether every requested scope was granted to the client.
+func (c *Client) AllowsScope(scope string) bool {
+	allowed := strings.Fields(c.Scopes)
+	for _, s := range strings.Fields(scope) {
+		if !contains(allowed, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// AuthorizationCode is a pending authorization code grant. Code holds the hash of the code.
+type AuthorizationCode struct {
+	Code                string `db:"code" json:"code" qc:"primary;data_type::varchar(128);where::="`
+	ClientID            string `db:"client_id" json:"client_id" qc:"data_type::varchar(128)"`
+	UserID              string `db:"user_id" json:"user_id" qc:"data_type::varchar(256)"`
+	RedirectURI         string `db:"redirect_uri" json:"redirect_uri" qc:"data_type::text"`
+	Scope               string `db:"scope" json:"scope" qc:"data_type::text"`
+	CodeChallenge       string `db:"code_challenge" json:"code_challenge" qc:"data_type::varchar(256)"`
+	CodeChallengeMethod string `db:"code_challenge_method" json:"code_challenge_method" qc:"data_type::varchar(16)"`
+	ExpiresAt           int64  `db:"expires_at" json:"expires_at" qc:"data_type::bigint;where::<"`
+}
+
+// VerifyChallenge checks a PKCE code_verifier against the stored challenge.
+func (a *AuthorizationCode) VerifyChallenge(verifier string) bool {
+	if a.CodeChallenge == "" {
+		return verifier == ""
+	}
+	expected := verifier
+	if a.CodeChallengeMethod == ChallengeS256 {
+		sum := sha256.Sum256([]byte(verifier))
+		expected = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	return subtle.ConstantTimeCompare([]byte(a.CodeChallenge), []byte(expected)) == 1
+}
+
+// Token is an issued access or refresh token. ID holds the hash of the token; every token
+// issued from one authorization shares GrantID so the whole chain can be revoked.
+type Token struct {
+	ID        string `db:"id" json:"id" qc:"primary;data_type::varchar(128);where::="`
+	Kind      string `db:"kind" json:"kind" qc:"data_type::varchar(32)"`
+	GrantID   string `db:"grant_id" json:"grant_id" qc:"data_type::varchar(128);where::="`
+	ClientID  string `db:"client_id" json:"client_id" qc:"data_type::varchar(128)"`
+	UserID    string `db:"user_id" json:"user_id" qc:"data_type::varchar(256)"`
+	Scope     string `db:"scope" json:"scope" qc:"data_type::text"`
+	IssuedAt  int64  `db:"issued_at" json:"issued_at" qc:"data_type::bigint"`
+	ExpiresAt int64  `db:"expires_at" json:"expires_at" qc:"data_type::bigint"`
+	RevokedAt int64  `db:"revoked_at" json:"revoked_at" qc:"data_type::bigint;update"`
+}
+
+// Active reports whether the token is neither revoked nor expired at now.
+func (t *Token) Active(now time.Time) bool {
+	return t.RevokedAt == 0 && now.Unix() < t.ExpiresAt
+}
+
+type ClientStore interface {
+	GetClient(ctx context.Context, id string) (*Client, error)
+	CreateClient(ctx context.Context, c *Client) error
+}
+
+type CodeStore interface {
+	CreateCode(ctx context.Context, code *AuthorizationCode) error
+	// ConsumeCode returns and deletes a code so it can only be exchanged once.
+	ConsumeCode(ctx context.Context, code string) (*AuthorizationCode, error)
+}
+
+type TokenStore interface {
+	CreateToken(ctx context.Context, t *Token) error
+	GetToken(ctx context.Context, id string) (*Token, error)
+	UpdateToken(ctx context.Context, t *Token) error
+	// RevokeToken revokes a token only when it is not revoked yet, so of two concurrent callers
+	// exactly one succeeds. The other gets ErrNotFound, as do unknown tokens.
+	RevokeToken(ctx context.Context, id string, at time.Time) error
+	// RevokeGrant revokes every token of a grant.
+	RevokeGrant(ctx context.Context, grantID string, at time.Time) error
+}
+
+// NewSecret returns a random url safe secret used for client secrets, codes and tokens.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashSecret returns the stored form of a client secret, code or token. They are random, so a
+// fast hash is enough.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Seann-Moser/go-serve/server/auth"
+)
+
+type testProvider struct {
+	*Provider
+	public       *Client
+	confidential *Client
+	secret       string
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	ctx := context.Background()
+	store := NewInMemoryStore()
+	p := New(store, store, store)
+
+	public, _, err := NewClient("spa", false, []string{"https://app/cb"}, []string{GrantAuthorizationCode, GrantRefreshToken}, []string{"read", "write"})
+	require.NoError(t, err)
+	require.NoError(t, store.CreateClient(ctx, public))
+	confidential, secret, err := NewClient("backend", true, nil, []string{GrantClientCredentials}, []string{"read"})
+	require.NoError(t, err)
+	require.NoError(t, store.CreateClient(ctx, confidential))
+	return &testProvider{Provider: p, public: public, confidential: confidential, secret: secret}
+}
+
+func (p *testProvider) post(t *testing.T, handler http.HandlerFunc, values url.Values) (*httptest.ResponseRecorder, map[string]interface{}) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler(w, r)
+	body := map[string]interface{}{}
+	if w.Body.Len() > 0 {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	}
+	return w, body
+}
+
+func (p *testProvider) authorize(t *testing.T, challenge string) string {
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.public.ID},
+		"redirect_uri":          {"https://app/cb"},
+		"scope":                 {"read"},
+		"state":                 {"xyz"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {ChallengeS256},
+	}
+	r := httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+q.Encode(), nil)
+	r = auth.SetPrincipal(r, &auth.Principal{ID: "user-1"})
+	w := httptest.NewRecorder()
+	p.AuthorizeHandler(w, r)
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+	require.NotEmpty(t, location.Query().Get("code"))
+	return location.Query().Get("code")
+}
+
+func TestAuthorizationCodeWithPKCE(t *testing.T) {
+	p := newTestProvider(t)
+	verifier := "a-very-long-code-verifier-for-the-pkce-test-1234567890"
+	sum := sha256.Sum256([]byte(verifier))
+	code := p.authorize(t, base64.RawURLEncoding.EncodeToString(sum[:]))
+
+	exchange := url.Values{
+		"grant_type":    {GrantAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {"https://app/cb"},
+		"client_id":     {p.public.ID},
+		"code_verifier": {"wrong"},
+	}
+	w, body := p.post(t, p.TokenHandler, exchange)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ErrCodeInvalidGrant, body["error"])
+
+	// a failed exchange consumes the code
+	code = p.authorize(t, base64.RawURLEncoding.EncodeToString(sum[:]))
+	exchange.Set("code", code)
+	exchange.Set("code_verifier", verifier)
+	w, body = p.post(t, p.TokenHandler, exchange)
+	require.Equal(t, http.StatusOK, w.Code, body)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	access := body["access_token"].(string)
+	refresh := body["refresh_token"].(string)
+
+	w, _ = p.post(t, p.TokenHandler, exchange)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "codes are single use")
+
+	introspect := url.Values{"token": {access}, "client_id": {p.confidential.ID}, "client_secret": {p.secret}}
+	_, body = p.post(t, p.IntrospectHandler, introspect)
+	assert.Equal(t, true, body["active"])
+	assert.Equal(t, "user-1", body["sub"])
+
+	w, body = p.post(t, p.TokenHandler, url.Values{"grant_type": {GrantRefreshToken}, "refresh_token": {refresh}, "client_id": {p.public.ID}})
+	require.Equal(t, http.StatusOK, w.Code, body)
+	rotated := body["access_token"].(string)
+
+	// reusing the old refresh token revokes the whole grant
+	w, _ = p.post(t, p.TokenHandler, url.Values{"grant_type": {GrantRefreshToken}, "refresh_token": {refresh}, "client_id": {p.public.ID}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	introspect.Set("token", rotated)
+	_, body = p.post(t, p.IntrospectHandler, introspect)
+	assert.Equal(t, false, body["active"])
+}
+
+func TestAuthorizeRequiresLogin(t *testing.T) {
+	p := newTestProvider(t)
+	p.LoginURL = "/login"
+	q := url.Values{"response_type": {"code"}, "client_id": {p.public.ID}, "redirect_uri": {"https://app/cb"}, "code_challenge": {"abc"}}
+	w := httptest.NewRecorder()
+	p.AuthorizeHandler(w, httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+q.Encode(), nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Location"), "/login?redirect="))
+
+	q.Set("redirect_uri", "https://evil/cb")
+	w = httptest.NewRecorder()
+	p.AuthorizeHandler(w, httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+q.Encode(), nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestClientCredentialsAndRevoke(t *testing.T) {
+	p := newTestProvider(t)
+	w, body := p.post(t, p.TokenHandler, url.Values{"grant_type": {GrantClientCredentials}, "client_id": {p.confidential.ID}, "client_secret": {"wrong"}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, ErrCodeInvalidClient, body["error"])
+
+	w, body = p.post(t, p.TokenHandler, url.Values{"grant_type": {GrantClientCredentials}, "client_id": {p.confidential.ID}, "client_secret": {p.secret}})
+	require.Equal(t, http.StatusOK, w.Code, body)
+	assert.Nil(t, body["refresh_token"])
+	access := body["access_token"].(string)
+
+	w, _ = p.post(t, p.RevokeHandler, url.Values{"token": {access}, "client_id": {p.confidential.ID}, "client_secret": {p.secret}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, body = p.post(t, p.IntrospectHandler, url.Values{"token": {access}, "client_id": {p.confidential.ID}, "client_secret": {p.secret}})
+	assert.Equal(t, false, body["active"])
+}
+
+func TestInMemoryStore_SingleUse(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStore()
+	require.NoError(t, store.CreateCode(ctx, &AuthorizationCode{Code: "code"}))
+	_, err := store.ConsumeCode(ctx, "code")
+	require.NoError(t, err)
+	_, err = store.ConsumeCode(ctx, "code")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, store.CreateToken(ctx, &Token{ID: "token"}))
+	require.NoError(t, store.RevokeToken(ctx, "token", time.Now()))
+	assert.ErrorIs(t, store.RevokeToken(ctx, "token", time.Now()), ErrNotFound, "only the first revoke wins")
+	assert.ErrorIs(t, store.RevokeToken(ctx, "missing", time.Now()), ErrNotFound)
+}
@@ -0,0 +1,473 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/request"
+	"github.com/Seann-Moser/go-serve/server/auth"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+const (
+	oauthAccessTokenTTLFlag  = "oauth-access-token-ttl"
+	oauthRefreshTokenTTLFlag = "oauth-refresh-token-ttl"
+	oauthCodeTTLFlag         = "oauth-code-ttl"
+	oauthLoginURLFlag        = "oauth-login-url"
+)
+
+// Error codes from RFC 6749 section 5.2 and 4.1.2.1.
+const (
+	ErrCodeInvalidRequest       = "invalid_request"
+	ErrCodeInvalidClient        = "invalid_client"
+	ErrCodeInvalidGrant         = "invalid_grant"
+	ErrCodeUnauthorizedClient   = "unauthorized_client"
+	ErrCodeUnsupportedGrantType = "unsupported_grant_type"
+	ErrCodeUnsupportedResponse  = "unsupported_response_type"
+	ErrCodeInvalidScope         = "invalid_scope"
+	ErrCodeAccessDenied         = "access_denied"
+	ErrCodeServerError          = "server_error"
+)
+
+func Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("oauth", pflag.ExitOnError)
+	fs.Duration(oauthAccessTokenTTLFlag, time.Hour, "lifetime of issued access tokens")
+	fs.Duration(oauthRefreshTokenTTLFlag, 30*24*time.Hour, "lifetime of issued refresh tokens")
+	fs.Duration(oauthCodeTTLFlag, time.Minute, "lifetime of authorization codes")
+	fs.String(oauthLoginURLFlag, "", "page users are sent to when they reach /oauth/authorize without being signed in")
+	return fs
+}
+
+// Provider is an OAuth2 authorization server. /oauth/authorize issues codes to the
+// auth.Principal of the request, so it must run behind the login middleware (cookies or
+// sessions); the other endpoints authenticate the client.
+type Provider struct {
+	Clients         ClientStore
+	Codes           CodeStore
+	Tokens          TokenStore
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	CodeTTL         time.Duration
+	// LoginURL receives a "redirect" query param with the authorize url to return to.
+	LoginURL string
+}
+
+func NewFromFlags(clients ClientStore, codes CodeStore, tokens TokenStore) *Provider {
+	p := New(clients, codes, tokens)
+	p.AccessTokenTTL = viper.GetDuration(oauthAccessTokenTTLFlag)
+	p.RefreshTokenTTL = viper.GetDuration(oauthRefreshTokenTTLFlag)
+	p.CodeTTL = viper.GetDuration(oauthCodeTTLFlag)
+	p.LoginURL = viper.GetString(oauthLoginURLFlag)
+	return p
+}
+
+func New(clients ClientStore, codes CodeStore, tokens TokenStore) *Provider {
+	return &Provider{
+		Clients:         clients,
+		Codes:           codes,
+		Tokens:          tokens,
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: 30 * 24 * time.Hour,
+		CodeTTL:         time.Minute,
+	}
+}
+
+// Endpoints returns /oauth/authorize, /oauth/token, /oauth/revoke and /oauth/introspect.
+func (p *Provider) Endpoints(prefix string) []*endpoints.Endpoint {
+	authorize := endpoints.NewEndpoint(prefix, "/oauth/authorize", "", p.AuthorizeHandler, http.MethodGet)
+	authorize.Description = "authorization code grant with PKCE"
+	authorize.QueryParams = []string{"response_type", "client_id", "redirect_uri", "scope", "state", "code_challenge", "code_challenge_method"}
+
+	token := endpoints.NewEndpoint(prefix, "/oauth/token", "", p.TokenHandler, http.MethodPost)
+	token.Description = "exchanges a code, refresh token or client credentials for tokens"
+	token.SetRequestType(TokenRequest{}, http.MethodPost)
+	token.SetResponseType(TokenResponse{})
+
+	revoke := endpoints.NewEndpoint(prefix, "/oauth/revoke", "", p.RevokeHandler, http.MethodPost)
+	revoke.Description = "revokes a token (RFC 7009)"
+
+	introspect := endpoints.NewEndpoint(prefix, "/oauth/introspect", "", p.IntrospectHandler, http.MethodPost)
+	introspect.Description = "describes a token (RFC 7662)"
+	introspect.SetResponseType(IntrospectResponse{})
+
+	output := []*endpoints.Endpoint{authorize, token, revoke, introspect}
+	for _, e := range output {
+		e.Public = true
+		// clients post from other origins without cookies, authorize is a GET
+		e.SkipCSRF = true
+	}
+	return output
+}
+
+func (p *Provider) AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	client, err := p.Clients.GetClient(r.Context(), q.Get("client_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidClient, "unknown client")
+		return
+	}
+	redirectURI := q.Get("redirect_uri")
+	if !client.AllowsRedirect(redirectURI) {
+		// never redirect to an unregistered uri
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "redirect_uri is not registered")
+		return
+	}
+	state := q.Get("state")
+	switch {
+	case q.Get("response_type") != "code":
+		redirectError(w, r, redirectURI, state, ErrCodeUnsupportedResponse)
+		return
+	case !client.AllowsGrant(GrantAuthorizationCode):
+		redirectError(w, r, redirectURI, state, ErrCodeUnauthorizedClient)
+		return
+	case !client.AllowsScope(q.Get("scope")):
+		redirectError(w, r, redirectURI, state, ErrCodeInvalidScope)
+		return
+	}
+	method := q.Get("code_challenge_method")
+	if method == "" && q.Get("code_challenge") != "" {
+		method = ChallengePlain
+	}
+	if (client.Public() && q.Get("code_challenge") == "") || (method != "" && method != ChallengeS256 && method != ChallengePlain) {
+		redirectError(w, r, redirectURI, state, ErrCodeInvalidRequest)
+		return
+	}
+
+	principal, found := auth.GetPrincipal(r.Context())
+	if !found || principal.ID == "" {
+		if p.LoginURL == "" {
+			writeError(w, http.StatusUnauthorized, ErrCodeAccessDenied, "sign in required")
+			return
+		}
+		http.Redirect(w, r, p.LoginURL+"?redirect="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+		return
+	}
+
+	code, err := NewSecret()
+	if err != nil {
+		redirectError(w, r, redirectURI, state, ErrCodeServerError)
+		return
+	}
+	err = p.Codes.CreateCode(r.Context(), &AuthorizationCode{
+		Code:                HashSecret(code),
+		ClientID:            client.ID,
+		UserID:              principal.ID,
+		RedirectURI:         redirectURI,
+		Scope:               q.Get("scope"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: method,
+		ExpiresAt:           time.Now().Add(p.CodeTTL).Unix(),
+	})
+	if err != nil {
+		ctxLogger.Error(r.Context(), "failed storing authorization code", zap.Error(err))
+		redirectError(w, r, redirectURI, state, ErrCodeServerError)
+		return
+	}
+	http.Redirect(w, r, withQuery(redirectURI, url.Values{"code": {code}, "state": {state}}), http.StatusFound)
+}
+
+// TokenRequest is the body of /oauth/token, form encoded or json.
+type TokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	Code         string `json:"code"`
+	RedirectURI  string `json:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+func (p *Provider) TokenHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := request.GetBody[TokenRequest](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request body")
+		return
+	}
+	client, ok := p.authenticateClient(w, r, body.ClientID, body.ClientSecret)
+	if !ok {
+		return
+	}
+	if !client.AllowsGrant(body.GrantType) {
+		writeError(w, http.StatusBadRequest, ErrCodeUnauthorizedClient, "grant type not allowed for client")
+		return
+	}
+	switch body.GrantType {
+	case GrantAuthorizationCode:
+		p.exchangeCode(w, r, client, body)
+	case GrantRefreshToken:
+		p.refresh(w, r, client, body)
+	case GrantClientCredentials:
+		if client.Public() {
+			writeError(w, http.StatusBadRequest, ErrCodeUnauthorizedClient, "public clients cannot use client_credentials")
+			return
+		}
+		scope := body.Scope
+		if scope == "" {
+			scope = client.Scopes
+		}
+		if !client.AllowsScope(scope) {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidScope, "scope not allowed for client")
+			return
+		}
+		p.issue(w, r, client, "", scope, "", false)
+	default:
+		writeError(w, http.StatusBadRequest, ErrCodeUnsupportedGrantType, "unsupported grant_type")
+	}
+}
+
+func (p *Provider) exchangeCode(w http.ResponseWriter, r *http.Request, client *Client, body *TokenRequest) {
+	code, err := p.Codes.ConsumeCode(r.Context(), HashSecret(body.Code))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusInternalServerError, ErrCodeServerError, "failed loading code")
+		return
+	}
+	if err != nil || code.ClientID != client.ID || code.RedirectURI != body.RedirectURI ||
+		time.Now().Unix() >= code.ExpiresAt || !code.VerifyChallenge(body.CodeVerifier) {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidGrant, "invalid authorization code")
+		return
+	}
+	p.issue(w, r, client, code.UserID, code.Scope, "", client.AllowsGrant(GrantRefreshToken))
+}
+
+// refresh rotates refresh tokens. Presenting a refresh token that was already used revokes
+// every token of its grant, since one of the two holders must have stolen it.
+func (p *Provider) refresh(w http.ResponseWriter, r *http.Request, client *Client, body *TokenRequest) {
+	now := time.Now()
+	old, err := p.Tokens.GetToken(r.Context(), HashSecret(body.RefreshToken))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusInternalServerError, ErrCodeServerError, "failed loading token")
+		return
+	}
+	if err != nil || old.Kind != TokenKindRefresh || old.ClientID != client.ID {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidGrant, "invalid refresh token")
+		return
+	}
+	if old.RevokedAt != 0 {
+		p.revokeReusedGrant(w, r, client, old, now)
+		return
+	}
+	if !old.Active(now) {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidGrant, "invalid refresh token")
+		return
+	}
+	scope := old.Scope
+	if body.Scope != "" {
+		narrowed := &Client{Scopes: old.Scope}
+		if !narrowed.AllowsScope(body.Scope) {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidScope, "scope exceeds the original grant")
+			return
+		}
+		scope = body.Scope
+	}
+	// a concurrent refresh with the same token revoked it first, which is a reuse as well
+	if err := p.Tokens.RevokeToken(r.Context(), old.ID, now); errors.Is(err, ErrNotFound) {
+		p.revokeReusedGrant(w, r, client, old, now)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeServerError, "failed rotating refresh token")
+		return
+	}
+	p.issue(w, r, client, old.UserID, scope, old.GrantID, true)
+}
+
+func (p *Provider) revokeReusedGrant(w http.ResponseWriter, r *http.Request, client *Client, old *Token, now time.Time) {
+	ctxLogger.Warn(r.Context(), "refresh token reused, revoking grant", zap.String("client_id", client.ID), zap.String("grant_id", old.GrantID))
+	if err := p.Tokens.RevokeGrant(r.Context(), old.GrantID, now); err != nil {
+		ctxLogger.Error(r.Context(), "failed revoking grant", zap.Error(err))
+	}
+	writeError(w, http.StatusBadRequest, ErrCodeInvalidGrant, "invalid refresh token")
+}
+
+func (p *Provider) issue(w http.ResponseWriter, r *http.Request, client *Client, userID, scope, grantID string, withRefresh bool) {
+	now := time.Now()
+	if grantID == "" {
+		var err error
+		if grantID, err = NewSecret(); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeServerError, "failed issuing token")
+			return
+		}
+	}
+	resp := TokenResponse{
+		TokenType: "Bearer",
+		ExpiresIn: int64(p.AccessTokenTTL.Seconds()),
+		Scope:     scope,
+	}
+	var err error
+	if resp.AccessToken, err = p.createToken(r, TokenKindAccess, grantID, client.ID, userID, scope, now, p.AccessTokenTTL); err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeServerError, "failed issuing token")
+		return
+	}
+	if withRefresh {
+		if resp.RefreshToken, err = p.createToken(r, TokenKindRefresh, grantID, client.ID, userID, scope, now, p.RefreshTokenTTL); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeServerError, "failed issuing token")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (p *Provider) createToken(r *http.Request, kind, grantID, clientID, userID, scope string, now time.Time, ttl time.Duration) (string, error) {
+	secret, err := NewSecret()
+	if err != nil {
+		return "", err
+	}
+	err = p.Tokens.CreateToken(r.Context(), &Token{
+		ID:        HashSecret(secret),
+		Kind:      kind,
+		GrantID:   grantID,
+		ClientID:  clientID,
+		UserID:    userID,
+		Scope:     scope,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		ctxLogger.Error(r.Context(), "failed storing oauth token", zap.Error(err))
+		return "", err
+	}
+	return secret, nil
+}
+
+// TokenActionRequest is the body of /oauth/revoke and /oauth/introspect.
+type TokenActionRequest struct {
+	Token         string `json:"token"`
+	TokenTypeHint string `json:"token_type_hint"`
+	ClientID      string `json:"client_id"`
+	ClientSecret  string `json:"client_secret"`
+}
+
+// RevokeHandler revokes a token of the calling client. Revoking a refresh token revokes its
+// whole grant. Unknown tokens succeed as required by RFC 7009.
+func (p *Provider) RevokeHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := request.GetBody[TokenActionRequest](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request body")
+		return
+	}
+	client, ok := p.authenticateClient(w, r, body.ClientID, body.ClientSecret)
+	if !ok {
+		return
+	}
+	t, err := p.Tokens.GetToken(r.Context(), HashSecret(body.Token))
+	if err == nil && t.ClientID == client.ID {
+		if t.Kind == TokenKindRefresh {
+			err = p.Tokens.RevokeGrant(r.Context(), t.GrantID, time.Now())
+		} else {
+			err = p.Tokens.RevokeToken(r.Context(), t.ID, time.Now())
+		}
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		ctxLogger.Error(r.Context(), "failed revoking oauth token", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, ErrCodeServerError, "failed revoking token")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+type IntrospectResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// IntrospectHandler reports whether a token is active. Resource servers authenticate as a
+// confidential client to call it.
+func (p *Provider) IntrospectHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := request.GetBody[TokenActionRequest](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request body")
+		return
+	}
+	client, ok := p.authenticateClient(w, r, body.ClientID, body.ClientSecret)
+	if !ok {
+		return
+	}
+	if client.Public() {
+		writeError(w, http.StatusUnauthorized, ErrCodeInvalidClient, "introspection requires a confidential client")
+		return
+	}
+	t, err := p.Tokens.GetToken(r.Context(), HashSecret(body.Token))
+	if err != nil || !t.Active(time.Now()) {
+		writeJSON(w, http.StatusOK, IntrospectResponse{Active: false})
+		return
+	}
+	writeJSON(w, http.StatusOK, IntrospectResponse{
+		Active:    true,
+		Scope:     t.Scope,
+		ClientID:  t.ClientID,
+		Subject:   t.UserID,
+		TokenType: t.Kind,
+		ExpiresAt: t.ExpiresAt,
+		IssuedAt:  t.IssuedAt,
+	})
+}
+
+// authenticateClient accepts HTTP basic credentials or client_id/client_secret in the body.
+func (p *Provider) authenticateClient(w http.ResponseWriter, r *http.Request, id, secret string) (*Client, bool) {
+	if basicID, basicSecret, found := r.BasicAuth(); found {
+		id, _ = url.QueryUnescape(basicID)
+		secret, _ = url.QueryUnescape(basicSecret)
+	}
+	client, err := p.Clients.GetClient(r.Context(), id)
+	if err != nil || !client.Authenticate(secret) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		writeError(w, http.StatusUnauthorized, ErrCodeInvalidClient, "client authentication failed")
+		return nil, false
+	}
+	return client, true
+}
+
+type errorResponse struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, errorResponse{Error: code, Description: description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func redirectError(w http.ResponseWriter, r *http.Request, redirectURI, state, code string) {
+	http.Redirect(w, r, withQuery(redirectURI, url.Values{"error": {code}, "state": {state}}), http.StatusFound)
+}
+
+func withQuery(uri string, values url.Values) string {
+	for k, v := range values {
+		if len(v) == 0 || v[0] == "" {
+			delete(values, k)
+		}
+	}
+	if strings.Contains(uri, "?") {
+		return uri + "&" + values.Encode()
+	}
+	return uri + "?" + values.Encode()
+}
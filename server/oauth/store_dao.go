@@ -0,0 +1,150 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Seann-Moser/QueryHelper"
+
+	"github.com/Seann-Moser/go-serve/pkg/db"
+)
+
+var (
+	_ ClientStore = &DAOStore{}
+	_ CodeStore   = &DAOStore{}
+	_ TokenStore  = &DAOStore{}
+)
+
+// DAOStore keeps clients, codes and tokens in QueryHelper tables registered on a db.DAO.
+type DAOStore struct {
+	dao     *db.DAO
+	clients *QueryHelper.Table[Client]
+	codes   *QueryHelper.Table[AuthorizationCode]
+	tokens  *QueryHelper.Table[Token]
+}
+
+// NewDAOStore registers the oauth tables on the dao and returns stores backed by them.
+func NewDAOStore(ctx context.Context, dao *db.DAO, dataset string) (*DAOStore, error) {
+	var err error
+	d := &DAOStore{dao: dao}
+	if d.clients, err = addTable[Client](ctx, dao, dataset); err != nil {
+		return nil, err
+	}
+	if d.codes, err = addTable[AuthorizationCode](ctx, dao, dataset); err != nil {
+		return nil, err
+	}
+	if d.tokens, err = addTable[Token](ctx, dao, dataset); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func addTable[T any](ctx context.Context, dao *db.DAO, dataset string) (*QueryHelper.Table[T], error) {
+	tableCtx, err := db.AddTable[T](ctx, dao, dataset, QueryHelper.QueryTypeSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed adding oauth table: %w", err)
+	}
+	return QueryHelper.GetTableCtx[T](tableCtx)
+}
+
+func (d *DAOStore) GetClient(ctx context.Context, id string) (*Client, error) {
+	q := QueryHelper.QueryTable[Client](d.clients)
+	clients, err := q.Where(q.Column("id"), "=", "AND", 0, id).Run(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading oauth client: %w", err)
+	}
+	if len(clients) == 0 {
+		return nil, ErrNotFound
+	}
+	return clients[0], nil
+}
+
+func (d *DAOStore) CreateClient(ctx context.Context, c *Client) error {
+	if _, err := d.clients.Insert(ctx, nil, *c); err != nil {
+		return fmt.Errorf("failed inserting oauth client: %w", err)
+	}
+	return nil
+}
+
+func (d *DAOStore) CreateCode(ctx context.Context, code *AuthorizationCode) error {
+	if _, err := d.codes.Insert(ctx, nil, *code); err != nil {
+		return fmt.Errorf("failed inserting authorization code: %w", err)
+	}
+	return nil
+}
+
+func (d *DAOStore) ConsumeCode(ctx context.Context, code string) (*AuthorizationCode, error) {
+	q := QueryHelper.QueryTable[AuthorizationCode](d.codes)
+	codes, err := q.Where(q.Column("code"), "=", "AND", 0, code).Run(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading authorization code: %w", err)
+	}
+	if len(codes) == 0 {
+		return nil, ErrNotFound
+	}
+	// only the caller whose delete removed the row may use the code
+	result, err := d.dao.NamedExecResult(ctx,
+		fmt.Sprintf("DELETE FROM %s WHERE code = :code", d.codes.FullTableName()),
+		map[string]interface{}{"code": code})
+	if err != nil {
+		return nil, fmt.Errorf("failed deleting authorization code: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed deleting authorization code: %w", err)
+	} else if n != 1 {
+		return nil, ErrNotFound
+	}
+	return codes[0], nil
+}
+
+// DeleteExpiredCodes removes codes that were never exchanged. Run it periodically.
+func (d *DAOStore) DeleteExpiredCodes(ctx context.Context, now time.Time) error {
+	return d.codes.NamedExec(ctx, nil,
+		fmt.Sprintf("DELETE FROM %s WHERE expires_at < :expires_at", d.codes.FullTableName()),
+		map[string]interface{}{"expires_at": now.Unix()})
+}
+
+func (d *DAOStore) CreateToken(ctx context.Context, t *Token) error {
+	if _, err := d.tokens.Insert(ctx, nil, *t); err != nil {
+		return fmt.Errorf("failed inserting oauth token: %w", err)
+	}
+	return nil
+}
+
+func (d *DAOStore) GetToken(ctx context.Context, id string) (*Token, error) {
+	q := QueryHelper.QueryTable[Token](d.tokens)
+	tokens, err := q.Where(q.Column("id"), "=", "AND", 0, id).Run(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading oauth token: %w", err)
+	}
+	if len(tokens) == 0 {
+		return nil, ErrNotFound
+	}
+	return tokens[0], nil
+}
+
+func (d *DAOStore) UpdateToken(ctx context.Context, t *Token) error {
+	return d.tokens.Update(ctx, nil, *t)
+}
+
+func (d *DAOStore) RevokeToken(ctx context.Context, id string, at time.Time) error {
+	result, err := d.dao.NamedExecResult(ctx,
+		fmt.Sprintf("UPDATE %s SET revoked_at = :revoked_at WHERE id = :id AND revoked_at = 0", d.tokens.FullTableName()),
+		map[string]interface{}{"id": id, "revoked_at": at.Unix()})
+	if err != nil {
+		return fmt.Errorf("failed revoking oauth token: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed revoking oauth token: %w", err)
+	} else if n != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (d *DAOStore) RevokeGrant(ctx context.Context, grantID string, at time.Time) error {
+	return d.tokens.NamedExec(ctx, nil,
+		fmt.Sprintf("UPDATE %s SET revoked_at = :revoked_at WHERE grant_id = :grant_id AND revoked_at = 0", d.tokens.FullTableName()),
+		map[string]interface{}{"grant_id": grantID, "revoked_at": at.Unix()})
+}
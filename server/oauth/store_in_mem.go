@@ -0,0 +1,120 @@
+package oauth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	_ ClientStore = &InMemoryStore{}
+	_ CodeStore   = &InMemoryStore{}
+	_ TokenStore  = &InMemoryStore{}
+)
+
+// InMemoryStore keeps clients, codes and tokens in maps. It is meant for tests and single
+// instance services.
+type InMemoryStore struct {
+	mu      sync.Mutex
+	clients map[string]*Client
+	codes   map[string]*AuthorizationCode
+	tokens  map[string]*Token
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		clients: map[string]*Client{},
+		codes:   map[string]*AuthorizationCode{},
+		tokens:  map[string]*Token{},
+	}
+}
+
+func (m *InMemoryStore) GetClient(ctx context.Context, id string) (*Client, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, found := m.clients[id]
+	if !found {
+		return nil, ErrNotFound
+	}
+	cp := *c
+	return &cp, nil
+}
+
+func (m *InMemoryStore) CreateClient(ctx context.Context, c *Client) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp := *c
+	m.clients[c.ID] = &cp
+	return nil
+}
+
+func (m *InMemoryStore) CreateCode(ctx context.Context, code *AuthorizationCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp := *code
+	m.codes[code.Code] = &cp
+	return nil
+}
+
+func (m *InMemoryStore) ConsumeCode(ctx context.Context, code string) (*AuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, found := m.codes[code]
+	if !found {
+		return nil, ErrNotFound
+	}
+	delete(m.codes, code)
+	return c, nil
+}
+
+func (m *InMemoryStore) CreateToken(ctx context.Context, t *Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp := *t
+	m.tokens[t.ID] = &cp
+	return nil
+}
+
+func (m *InMemoryStore) GetToken(ctx context.Context, id string) (*Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, found := m.tokens[id]
+	if !found {
+		return nil, ErrNotFound
+	}
+	cp := *t
+	return &cp, nil
+}
+
+func (m *InMemoryStore) UpdateToken(ctx context.Context, t *Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, found := m.tokens[t.ID]; !found {
+		return ErrNotFound
+	}
+	cp := *t
+	m.tokens[t.ID] = &cp
+	return nil
+}
+
+func (m *InMemoryStore) RevokeToken(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, found := m.tokens[id]
+	if !found || t.RevokedAt != 0 {
+		return ErrNotFound
+	}
+	t.RevokedAt = at.Unix()
+	return nil
+}
+
+func (m *InMemoryStore) RevokeGrant(ctx context.Context, grantID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.tokens {
+		if t.GrantID == grantID && t.RevokedAt == 0 {
+			t.RevokedAt = at.Unix()
+		}
+	}
+	return nil
+}
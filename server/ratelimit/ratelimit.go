@@ -0,0 +1,230 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/response"
+	"github.com/Seann-Moser/go-serve/server/auth"
+	"github.com/Seann-Moser/go-serve/server/device"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+const (
+	rateLimitLimitFlag   = "ratelimit-limit"
+	rateLimitWindowFlag  = "ratelimit-window"
+	rateLimitKeyFlag     = "ratelimit-key"
+	rateLimitShowErrFlag = "ratelimit-show-err"
+)
+
+// What requests are counted under.
+const (
+	KeyIP        = "ip"
+	KeyDevice    = "device"
+	KeyPrincipal = "principal"
+	KeyAPIKey    = "apikey"
+)
+
+// DefaultPolicy is the name of the policy used by endpoints without one of their own.
+const DefaultPolicy = "default"
+
+func Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("ratelimit", pflag.ExitOnError)
+	fs.Int(rateLimitLimitFlag, 0, "requests allowed per window by the default policy, 0 disables it")
+	fs.Duration(rateLimitWindowFlag, time.Minute, "window of the default policy")
+	fs.String(rateLimitKeyFlag, KeyIP, "what the default policy counts under: ip|device|principal|apikey")
+	fs.Bool(rateLimitShowErrFlag, false, "return error in http response(not secure)")
+	fs.AddFlagSet(device.Flags())
+	return fs
+}
+
+// Policy allows Limit requests per Window for every key. Principal and api key policies count
+// unauthenticated requests under the ip.
+type Policy struct {
+	Limit  int
+	Window time.Duration
+	Key    string
+}
+
+func (p Policy) enabled() bool {
+	return p.Limit > 0 && p.Window > 0
+}
+
+// Limiter rate limits requests with a sliding window. Endpoints pick a policy by name with
+// Endpoint.RateLimit; endpoints without one use the policy named after their Group, then the
+// default policy. Endpoints sharing a policy share its counts.
+type Limiter struct {
+	Store    Store
+	Response *response.Response
+	// Proxies resolves the client ip from forwarding headers. When nil the connection address is
+	// used.
+	Proxies *device.TrustedProxies
+	now     func() time.Time
+
+	mu       sync.RWMutex
+	policies map[string]Policy
+	routes   endpoints.RouteOptions[string]
+}
+
+func NewFromFlags(store Store) (*Limiter, error) {
+	l := New(store, viper.GetBool(rateLimitShowErrFlag))
+	proxies, err := device.TrustedProxiesFromFlags()
+	if err != nil {
+		return nil, fmt.Errorf("failed reading trusted proxies: %w", err)
+	}
+	l.Proxies = proxies
+	p := Policy{
+		Limit:  viper.GetInt(rateLimitLimitFlag),
+		Window: viper.GetDuration(rateLimitWindowFlag),
+		Key:    viper.GetString(rateLimitKeyFlag),
+	}
+	if err := l.AddPolicy(DefaultPolicy, p); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func New(store Store, showError bool) *Limiter {
+	return &Limiter{
+		Store:    store,
+		Response: response.NewResponse(showError),
+		now:      time.Now,
+		policies: map[string]Policy{},
+	}
+}
+
+// AddPolicy adds or replaces the policy called name. Name it DefaultPolicy to change the
+// fallback, or after an endpoint group to limit the group.
+func (l *Limiter) AddPolicy(name string, p Policy) error {
+	switch p.Key {
+	case "":
+		p.Key = KeyIP
+	case KeyIP, KeyDevice, KeyPrincipal, KeyAPIKey:
+	default:
+		return fmt.Errorf("invalid rate limit key %q", p.Key)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.policies[name] = p
+	return nil
+}
+
+func (l *Limiter) Register(eps ...*endpoints.Endpoint) {
+	for _, e := range eps {
+		if e == nil {
+			continue
+		}
+		name := e.RateLimit
+		if name == "" {
+			name = e.Group
+		}
+		if name != "" {
+			l.routes.Set(e.URLPath, name)
+		}
+	}
+}
+
+// policy resolves the policy of the matched route. Names are resolved per request, so
+// policies may be added after the endpoints.
+func (l *Limiter) policy(r *http.Request) (string, Policy) {
+	routeName, found := l.routes.Get(r)
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if found {
+		if p, found := l.policies[routeName]; found {
+			return routeName, p
+		}
+	}
+	return DefaultPolicy, l.policies[DefaultPolicy]
+}
+
+// key returns what r is counted under. The ip is resolved through the trusted proxies and the
+// device key is derived from it and the user agent, so forged forwarding headers cannot move a
+// caller to a fresh count.
+func (l *Limiter) key(r *http.Request, kind string) string {
+	if principal, found := auth.GetPrincipal(r.Context()); found && principal != nil {
+		switch {
+		case kind == KeyPrincipal && principal.ID != "":
+			return KeyPrincipal + ":" + principal.ID
+		case kind == KeyAPIKey && principal.Key != "":
+			return KeyAPIKey + ":" + principal.Key
+		}
+	}
+	ip := l.Proxies.ClientIP(r)
+	if kind == KeyDevice {
+		d := &device.Device{IPv4: ip, UserAgent: r.UserAgent()}
+		return KeyDevice + ":" + d.GenerateDeviceKey("")
+	}
+	return KeyIP + ":" + ip
+}
+
+// Middleware counts requests against the policy of their route, sets the RateLimit-* headers
+// and rejects requests over the limit with 429 and Retry-After. Errors of the store are logged
+// and let the request through. Add it after the auth middleware for principal and api key
+// policies.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, p := l.policy(r)
+		if !p.enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		now := l.now()
+		res, err := l.Store.Take(r.Context(), name+":"+l.key(r, p.Key), p.Limit, p.Window, now)
+		if err != nil {
+			ctxLogger.Error(r.Context(), "failed checking rate limit", zap.Error(err), zap.String("policy", name))
+			next.ServeHTTP(w, r)
+			return
+		}
+		_, elapsed := windowIndex(p.Window, now)
+		weight := previousWeight(p.Window, elapsed)
+		remaining := int(math.Floor(float64(p.Limit) - estimate(res.Previous, res.Current, weight)))
+		if remaining < 0 {
+			remaining = 0
+		}
+		reset := p.Window - elapsed
+		if !res.Allowed {
+			reset = retryAfter(res, p, elapsed)
+		}
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(p.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(seconds(reset)))
+		h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", p.Limit, seconds(p.Window)))
+		if !res.Allowed {
+			h.Set("Retry-After", strconv.Itoa(seconds(reset)))
+			l.Response.Error(r, w, nil, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// retryAfter returns how long until the sliding estimate leaves room for one more request.
+func retryAfter(res Result, p Policy, elapsed time.Duration) time.Duration {
+	window := float64(p.Window)
+	// room opens up within the current window as the previous one slides out
+	if free := p.Limit - res.Current - 1; free >= 0 && res.Previous > 0 {
+		at := window * (1 - float64(free)/float64(res.Previous))
+		return time.Duration(math.Max(at-float64(elapsed), 0))
+	}
+	// otherwise the current window has to slide out after it ends
+	wait := window - float64(elapsed)
+	if res.Current > 0 {
+		wait += math.Max(window*(1-float64(p.Limit-1)/float64(res.Current)), 0)
+	}
+	return time.Duration(wait)
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Seann-Moser/go-serve/server/auth"
+	"github.com/Seann-Moser/go-serve/server/device"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+func newRouter(t *testing.T, l *Limiter, eps ...*endpoints.Endpoint) *mux.Router {
+	t.Helper()
+	router := mux.NewRouter()
+	for _, e := range eps {
+		router.HandleFunc(e.URLPath, e.HandlerFunc)
+	}
+	l.Register(eps...)
+	router.Use(l.Middleware)
+	return router
+}
+
+func ok(w http.ResponseWriter, r *http.Request) {}
+
+func do(router http.Handler, path, ip string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.RemoteAddr = ip + ":1234"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestLimiter_Middleware(t *testing.T) {
+	l := New(NewInMemoryStore(), false)
+	// the start of a window, so the previous window has no weight left to account for
+	now := time.Unix(1700000040, 0)
+	l.now = func() time.Time { return now }
+	require.NoError(t, l.AddPolicy(DefaultPolicy, Policy{Limit: 2, Window: time.Minute}))
+	require.NoError(t, l.AddPolicy("reports", Policy{Limit: 1, Window: time.Minute}))
+
+	reports := endpoints.NewEndpoint("/", "/reports", "", ok)
+	reports.Group = "reports"
+	export := endpoints.NewEndpoint("/", "/export", "", ok)
+	export.RateLimit = "reports"
+	router := newRouter(t, l, endpoints.NewEndpoint("/", "/items", "", ok), reports, export)
+
+	w := do(router, "/items", "10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+	assert.Equal(t, http.StatusOK, do(router, "/items", "10.0.0.1").Code)
+
+	w = do(router, "/items", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	// the window ends in 60s, and half of its two requests slid out 30s later
+	assert.Equal(t, "90", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, do(router, "/items", "10.0.0.2").Code, "other ips have their own count")
+
+	// the group and the endpoint naming the group's policy share one count
+	assert.Equal(t, http.StatusOK, do(router, "/reports", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do(router, "/export", "10.0.0.1").Code)
+
+	// halfway into the next window half of the previous count still applies
+	now = now.Add(90 * time.Second)
+	assert.Equal(t, http.StatusOK, do(router, "/items", "10.0.0.1").Code)
+	w = do(router, "/items", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"), "until the previous window slid out")
+}
+
+func TestLimiter_PrincipalKey(t *testing.T) {
+	l := New(NewInMemoryStore(), false)
+	require.NoError(t, l.AddPolicy(DefaultPolicy, Policy{Limit: 1, Window: time.Hour, Key: KeyPrincipal}))
+	assert.Error(t, l.AddPolicy("bad", Policy{Limit: 1, Window: time.Hour, Key: "header"}))
+	router := newRouter(t, l, endpoints.NewEndpoint("/", "/items", "", ok))
+	withPrincipal := func(id string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{ID: id}))
+			router.ServeHTTP(w, r)
+		})
+	}
+
+	assert.Equal(t, http.StatusOK, do(withPrincipal("user-1"), "/items", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do(withPrincipal("user-1"), "/items", "10.0.0.2").Code)
+	assert.Equal(t, http.StatusOK, do(withPrincipal("user-2"), "/items", "10.0.0.1").Code)
+	// anonymous callers are counted by ip
+	assert.Equal(t, http.StatusOK, do(router, "/items", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do(router, "/items", "10.0.0.1").Code)
+}
+
+func TestLimiter_ForwardedFor(t *testing.T) {
+	for _, kind := range []string{KeyIP, KeyDevice} {
+		t.Run(kind, func(t *testing.T) {
+			l := New(NewInMemoryStore(), false)
+			require.NoError(t, l.AddPolicy(DefaultPolicy, Policy{Limit: 1, Window: time.Hour, Key: kind}))
+			proxies, err := device.NewTrustedProxies(0, "10.0.0.254")
+			require.NoError(t, err)
+			l.Proxies = proxies
+			router := newRouter(t, l, endpoints.NewEndpoint("/", "/items", "", ok))
+			forwarded := func(xff string) int {
+				r := httptest.NewRequest(http.MethodGet, "/items", nil)
+				r.RemoteAddr = "10.0.0.254:1234"
+				r.Header.Set("X-Forwarded-For", xff)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+				return w.Code
+			}
+
+			assert.Equal(t, http.StatusOK, forwarded("203.0.113.7"))
+			// entries written by the caller left of the proxy do not get a fresh count
+			assert.Equal(t, http.StatusTooManyRequests, forwarded("198.51.100.1, 203.0.113.7"))
+			assert.Equal(t, http.StatusOK, forwarded("203.0.113.8"))
+		})
+	}
+}
+
+func TestInMemoryStore_Sweep(t *testing.T) {
+	store := NewInMemoryStore()
+	now := time.Unix(1700000040, 0)
+	_, err := store.Take(context.Background(), "a", 1, time.Minute, now)
+	require.NoError(t, err)
+	_, err = store.Take(context.Background(), "b", 1, time.Minute, now.Add(3*time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, store.counters, 1)
+}
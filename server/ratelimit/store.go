@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Result is the state of a key after Take.
+type Result struct {
+	Allowed bool
+	// Previous and Current are the requests counted in the previous and current fixed window.
+	Previous int
+	Current  int
+}
+
+// Store counts requests per key in fixed windows of the policy's length. The limiter estimates
+// the sliding window from the current and the weighted previous window.
+type Store interface {
+	// Take counts a request against key in the window containing now, unless the sliding
+	// estimate would exceed limit.
+	Take(ctx context.Context, key string, limit int, window time.Duration, now time.Time) (Result, error)
+}
+
+// windowIndex returns the fixed window now falls in and how far into it now is.
+func windowIndex(window time.Duration, now time.Time) (int64, time.Duration) {
+	ms := window.Milliseconds()
+	if ms <= 0 {
+		ms = 1
+	}
+	at := now.UnixMilli()
+	return at / ms, time.Duration(at%ms) * time.Millisecond
+}
+
+// previousWeight is the share of the previous window still covered by the sliding window.
+func previousWeight(window, elapsed time.Duration) float64 {
+	if window <= 0 {
+		return 0
+	}
+	return 1 - float64(elapsed)/float64(window)
+}
+
+func estimate(previous, current int, weight float64) float64 {
+	return float64(previous)*weight + float64(current)
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var _ Store = &InMemoryStore{}
+
+type counter struct {
+	index    int64
+	previous int
+	current  int
+}
+
+// InMemoryStore keeps counters in a map. Limits are per instance, so it is meant for tests and
+// single instance services.
+type InMemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]*counter
+	// swept is the window index of the last removal of idle counters, per window length.
+	swept map[time.Duration]int64
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		counters: map[string]*counter{},
+		swept:    map[time.Duration]int64{},
+	}
+}
+
+func (m *InMemoryStore) Take(ctx context.Context, key string, limit int, window time.Duration, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	index, elapsed := windowIndex(window, now)
+	m.sweep(window, index)
+
+	c, found := m.counters[key]
+	if !found {
+		c = &counter{index: index}
+		m.counters[key] = c
+	}
+	switch {
+	case c.index == index-1:
+		c.previous, c.current = c.current, 0
+	case c.index < index-1:
+		c.previous, c.current = 0, 0
+	}
+	c.index = index
+
+	if estimate(c.previous, c.current+1, previousWeight(window, elapsed)) > float64(limit) {
+		return Result{Previous: c.previous, Current: c.current}, nil
+	}
+	c.current++
+	return Result{Allowed: true, Previous: c.previous, Current: c.current}, nil
+}
+
+// sweep drops counters idle for two windows, once per window. Keys embed the policy, so a key
+// is always taken with the same window length.
+func (m *InMemoryStore) sweep(window time.Duration, index int64) {
+	if m.swept[window] == index {
+		return
+	}
+	m.swept[window] = index
+	for key, c := range m.counters {
+		if c.index < index-1 {
+			delete(m.counters, key)
+		}
+	}
+}
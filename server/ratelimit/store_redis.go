@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var _ Store = &RedisStore{}
+
+// takeScript checks the sliding estimate and counts the request in one step, so concurrent
+// instances cannot both take the last slot.
+var takeScript = redis.NewScript(`
+local previous = tonumber(redis.call("GET", KEYS[1]) or "0")
+local current = tonumber(redis.call("GET", KEYS[2]) or "0")
+if previous * tonumber(ARGV[3]) + current + 1 > tonumber(ARGV[1]) then
+	return {0, previous, current}
+end
+current = redis.call("INCR", KEYS[2])
+if current == 1 then
+	redis.call("PEXPIRE", KEYS[2], ARGV[2])
+end
+return {1, previous, current}
+`)
+
+// RedisStore keeps one counter per key and window, so every instance behind a load balancer
+// shares the same limits.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "ratelimit"
+	}
+	return &RedisStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (r *RedisStore) windowKey(key string, index int64) string {
+	return fmt.Sprintf("%s:%s:%d", r.prefix, key, index)
+}
+
+func (r *RedisStore) Take(ctx context.Context, key string, limit int, window time.Duration, now time.Time) (Result, error) {
+	index, elapsed := windowIndex(window, now)
+	keys := []string{r.windowKey(key, index-1), r.windowKey(key, index)}
+	// a window is read as the previous one until the end of the next
+	ttl := 2 * window.Milliseconds()
+	weight := strconv.FormatFloat(previousWeight(window, elapsed), 'f', -1, 64)
+	values, err := takeScript.Run(ctx, r.client, keys, limit, ttl, weight).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed taking rate limit: %w", err)
+	}
+	if len(values) != 3 {
+		return Result{}, fmt.Errorf("failed taking rate limit: unexpected reply %v", values)
+	}
+	return Result{
+		Allowed:  values[0] == 1,
+		Previous: int(values[1]),
+		Current:  int(values[2]),
+	}, nil
+}
@@ -2,10 +2,16 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
 	"github.com/Seann-Moser/go-serve/pkg/metrics"
+	"github.com/Seann-Moser/go-serve/server/admin"
+	"github.com/Seann-Moser/go-serve/server/apikey"
+	"github.com/Seann-Moser/go-serve/server/auth"
+	"github.com/Seann-Moser/go-serve/server/compression"
+	"github.com/Seann-Moser/go-serve/server/csrf"
 	"github.com/Seann-Moser/go-serve/server/middle"
 	"golang.org/x/sync/errgroup"
 	"net"
@@ -13,6 +19,7 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -28,6 +35,13 @@ import (
 
 	"github.com/Seann-Moser/go-serve/server/endpoint_manager"
 	"github.com/Seann-Moser/go-serve/server/endpoints"
+	"github.com/Seann-Moser/go-serve/server/handlers"
+	"github.com/Seann-Moser/go-serve/server/lifecycle"
+	"github.com/Seann-Moser/go-serve/server/mfa"
+	"github.com/Seann-Moser/go-serve/server/mtls"
+	"github.com/Seann-Moser/go-serve/server/ratelimit"
+	"github.com/Seann-Moser/go-serve/server/shedding"
+	"github.com/Seann-Moser/go-serve/server/tlsconfig"
 )
 
 var VERSION = "dev"
@@ -47,6 +61,35 @@ type Server struct {
 	requestTracker   *middle.RequestTracker
 	shutdown         func()
 	server           *http.Server
+	registrars       []EndpointRegistrar
+	listeners        []*Listener
+
+	// H2C serves HTTP/2 without TLS on the serving port and unix socket.
+	H2C bool
+	// UnixSocket is a socket path served in addition to the serving port.
+	UnixSocket        string
+	UnixSocketMode    os.FileMode
+	UnixSocketCleanup bool
+
+	// TLSConfig makes the server serve https. It must provide the server certificate through
+	// Certificates or GetCertificate.
+	TLSConfig *tls.Config
+	tls       *tlsconfig.TLS
+
+	// Lifecycle runs start hooks before the listeners open and stop hooks once in-flight requests
+	// finished, e.g. closing a DAO or PubSub.
+	Lifecycle *lifecycle.Manager
+	// Probes backs /livez, /readyz and /startupz, see AddProbes.
+	Probes *handlers.Probes
+	// ReadinessDrain is how long the server keeps serving after readiness started failing on
+	// shutdown, giving load balancers time to stop routing to it.
+	ReadinessDrain time.Duration
+}
+
+// EndpointRegistrar is told about every endpoint added to the server, for middlewares that read
+// per endpoint options such as Endpoint.SkipCSRF or Endpoint.Roles.
+type EndpointRegistrar interface {
+	Register(eps ...*endpoints.Endpoint)
 }
 
 const (
@@ -54,6 +97,14 @@ const (
 	serverPrefixFlag           = "server-path-prefix"
 	serverMaxReceivedBytesFlag = "server-max-bytes"
 	serverShowErrFlag          = "server-show-err"
+	serverH2CFlag              = "server-h2c"
+	serverUnixSocketFlag       = "server-unix-socket"
+	serverUnixSocketModeFlag   = "server-unix-socket-mode"
+	serverUnixSocketClean      = "server-unix-socket-cleanup"
+	serverReadinessDrainFlag   = "server-readiness-drain"
+	serverProbeTimeoutFlag     = "server-probe-timeout"
+
+	defaultProbeTimeout = 5 * time.Second
 )
 
 func Flags() *pflag.FlagSet {
@@ -62,28 +113,48 @@ func Flags() *pflag.FlagSet {
 	fs.String(serverPrefixFlag, "", "")
 	fs.Int64(serverMaxReceivedBytesFlag, int64(20*1024*1024), "")
 	fs.Bool(serverShowErrFlag, false, "")
+	fs.Bool(serverH2CFlag, false, "serve HTTP/2 without TLS (h2c) for proxies that support it")
+	fs.String(serverUnixSocketFlag, "", "unix socket path served in addition to the port")
+	fs.String(serverUnixSocketModeFlag, "0660", "octal file mode of the unix socket")
+	fs.Bool(serverUnixSocketClean, true, "remove a stale unix socket before binding and the socket on shutdown")
+	fs.Duration(serverReadinessDrainFlag, 5*time.Second, "time between readiness failing and the server shutting down")
+	fs.Duration(serverProbeTimeoutFlag, defaultProbeTimeout, "time the checks and pings of a probe or health check may take")
 	fs.Duration("shutdown-duration", 15*time.Second, "duration to wait before shutting down the server")
 	fs.AddFlagSet(metrics.MetricFlags())
 	return fs
 }
 
 func New(ctx context.Context) *Server {
-	return NewServer(ctx,
+	s := NewServer(ctx,
 		viper.GetString(serverPortFlag),
 		viper.GetString(serverPrefixFlag),
 		viper.GetInt64(serverMaxReceivedBytesFlag),
 		viper.GetBool(serverShowErrFlag),
 		viper.GetDuration("shutdown-duration"))
+	s.H2C = viper.GetBool(serverH2CFlag)
+	s.ReadinessDrain = viper.GetDuration(serverReadinessDrainFlag)
+	s.Probes.Timeout = viper.GetDuration(serverProbeTimeoutFlag)
+	s.UnixSocket = viper.GetString(serverUnixSocketFlag)
+	s.UnixSocketCleanup = viper.GetBool(serverUnixSocketClean)
+	if mode, err := strconv.ParseUint(viper.GetString(serverUnixSocketModeFlag), 8, 32); err == nil {
+		s.UnixSocketMode = os.FileMode(mode)
+	} else {
+		ctxLogger.Warn(ctx, "invalid unix socket mode, keeping the default", zap.Error(err))
+	}
+	return s
 }
 
 func NewServer(ctx context.Context, servingPort string, pathPrefix string, mb int64, showErr bool, shutdownDuration time.Duration) *Server {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 	notifyContext, cancel := context.WithCancel(ctx)
+	probes := handlers.NewProbes(defaultProbeTimeout)
 	go func() {
 		osCall := <-c
 		println("starting shutdown")
 		ctxLogger.Info(ctx, fmt.Sprintf("system call:%+v", osCall))
+		// readiness fails before anything else so load balancers stop routing here first
+		probes.Drain()
 		cancel()
 	}()
 
@@ -99,27 +170,34 @@ func NewServer(ctx context.Context, servingPort string, pathPrefix string, mb in
 	if NAME != "dev" {
 		m.Name = NAME
 	}
+	router.Use(middle.RequestID)
 	router.Use(func(handler http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if strings.EqualFold(r.URL.Path, "/healthcheck") {
-				w.WriteHeader(http.StatusOK)
+			if strings.EqualFold(r.URL.Path, "/healthcheck") && probes.Draining() {
+				w.WriteHeader(http.StatusServiceUnavailable)
 				return
 			}
 			handler.ServeHTTP(w, r)
 		})
 	})
+	// recovers panics from the middlewares added after it; handlers are also wrapped
+	// inside their otel span below
+	recoverer := middle.NewRecoverer(response.NewResponse(showErr))
+	router.Use(recoverer.Middleware)
 	requestTracker := middle.NewRequestTracker()
-	router.Use()
-	if m.Enabled {
-		router.Use(requestTracker.TrackMiddleware)
-	}
+	router.Use(requestTracker.TrackMiddleware)
+	lc := lifecycle.New(10 * time.Second)
+	// added first so it runs after every other stop hook
+	lc.OnStop("otel-flush", 5*time.Second, lifecycle.FlushOTel)
 	serverCtx, cancelRoute := context.WithCancel(ctx)
+	endpointManager := endpoint_manager.NewManager(router)
+	endpointManager.HandlerMiddleware = append(endpointManager.HandlerMiddleware, recoverer.Middleware)
 	return &Server{
 		ServingPort:      servingPort,
 		serverCtx:        notifyContext,
 		ctx:              serverCtx,
 		router:           router,
-		EndpointManager:  endpoint_manager.NewManager(router),
+		EndpointManager:  endpointManager,
 		Response:         response.NewResponse(showErr),
 		Request:          request.NewRequest(mb),
 		PathPrefix:       pathPrefix,
@@ -127,6 +205,8 @@ func NewServer(ctx context.Context, servingPort string, pathPrefix string, mb in
 		shutdownDuration: shutdownDuration,
 		shutdown:         cancelRoute,
 		requestTracker:   requestTracker,
+		Probes:           probes,
+		Lifecycle:        lc,
 	}
 }
 
@@ -155,10 +235,119 @@ func (s *Server) AddEndpoints(ctx context.Context, endpoint ...*endpoints.Endpoi
 		if err != nil {
 			return fmt.Errorf("failed adding endpoint: %w", err)
 		}
+		for _, registrar := range s.registrars {
+			registrar.Register(e)
+		}
 	}
 	return nil
 }
 
+// AddCSRF enables csrf protection for every endpoint without SkipCSRF and serves the token
+// endpoint. Call it before AddEndpoints so opted out endpoints are registered.
+func (s *Server) AddCSRF(ctx context.Context, c *csrf.CSRF) error {
+	s.registrars = append(s.registrars, c)
+	s.router.Use(c.Middleware)
+	return s.AddEndpoints(ctx, c.Endpoint(""))
+}
+
+// AddAuth authenticates every request with the chain. Endpoints added afterwards are registered
+// with it, so Endpoint.Public and the endpoint options read by its authenticators apply.
+func (s *Server) AddAuth(chain *auth.Chain) {
+	s.registrars = append(s.registrars, chain)
+	s.router.Use(chain.Middleware)
+}
+
+// AddAPIKeys enables api key authentication. Key scopes are checked against the Roles of
+// endpoints added afterwards; add the admin endpoints with m.Endpoints.
+func (s *Server) AddAPIKeys(m *apikey.Middleware) {
+	s.registrars = append(s.registrars, m)
+	s.router.Use(m.AuthMiddleware)
+}
+
+// AddMFA enforces Endpoint.RequireMFA on endpoints added afterwards and serves the enrollment and
+// verification endpoints. Call it after AddAuth so the principal is set when the step-up check
+// runs.
+func (s *Server) AddMFA(ctx context.Context, m *mfa.Manager) error {
+	s.registrars = append(s.registrars, m)
+	s.router.Use(m.Middleware)
+	return s.AddEndpoints(ctx, m.Endpoints("/")...)
+}
+
+// AddMTLS verifies client certificates on the serving listener and enforces
+// Endpoint.RequireClientCert on endpoints added afterwards. Add m.Authenticator to the auth chain
+// to map certificates to principals.
+func (s *Server) AddMTLS(m *mtls.MTLS) {
+	s.TLSConfig = m.TLSConfig(s.TLSConfig)
+	s.registrars = append(s.registrars, m)
+	s.router.Use(m.Middleware)
+}
+
+// AddRateLimit limits endpoints added afterwards by their policy. Call it after AddAuth and
+// AddAPIKeys so principal and api key policies see the caller.
+func (s *Server) AddRateLimit(l *ratelimit.Limiter) {
+	s.registrars = append(s.registrars, l)
+	s.router.Use(l.Middleware)
+}
+
+// AddCompression compresses responses of endpoints added afterwards unless they set
+// SkipCompression.
+func (s *Server) AddCompression(c *compression.Compressor) {
+	s.registrars = append(s.registrars, c)
+	s.router.Use(c.Middleware)
+}
+
+// AddLoadShedding sheds requests to endpoints added afterwards once sh's concurrency limit is
+// reached, by their Priority.
+func (s *Server) AddLoadShedding(sh *shedding.Shedder) {
+	s.registrars = append(s.registrars, sh)
+	s.router.Use(sh.Middleware)
+}
+
+// AddTLS serves https with the reloading certificate and protocol policy of t, sets HSTS on
+// responses, and adds t's redirect listener, which shuts down together with the server.
+func (s *Server) AddTLS(t *tlsconfig.TLS) {
+	s.tls = t
+	s.TLSConfig = t.Apply(s.TLSConfig)
+	s.router.Use(t.HSTSMiddleware)
+	if t.RedirectPort != "" {
+		s.AddListener(&Listener{
+			Name:              "https-redirect",
+			Address:           ":" + t.RedirectPort,
+			Handler:           tlsconfig.RedirectHandler(s.ServingPort),
+			ReadHeaderTimeout: 10 * time.Second,
+		})
+	}
+}
+
+// AddAdmin serves a on its own port when a.Port is set. Call it before AddEndpoints so the routes
+// dump covers every endpoint.
+func (s *Server) AddAdmin(a *admin.Admin) {
+	if a.Port == "" {
+		return
+	}
+	if a.Name == "" {
+		a.Name = s.MetricsServer.Name
+	}
+	if a.Version == "" {
+		a.Version = s.MetricsServer.Version
+	}
+	a.Tracker = s.requestTracker
+	s.registrars = append(s.registrars, a)
+	s.AddListener(&Listener{Name: "admin", Address: a.Address(), Handler: a.Handler()})
+}
+
+// AddProbes serves /livez, /readyz and /startupz. Register checks on s.Probes; pings added with
+// AttachPubSub are part of readiness.
+func (s *Server) AddProbes(ctx context.Context) error {
+	return s.AddEndpoints(ctx, s.Probes.Endpoints("/")...)
+}
+
+// AttachPubSub adds the Ping of a PubSub (or any other handlers.Pinger) to the readiness probe
+// and the health check returned by s.Probes.HealthCheck.
+func (s *Server) AttachPubSub(name string, pubsub handlers.Pinger) {
+	s.Probes.AddPing(name, handlers.PingFromPinger(pubsub, s.Probes.Timeout))
+}
+
 func (s *Server) AddMiddleware(middlewareFunc ...mux.MiddlewareFunc) {
 	s.router.Use(middlewareFunc...)
 }
@@ -166,14 +355,17 @@ func (s *Server) AddMiddleware(middlewareFunc ...mux.MiddlewareFunc) {
 func (s *Server) Start(ctx context.Context) error {
 	eg, errCtx := errgroup.WithContext(ctx)
 	if s.MetricsServer.Enabled {
+		// the metrics server stops with the main server, flushing the otel providers
+		metricsCtx, stopMetrics := context.WithCancel(errCtx)
 		eg.Go(func() error {
-			err := s.MetricsServer.StartServer(errCtx)
+			err := s.MetricsServer.StartServer(metricsCtx)
 			if err != nil {
 				return err
 			}
 			return nil
 		})
 		eg.Go(func() error {
+			defer stopMetrics()
 			err := s.StartServer(errCtx)
 			if err != nil {
 				return err
@@ -189,7 +381,8 @@ func (s *Server) ConfigureServer(ctx context.Context) *http.Server {
 	s.server = &http.Server{
 		Addr: ":" + s.ServingPort,
 
-		Handler: s.router,
+		Handler:   s.router,
+		TLSConfig: s.TLSConfig,
 		BaseContext: func(_ net.Listener) context.Context {
 			return ctxLogger.ConfigureCtx(ctxLogger.GetLogger(ctx), ctx)
 		},
@@ -204,39 +397,68 @@ func (s *Server) StartServer(ctx context.Context) error {
 		server = s.server
 	} else {
 		server = &http.Server{
-			Addr:    ":" + s.ServingPort,
-			Handler: s.router,
+			Addr:      ":" + s.ServingPort,
+			Handler:   s.router,
+			TLSConfig: s.TLSConfig,
 			BaseContext: func(_ net.Listener) context.Context {
 				return ctxLogger.ConfigureCtx(ctxLogger.GetLogger(ctx), ctx)
 			},
 		}
 	}
 
-	go func() {
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			ctxLogger.Error(ctx, "failed creating server", zap.Error(err))
-		}
-	}()
-	ctxLogger.Info(ctx, "staring server", zap.String("address", server.Addr), zap.String("port", s.ServingPort), zap.String("prefix", s.PathPrefix))
+	if _, err := s.Lifecycle.Start(ctx); err != nil {
+		// stop what the hooks before the failing one started
+		_, stopErr := s.Lifecycle.Stop(context.Background())
+		return errors.Join(err, stopErr)
+	}
+	bound, err := s.bind(ctx, server)
+	if err != nil {
+		_, stopErr := s.Lifecycle.Stop(context.Background())
+		return errors.Join(err, stopErr)
+	}
+	if s.tls != nil {
+		s.tls.Run(s.serverCtx)
+	}
+	for _, b := range bound {
+		go b.serve(ctx)
+		ctxLogger.Info(ctx, "staring server", zap.String("listener", b.name), zap.String("address", b.listener.Addr().String()), zap.String("prefix", s.PathPrefix))
+	}
+	s.Probes.MarkStarted()
 	<-s.serverCtx.Done()
+	s.Probes.Drain()
+	if s.ReadinessDrain > 0 {
+		ctxLogger.Info(ctx, "draining before shutdown", zap.Duration("duration", s.ReadinessDrain))
+		time.Sleep(s.ReadinessDrain)
+	}
 	ctxLogger.Info(ctx, "server shutting down")
 	ctxShutDown, cancel := context.WithTimeout(context.Background(), s.shutdownDuration)
 	defer func() {
 		cancel()
 	}()
-	if err := server.Shutdown(ctxShutDown); err != nil {
-		ctxLogger.Error(ctx, "server Shutdown Failed", zap.Error(err))
-		return err
+	eg := errgroup.Group{}
+	for _, b := range bound {
+		eg.Go(func() error {
+			if err := b.server.Shutdown(ctxShutDown); err != nil {
+				ctxLogger.Error(ctx, "server Shutdown Failed", zap.String("listener", b.name), zap.Error(err))
+				return err
+			}
+			return nil
+		})
 	}
-	<-time.NewTicker(s.shutdownDuration).C
+	shutdownErr := eg.Wait()
 
-	select {
-	case <-ctxShutDown.Done():
-		s.shutdown()
-	case <-s.requestTracker.Done(s.ctx):
-		s.shutdown()
+	// Shutdown returns once connections are idle, hijacked connections are still counted by the
+	// request tracker; either way this returns as soon as nothing is in flight
+	<-s.requestTracker.Done(ctxShutDown)
+	if inFlight := s.requestTracker.InFlight(); inFlight > 0 {
+		ctxLogger.Warn(ctx, "shutdown timed out with requests in flight", zap.Int64("in_flight", inFlight))
 	}
+	s.shutdown()
 
+	_, stopErr := s.Lifecycle.Stop(context.Background())
+	if err := errors.Join(shutdownErr, stopErr); err != nil {
+		return err
+	}
 	ctxLogger.Info(ctx, "server exited properly")
 	return nil
 
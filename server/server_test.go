@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Seann-Moser/go-serve/server/handlers"
+)
+
+func TestServer_ShutdownReturnsWhenIdle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewServer(ctx, "0", "", 1024, false, 10*time.Second)
+	var stopped []string
+	s.Lifecycle.OnStop("db", time.Second, func(ctx context.Context) error {
+		stopped = append(stopped, "db")
+		return nil
+	})
+	s.Lifecycle.OnStop("consumer", time.Second, func(ctx context.Context) error {
+		stopped = append(stopped, "consumer")
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- s.StartServer(ctx) }()
+	require.Eventually(t, func() bool { return s.Probes.Run(ctx, handlers.ProbeStartup).Healthy }, time.Second, 10*time.Millisecond)
+
+	start := time.Now()
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown waited for the shutdown duration")
+	}
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, []string{"consumer", "db"}, stopped)
+}
+
+func TestServer_StartFailureStops(t *testing.T) {
+	ctx := context.Background()
+	s := NewServer(ctx, "0", "", 1024, false, 10*time.Second)
+	var stopped []string
+	s.Lifecycle.OnStart("db", time.Second, func(ctx context.Context) error { return nil })
+	s.Lifecycle.OnStop("db", time.Second, func(ctx context.Context) error {
+		stopped = append(stopped, "db")
+		return nil
+	})
+	s.Lifecycle.OnStart("consumer", time.Second, func(ctx context.Context) error { return assert.AnError })
+
+	err := s.StartServer(ctx)
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, []string{"db"}, stopped)
+}
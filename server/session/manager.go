@@ -0,0 +1,294 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/response"
+	"github.com/Seann-Moser/go-serve/server/auth"
+	"github.com/Seann-Moser/go-serve/server/device"
+)
+
+const (
+	sessionCookieNameFlag    = "session-cookie-name"
+	sessionIdleTimeoutFlag   = "session-idle-timeout"
+	sessionMaxLifetimeFlag   = "session-max-lifetime"
+	sessionTouchIntervalFlag = "session-touch-interval"
+	sessionSecureCookieFlag  = "session-secure-cookie"
+	sessionCookieDomainFlag  = "session-cookie-domain"
+	sessionShowErrFlag       = "session-show-err"
+
+	// AuthMethod is the Principal.Method set for session authenticated callers.
+	AuthMethod = "session"
+)
+
+func Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("session", pflag.ExitOnError)
+	fs.String(sessionCookieNameFlag, "session_id", "name of the session id cookie")
+	fs.Duration(sessionIdleTimeoutFlag, 24*time.Hour, "session expires after this long without requests")
+	fs.Duration(sessionMaxLifetimeFlag, 30*24*time.Hour, "session expires this long after login regardless of activity")
+	fs.Duration(sessionTouchIntervalFlag, time.Minute, "minimum time between expiry extensions of a session")
+	fs.Bool(sessionSecureCookieFlag, true, "only send the session cookie over https")
+	fs.String(sessionCookieDomainFlag, "", "domain of the session cookie")
+	fs.Bool(sessionShowErrFlag, false, "return error in http response(not secure)")
+	return fs
+}
+
+// Manager issues opaque session id cookies backed by a Store. Sessions slide: every request
+// moves the expiry IdleTimeout into the future, capped at MaxLifetime after creation.
+type Manager struct {
+	Store         Store
+	CookieName    string
+	IdleTimeout   time.Duration
+	MaxLifetime   time.Duration
+	TouchInterval time.Duration
+	Secure        bool
+	Domain        string
+	Path          string
+	Response      *response.Response
+	// SkipDeviceValidation stops the auth chain from checking session callers with
+	// AuthFunctions.ValidDevice. By default every session caller is checked.
+	SkipDeviceValidation bool
+	authFunctions        auth.AuthFunctions
+}
+
+func NewFromFlags(store Store, authFunctions auth.AuthFunctions) *Manager {
+	m := New(store, viper.GetBool(sessionShowErrFlag), authFunctions)
+	m.CookieName = viper.GetString(sessionCookieNameFlag)
+	m.IdleTimeout = viper.GetDuration(sessionIdleTimeoutFlag)
+	m.MaxLifetime = viper.GetDuration(sessionMaxLifetimeFlag)
+	m.TouchInterval = viper.GetDuration(sessionTouchIntervalFlag)
+	m.Secure = viper.GetBool(sessionSecureCookieFlag)
+	m.Domain = viper.GetString(sessionCookieDomainFlag)
+	return m
+}
+
+func New(store Store, showError bool, authFunctions auth.AuthFunctions) *Manager {
+	return &Manager{
+		Store:         store,
+		CookieName:    "session_id",
+		IdleTimeout:   24 * time.Hour,
+		MaxLifetime:   30 * 24 * time.Hour,
+		TouchInterval: time.Minute,
+		Secure:        true,
+		Path:          "/",
+		Response:      response.NewResponse(showError),
+		authFunctions: authFunctions,
+	}
+}
+
+// Create starts a session for the user and sets the session cookie.
+func (m *Manager) Create(w http.ResponseWriter, r *http.Request, userID, key string) (*Session, error) {
+	id, err := NewID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	s := &Session{
+		ID:         id,
+		UserID:     userID,
+		Key:        key,
+		DeviceID:   device.GetDeviceFromRequest(r).GenerateDeviceKey(""),
+		CreatedAt:  now.Unix(),
+		LastSeenAt: now.Unix(),
+	}
+	s.ExpiresAt = m.expiry(s, now).Unix()
+	if err := m.Store.Create(r.Context(), s); err != nil {
+		return nil, fmt.Errorf("failed creating session: %w", err)
+	}
+	m.setCookie(w, s)
+	return s, nil
+}
+
+// Load returns the session named by the request cookie.
+func (m *Manager) Load(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(m.CookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, ErrNotFound
+	}
+	return m.Store.Get(r.Context(), cookie.Value)
+}
+
+// Rotate replaces the session id while keeping its data, and sets the new cookie. Call it
+// whenever the privileges of the session change, e.g. after login or step-up, so an id
+// captured before the change is worthless.
+func (m *Manager) Rotate(w http.ResponseWriter, r *http.Request, s *Session) (*Session, error) {
+	id, err := NewID()
+	if err != nil {
+		return nil, err
+	}
+	rotated := *s
+	rotated.ID = id
+	rotated.LastSeenAt = time.Now().Unix()
+	if err := m.Store.Create(r.Context(), &rotated); err != nil {
+		return nil, fmt.Errorf("failed rotating session: %w", err)
+	}
+	if err := m.Store.Delete(r.Context(), s.ID); err != nil {
+		return nil, fmt.Errorf("failed removing rotated session: %w", err)
+	}
+	m.setCookie(w, &rotated)
+	return &rotated, nil
+}
+
+// SetMFAPending marks a new login as waiting for its second factor. Call it right after Create
+// for users with mfa enrolled; until MarkMFAVerified the mfa middleware only lets the session
+// reach public endpoints and endpoints that set AllowMFAPending.
+func (m *Manager) SetMFAPending(ctx context.Context, s *Session) error {
+	s.MFAPending = true
+	if err := m.Store.Update(ctx, s); err != nil {
+		return fmt.Errorf("failed marking session mfa pending: %w", err)
+	}
+	return nil
+}
+
+// MarkMFAVerified records that the current session passed a second factor and rotates it, since
+// its privileges grew. It fits mfa.Manager.OnVerified.
+func (m *Manager) MarkMFAVerified(w http.ResponseWriter, r *http.Request) error {
+	s, err := m.Load(r)
+	if err != nil {
+		return fmt.Errorf("failed loading session: %w", err)
+	}
+	s.MFAVerifiedAt = time.Now().Unix()
+	s.MFAPending = false
+	if _, err := m.Rotate(w, r, s); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Destroy revokes the current session and clears the cookie.
+func (m *Manager) Destroy(w http.ResponseWriter, r *http.Request) error {
+	m.clearCookie(w)
+	cookie, err := r.Cookie(m.CookieName)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	return m.Store.Delete(r.Context(), cookie.Value)
+}
+
+// List returns the active sessions of a user.
+func (m *Manager) List(ctx context.Context, userID string) ([]*Session, error) {
+	return m.Store.ListByUser(ctx, userID)
+}
+
+// Revoke ends a single session.
+func (m *Manager) Revoke(ctx context.Context, id string) error {
+	return m.Store.Delete(ctx, id)
+}
+
+// RevokeUser ends every session of a user.
+func (m *Manager) RevokeUser(ctx context.Context, userID string) error {
+	return m.Store.DeleteByUser(ctx, userID)
+}
+
+// Middleware loads the session, slides its expiry, and stores it and its auth.Principal in the
+// request context. The principal is then checked with the same AuthFunctions the cookie
+// middleware uses; requests without a valid session are checked as an anonymous caller.
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return auth.NewChain(m.Response, m.authFunctions, m.Authenticator()).Middleware(next)
+}
+
+var (
+	_ auth.Authenticator = &sessionAuthenticator{}
+	_ auth.DeviceBinder  = &sessionAuthenticator{}
+)
+
+type sessionAuthenticator struct {
+	m *Manager
+}
+
+// Authenticator returns the auth.Authenticator for the session cookie.
+func (m *Manager) Authenticator() auth.Authenticator {
+	return &sessionAuthenticator{m: m}
+}
+
+func (a *sessionAuthenticator) Authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
+	s, err := a.m.Load(r)
+	if errors.Is(err, ErrNotFound) {
+		if _, cookieErr := r.Cookie(a.m.CookieName); cookieErr == nil {
+			a.m.clearCookie(w)
+		}
+		return r, auth.ErrNoCredentials
+	}
+	if err != nil {
+		return r, fmt.Errorf("failed loading session: %w", err)
+	}
+	s = a.m.touch(r.Context(), w, s)
+	principal := &auth.Principal{
+		ID:         s.UserID,
+		Key:        s.Key,
+		DeviceID:   s.DeviceID,
+		Method:     AuthMethod,
+		MFAPending: s.MFAPending,
+	}
+	if s.MFAVerifiedAt > 0 {
+		principal.MFAVerifiedAt = time.Unix(s.MFAVerifiedAt, 0)
+	}
+	return r.WithContext(auth.WithPrincipal(WithSession(r.Context(), s), principal)), nil
+}
+
+func (a *sessionAuthenticator) BindsDevice() bool {
+	return !a.m.SkipDeviceValidation
+}
+
+// touch extends the session expiry at most once per TouchInterval to limit store writes.
+func (m *Manager) touch(ctx context.Context, w http.ResponseWriter, s *Session) *Session {
+	now := time.Now()
+	if now.Sub(time.Unix(s.LastSeenAt, 0)) < m.TouchInterval {
+		return s
+	}
+	s.LastSeenAt = now.Unix()
+	s.ExpiresAt = m.expiry(s, now).Unix()
+	if err := m.Store.Update(ctx, s); err != nil {
+		ctxLogger.Warn(ctx, "failed extending session", zap.Error(err))
+		return s
+	}
+	m.setCookie(w, s)
+	return s
+}
+
+func (m *Manager) expiry(s *Session, now time.Time) time.Time {
+	expires := now.Add(m.IdleTimeout)
+	if m.MaxLifetime > 0 {
+		if limit := time.Unix(s.CreatedAt, 0).Add(m.MaxLifetime); expires.After(limit) {
+			expires = limit
+		}
+	}
+	return expires
+}
+
+func (m *Manager) setCookie(w http.ResponseWriter, s *Session) {
+	cookie := &http.Cookie{
+		Name:     m.CookieName,
+		Value:    s.ID,
+		Path:     m.Path,
+		Domain:   m.Domain,
+		Expires:  time.Unix(s.ExpiresAt, 0),
+		MaxAge:   int(time.Until(time.Unix(s.ExpiresAt, 0)).Seconds()),
+		Secure:   m.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, cookie)
+}
+
+func (m *Manager) clearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.CookieName,
+		Value:    "",
+		Path:     m.Path,
+		Domain:   m.Domain,
+		MaxAge:   -1,
+		Secure:   m.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
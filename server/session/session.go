@@ -0,0 +1,63 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("session not found")
+
+// Session is a server-side login. Only ID is sent to the client.
+type Session struct {
+	ID         string `db:"id" json:"id" qc:"primary;data_type::varchar(64);where::="`
+	UserID     string `db:"user_id" json:"user_id" qc:"data_type::varchar(256);where::="`
+	Key        string `db:"session_key" json:"session_key" qc:"data_type::varchar(256);update"`
+	DeviceID   string `db:"device_id" json:"device_id" qc:"data_type::varchar(256)"`
+	Data       string `db:"data" json:"data" qc:"data_type::text;update"`
+	CreatedAt  int64  `db:"created_at" json:"created_at" qc:"data_type::bigint"`
+	LastSeenAt int64  `db:"last_seen_at" json:"last_seen_at" qc:"data_type::bigint;update"`
+	ExpiresAt  int64  `db:"expires_at" json:"expires_at" qc:"data_type::bigint;update;where::>"`
+	// MFAVerifiedAt is when the login last passed a second factor, 0 if it has not.
+	MFAVerifiedAt int64 `db:"mfa_verified_at" json:"mfa_verified_at" qc:"data_type::bigint;update"`
+	// MFAPending is set while the login still owes its second factor, see Manager.SetMFAPending.
+	MFAPending bool `db:"mfa_pending" json:"mfa_pending" qc:"default::false;update"`
+}
+
+// Expired reports whether the session is past its expiry at now.
+func (s *Session) Expired(now time.Time) bool {
+	return s.ExpiresAt <= now.Unix()
+}
+
+// Store persists sessions. Get returns ErrNotFound for unknown and expired sessions.
+type Store interface {
+	Create(ctx context.Context, s *Session) error
+	Get(ctx context.Context, id string) (*Session, error)
+	Update(ctx context.Context, s *Session) error
+	Delete(ctx context.Context, id string) error
+	ListByUser(ctx context.Context, userID string) ([]*Session, error)
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+const sessionContextKey = "go-serve-session"
+
+func WithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey, s) //nolint:staticcheck
+}
+
+// FromContext returns the session loaded by Manager.Middleware.
+func FromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(sessionContextKey).(*Session)
+	return s, ok && s != nil
+}
+
+// NewID returns a random opaque session id.
+func NewID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
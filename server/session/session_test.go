@@ -0,0 +1,167 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Seann-Moser/go-serve/server/auth"
+)
+
+func sessionCookie(t *testing.T, rr *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("cookie %s not set", name)
+	return nil
+}
+
+func TestManager_CreateAndMiddleware(t *testing.T) {
+	m := New(NewInMemoryStore(), false, nil)
+
+	rr := httptest.NewRecorder()
+	s, err := m.Create(rr, httptest.NewRequest(http.MethodPost, "/login", nil), "user-1", "key-1")
+	require.NoError(t, err)
+	cookie := sessionCookie(t, rr, m.CookieName)
+	assert.Equal(t, s.ID, cookie.Value)
+	assert.True(t, cookie.HttpOnly)
+
+	var principal *auth.Principal
+	var loaded *Session
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = auth.GetPrincipal(r.Context())
+		loaded, _ = FromContext(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.NotNil(t, principal)
+	assert.Equal(t, "user-1", principal.ID)
+	assert.Equal(t, AuthMethod, principal.Method)
+	require.NotNil(t, loaded)
+	assert.Equal(t, s.ID, loaded.ID)
+}
+
+func TestManager_SlidingExpiry(t *testing.T) {
+	store := NewInMemoryStore()
+	m := New(store, false, nil)
+	m.IdleTimeout = time.Hour
+	m.MaxLifetime = 90 * time.Minute
+	m.TouchInterval = 0
+
+	s, err := m.Create(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/login", nil), "user-1", "")
+	require.NoError(t, err)
+
+	// pretend the session was created an hour ago and last used 30 minutes ago
+	s.CreatedAt = time.Now().Add(-time.Hour).Unix()
+	s.LastSeenAt = time.Now().Add(-30 * time.Minute).Unix()
+	s.ExpiresAt = time.Now().Add(30 * time.Minute).Unix()
+	require.NoError(t, store.Update(context.Background(), s))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: m.CookieName, Value: s.ID})
+	m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), req)
+
+	updated, err := store.Get(context.Background(), s.ID)
+	require.NoError(t, err)
+	// extended by the idle timeout but capped at the max lifetime
+	assert.InDelta(t, time.Now().Add(30*time.Minute).Unix(), updated.ExpiresAt, 2)
+	assert.Greater(t, updated.LastSeenAt, s.LastSeenAt)
+}
+
+func TestManager_RotateAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	m := New(NewInMemoryStore(), false, nil)
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+
+	first, err := m.Create(httptest.NewRecorder(), req, "user-1", "")
+	require.NoError(t, err)
+	second, err := m.Create(httptest.NewRecorder(), req, "user-1", "")
+	require.NoError(t, err)
+	_, err = m.Create(httptest.NewRecorder(), req, "user-2", "")
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	rotated, err := m.Rotate(rr, req, first)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, rotated.ID)
+	assert.Equal(t, rotated.ID, sessionCookie(t, rr, m.CookieName).Value)
+	_, err = m.Store.Get(ctx, first.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	sessions, err := m.List(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	require.NoError(t, m.Revoke(ctx, second.ID))
+	sessions, err = m.List(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+
+	require.NoError(t, m.RevokeUser(ctx, "user-1"))
+	sessions, err = m.List(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+	sessions, err = m.List(ctx, "user-2")
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+}
+
+func TestManager_RevokedSessionIsAnonymous(t *testing.T) {
+	m := New(NewInMemoryStore(), false, nil)
+	rr := httptest.NewRecorder()
+	s, err := m.Create(rr, httptest.NewRequest(http.MethodPost, "/login", nil), "user-1", "")
+	require.NoError(t, err)
+	require.NoError(t, m.Revoke(context.Background(), s.ID))
+
+	var found bool
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(sessionCookie(t, rr, m.CookieName))
+	rr = httptest.NewRecorder()
+	m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, found = auth.GetPrincipal(r.Context())
+	})).ServeHTTP(rr, req)
+	assert.False(t, found)
+	assert.Equal(t, -1, sessionCookie(t, rr, m.CookieName).MaxAge)
+}
+
+func TestManager_MarkMFAVerified(t *testing.T) {
+	m := New(NewInMemoryStore(), false, nil)
+	rr := httptest.NewRecorder()
+	s, err := m.Create(rr, httptest.NewRequest(http.MethodPost, "/login", nil), "user-1", "")
+	require.NoError(t, err)
+	require.NoError(t, m.SetMFAPending(context.Background(), s))
+
+	var principal *auth.Principal
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = auth.GetPrincipal(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(sessionCookie(t, rr, m.CookieName))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	require.NotNil(t, principal)
+	assert.True(t, principal.MFAPending)
+
+	req = httptest.NewRequest(http.MethodPost, "/mfa/verify", nil)
+	req.AddCookie(sessionCookie(t, rr, m.CookieName))
+	rr = httptest.NewRecorder()
+	require.NoError(t, m.MarkMFAVerified(rr, req))
+	cookie := sessionCookie(t, rr, m.CookieName)
+	assert.NotEqual(t, s.ID, cookie.Value, "step-up rotates the session")
+
+	principal = nil
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	require.NotNil(t, principal)
+	assert.True(t, principal.MFASatisfied(time.Minute, time.Now()))
+	assert.False(t, principal.MFAPending)
+}
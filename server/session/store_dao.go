@@ -0,0 +1,81 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Seann-Moser/QueryHelper"
+
+	"github.com/Seann-Moser/go-serve/pkg/db"
+)
+
+var _ Store = &DAOStore{}
+
+// DAOStore keeps sessions in a QueryHelper table registered on a db.DAO.
+type DAOStore struct {
+	table *QueryHelper.Table[Session]
+}
+
+// NewDAOStore registers the session table on the dao and returns a Store backed by it.
+func NewDAOStore(ctx context.Context, dao *db.DAO, dataset string) (*DAOStore, error) {
+	tableCtx, err := db.AddTable[Session](ctx, dao, dataset, QueryHelper.QueryTypeSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed adding session table: %w", err)
+	}
+	table, err := QueryHelper.GetTableCtx[Session](tableCtx)
+	if err != nil {
+		return nil, err
+	}
+	return &DAOStore{table: table}, nil
+}
+
+func (d *DAOStore) Create(ctx context.Context, s *Session) error {
+	if _, err := d.table.Insert(ctx, nil, *s); err != nil {
+		return fmt.Errorf("failed inserting session: %w", err)
+	}
+	return nil
+}
+
+func (d *DAOStore) Get(ctx context.Context, id string) (*Session, error) {
+	q := QueryHelper.QueryTable[Session](d.table)
+	sessions, err := q.Where(q.Column("id"), "=", "AND", 0, id).Run(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading session: %w", err)
+	}
+	if len(sessions) == 0 || sessions[0].Expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return sessions[0], nil
+}
+
+func (d *DAOStore) Update(ctx context.Context, s *Session) error {
+	return d.table.Update(ctx, nil, *s)
+}
+
+func (d *DAOStore) Delete(ctx context.Context, id string) error {
+	return d.table.NamedExec(ctx, nil,
+		fmt.Sprintf("DELETE FROM %s WHERE id = :id", d.table.FullTableName()),
+		map[string]interface{}{"id": id})
+}
+
+func (d *DAOStore) ListByUser(ctx context.Context, userID string) ([]*Session, error) {
+	q := QueryHelper.QueryTable[Session](d.table)
+	q.Where(q.Column("user_id"), "=", "AND", 0, userID).
+		Where(q.Column("expires_at"), ">", "AND", 0, time.Now().Unix())
+	return q.OrderBy(q.Column("created_at")).Run(ctx, nil)
+}
+
+func (d *DAOStore) DeleteByUser(ctx context.Context, userID string) error {
+	return d.table.NamedExec(ctx, nil,
+		fmt.Sprintf("DELETE FROM %s WHERE user_id = :user_id", d.table.FullTableName()),
+		map[string]interface{}{"user_id": userID})
+}
+
+// DeleteExpired removes sessions that expired before now. Redis and the in-memory store expire
+// sessions on their own; SQL tables need this run periodically.
+func (d *DAOStore) DeleteExpired(ctx context.Context, now time.Time) error {
+	return d.table.NamedExec(ctx, nil,
+		fmt.Sprintf("DELETE FROM %s WHERE expires_at < :expires_at", d.table.FullTableName()),
+		map[string]interface{}{"expires_at": now.Unix()})
+}
@@ -0,0 +1,95 @@
+package session
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+var _ Store = &InMemoryStore{}
+
+// InMemoryStore keeps sessions in a map. It is meant for tests and single instance services.
+type InMemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		sessions: map[string]*Session{},
+	}
+}
+
+func (m *InMemoryStore) Create(ctx context.Context, s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := *s
+	m.sessions[s.ID] = &c
+	return nil
+}
+
+func (m *InMemoryStore) Get(ctx context.Context, id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, found := m.sessions[id]
+	if !found {
+		return nil, ErrNotFound
+	}
+	if s.Expired(time.Now()) {
+		delete(m.sessions, id)
+		return nil, ErrNotFound
+	}
+	c := *s
+	return &c, nil
+}
+
+func (m *InMemoryStore) Update(ctx context.Context, s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, found := m.sessions[s.ID]; !found {
+		return ErrNotFound
+	}
+	c := *s
+	m.sessions[s.ID] = &c
+	return nil
+}
+
+func (m *InMemoryStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *InMemoryStore) ListByUser(ctx context.Context, userID string) ([]*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var output []*Session
+	for id, s := range m.sessions {
+		if s.Expired(now) {
+			delete(m.sessions, id)
+			continue
+		}
+		if s.UserID == userID {
+			c := *s
+			output = append(output, &c)
+		}
+	}
+	sort.Slice(output, func(i, j int) bool {
+		return output[i].CreatedAt < output[j].CreatedAt
+	})
+	return output, nil
+}
+
+func (m *InMemoryStore) DeleteByUser(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, s := range m.sessions {
+		if s.UserID == userID {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
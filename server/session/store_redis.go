@@ -0,0 +1,149 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var _ Store = &RedisStore{}
+
+// RedisStore keeps each session as a JSON value that expires with the session, plus a set of
+// session ids per user for listing and bulk revocation.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "session"
+	}
+	return &RedisStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (r *RedisStore) sessionKey(id string) string {
+	return fmt.Sprintf("%s:%s", r.prefix, id)
+}
+
+func (r *RedisStore) userKey(userID string) string {
+	return fmt.Sprintf("%s:user:%s", r.prefix, userID)
+}
+
+func (r *RedisStore) Create(ctx context.Context, s *Session) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(time.Unix(s.ExpiresAt, 0))
+	if ttl <= 0 {
+		return fmt.Errorf("session is already expired")
+	}
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, r.sessionKey(s.ID), b, ttl)
+		pipe.SAdd(ctx, r.userKey(s.UserID), s.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed storing session: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisStore) Get(ctx context.Context, id string) (*Session, error) {
+	b, err := r.client.Get(ctx, r.sessionKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed loading session: %w", err)
+	}
+	var s Session
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("failed decoding session: %w", err)
+	}
+	if s.Expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+func (r *RedisStore) Update(ctx context.Context, s *Session) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(time.Unix(s.ExpiresAt, 0))
+	if ttl <= 0 {
+		return r.Delete(ctx, s.ID)
+	}
+	// XX keeps a revoked session from being recreated by a concurrent request
+	updated, err := r.client.SetXX(ctx, r.sessionKey(s.ID), b, ttl).Result()
+	if err != nil {
+		return fmt.Errorf("failed updating session: %w", err)
+	}
+	if !updated {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *RedisStore) Delete(ctx context.Context, id string) error {
+	s, err := r.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, r.sessionKey(id))
+		pipe.SRem(ctx, r.userKey(s.UserID), id)
+		return nil
+	})
+	return err
+}
+
+func (r *RedisStore) ListByUser(ctx context.Context, userID string) ([]*Session, error) {
+	ids, err := r.client.SMembers(ctx, r.userKey(userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed listing sessions: %w", err)
+	}
+	var output []*Session
+	for _, id := range ids {
+		s, err := r.Get(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			// the session key expired on its own, drop the stale id
+			r.client.SRem(ctx, r.userKey(userID), id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		output = append(output, s)
+	}
+	sort.Slice(output, func(i, j int) bool {
+		return output[i].CreatedAt < output[j].CreatedAt
+	})
+	return output, nil
+}
+
+func (r *RedisStore) DeleteByUser(ctx context.Context, userID string) error {
+	ids, err := r.client.SMembers(ctx, r.userKey(userID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed listing sessions: %w", err)
+	}
+	keys := []string{r.userKey(userID)}
+	for _, id := range ids {
+		keys = append(keys, r.sessionKey(id))
+	}
+	return r.client.Del(ctx, keys...).Err()
+}
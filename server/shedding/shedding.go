@@ -0,0 +1,197 @@
+package shedding
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+	"github.com/Seann-Moser/go-serve/pkg/response"
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+const (
+	shedMaxConcurrencyFlag   = "shed-max-concurrency"
+	shedMinConcurrencyFlag   = "shed-min-concurrency"
+	shedAdaptiveFlag         = "shed-adaptive"
+	shedLatencyTargetFlag    = "shed-latency-target"
+	shedBackoffFlag          = "shed-backoff"
+	shedLowPriorityRatioFlag = "shed-low-priority-ratio"
+	shedRetryAfterFlag       = "shed-retry-after"
+	shedShowErrFlag          = "shed-show-err"
+)
+
+func Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("shedding", pflag.ExitOnError)
+	fs.Int(shedMaxConcurrencyFlag, 0, "in-flight requests before requests are shed, 0 disables shedding")
+	fs.Int(shedMinConcurrencyFlag, 10, "lowest limit the adaptive limit backs off to")
+	fs.Bool(shedAdaptiveFlag, false, "adapt the limit to latency, between the min and max concurrency")
+	fs.Duration(shedLatencyTargetFlag, 500*time.Millisecond, "latency above which the adaptive limit backs off")
+	fs.Float64(shedBackoffFlag, 0.9, "factor the adaptive limit is multiplied with on slow responses")
+	fs.Float64(shedLowPriorityRatioFlag, 0.8, "share of the limit low priority requests may use")
+	fs.Duration(shedRetryAfterFlag, time.Second, "Retry-After sent with shed requests")
+	fs.Bool(shedShowErrFlag, false, "return error in http response(not secure)")
+	return fs
+}
+
+// Shedder rejects requests with 503 once the in-flight requests reach the concurrency limit, so
+// a traffic spike degrades into fast failures instead of timeouts for everyone. Low priority
+// endpoints are shed at LowPriorityRatio of the limit; critical endpoints are never shed.
+//
+// With Adaptive the limit follows latency AIMD style: every response within LatencyTarget while
+// at least half the limit is in use raises it by one, every slower response multiplies it by
+// Backoff, bounded by MinConcurrency and MaxConcurrency.
+type Shedder struct {
+	MaxConcurrency   int
+	MinConcurrency   int
+	Adaptive         bool
+	LatencyTarget    time.Duration
+	Backoff          float64
+	LowPriorityRatio float64
+	RetryAfter       time.Duration
+	Response         *response.Response
+
+	inFlight atomic.Int64
+	shed     metric.Int64Counter
+
+	mu         sync.RWMutex
+	limit      float64
+	priorities endpoints.RouteOptions[endpoints.Priority]
+}
+
+func NewFromFlags() *Shedder {
+	s := New(viper.GetInt(shedMaxConcurrencyFlag), viper.GetBool(shedShowErrFlag))
+	s.MinConcurrency = viper.GetInt(shedMinConcurrencyFlag)
+	s.Adaptive = viper.GetBool(shedAdaptiveFlag)
+	s.LatencyTarget = viper.GetDuration(shedLatencyTargetFlag)
+	s.Backoff = viper.GetFloat64(shedBackoffFlag)
+	s.LowPriorityRatio = viper.GetFloat64(shedLowPriorityRatioFlag)
+	s.RetryAfter = viper.GetDuration(shedRetryAfterFlag)
+	return s
+}
+
+func New(maxConcurrency int, showError bool) *Shedder {
+	shed, err := otel.Meter("server-shedding").Int64Counter(
+		"server.shed",
+		metric.WithDescription("Number of requests shed under load."),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		ctxLogger.Warn(context.Background(), "failed creating shed counter", zap.Error(err))
+	}
+	return &Shedder{
+		MaxConcurrency:   maxConcurrency,
+		MinConcurrency:   10,
+		LatencyTarget:    500 * time.Millisecond,
+		Backoff:          0.9,
+		LowPriorityRatio: 0.8,
+		RetryAfter:       time.Second,
+		Response:         response.NewResponse(showError),
+		shed:             shed,
+		limit:            float64(maxConcurrency),
+	}
+}
+
+func (s *Shedder) Register(eps ...*endpoints.Endpoint) {
+	for _, e := range eps {
+		if e != nil && e.Priority != endpoints.PriorityNormal {
+			s.priorities.Set(e.URLPath, e.Priority)
+		}
+	}
+}
+
+// Limit returns the current concurrency limit.
+func (s *Shedder) Limit() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int(s.limit)
+}
+
+// InFlight returns the requests admitted and still being served.
+func (s *Shedder) InFlight() int64 {
+	return s.inFlight.Load()
+}
+
+func (s *Shedder) priority(r *http.Request) endpoints.Priority {
+	priority, _ := s.priorities.Get(r)
+	return priority
+}
+
+// reserve takes an in-flight slot for a request of priority p, returning the requests that were
+// running before it. The slot is taken with a compare and swap, so concurrent requests cannot all
+// pass the check before any of them is counted. Release the slot with s.inFlight.Add(-1).
+func (s *Shedder) reserve(p endpoints.Priority) (int64, bool) {
+	if p == endpoints.PriorityCritical {
+		return s.inFlight.Add(1) - 1, true
+	}
+	limit := float64(s.Limit())
+	if p == endpoints.PriorityLow {
+		limit *= s.LowPriorityRatio
+	}
+	for {
+		inFlight := s.inFlight.Load()
+		if float64(inFlight) >= limit {
+			return inFlight, false
+		}
+		if s.inFlight.CompareAndSwap(inFlight, inFlight+1) {
+			return inFlight, true
+		}
+	}
+}
+
+// observe adapts the limit to the latency of a request admitted with inFlight requests running.
+func (s *Shedder) observe(latency time.Duration, inFlight int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if latency > s.LatencyTarget {
+		s.limit = math.Max(s.limit*s.Backoff, float64(s.MinConcurrency))
+		return
+	}
+	// growing an idle limit would only allow a bigger spike later
+	if float64(inFlight)*2 >= s.limit {
+		s.limit = math.Min(s.limit+1, float64(s.MaxConcurrency))
+	}
+}
+
+// Middleware sheds requests over the limit with 503 and Retry-After, counting them in the
+// server.shed metric.
+func (s *Shedder) Middleware(next http.Handler) http.Handler {
+	if s.MaxConcurrency <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := s.priority(r)
+		inFlight, admitted := s.reserve(p)
+		if !admitted {
+			s.reject(w, r, p)
+			return
+		}
+		defer s.inFlight.Add(-1)
+		if !s.Adaptive || p == endpoints.PriorityCritical {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		s.observe(time.Since(start), inFlight)
+	})
+}
+
+func (s *Shedder) reject(w http.ResponseWriter, r *http.Request, p endpoints.Priority) {
+	if s.shed != nil {
+		s.shed.Add(r.Context(), 1, metric.WithAttributes(attribute.Int("priority", int(p))))
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(s.RetryAfter.Seconds()))))
+	s.Response.Error(r, w, nil, http.StatusServiceUnavailable, "server overloaded, try again later")
+}
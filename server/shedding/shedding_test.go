@@ -0,0 +1,128 @@
+package shedding
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Seann-Moser/go-serve/server/endpoints"
+)
+
+func TestShedder_Middleware(t *testing.T) {
+	s := New(2, false)
+	s.LowPriorityRatio = 0.5
+	release := make(chan struct{})
+	started := make(chan struct{})
+	blocking := func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	low := endpoints.NewEndpoint("/", "/report", "", ok)
+	low.Priority = endpoints.PriorityLow
+	health := endpoints.NewEndpoint("/", "/livez", "", ok)
+	health.Priority = endpoints.PriorityCritical
+	eps := []*endpoints.Endpoint{endpoints.NewEndpoint("/", "/slow", "", blocking), endpoints.NewEndpoint("/", "/items", "", ok), low, health}
+	router := mux.NewRouter()
+	for _, e := range eps {
+		router.HandleFunc(e.URLPath, e.HandlerFunc)
+	}
+	s.Register(eps...)
+	router.Use(s.Middleware)
+	do := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		do("/slow")
+	}()
+	<-started
+
+	assert.Equal(t, http.StatusServiceUnavailable, do("/report").Code, "low priority is shed at half the limit")
+	assert.Equal(t, http.StatusOK, do("/items").Code)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		do("/slow")
+	}()
+	<-started
+	require.Equal(t, int64(2), s.InFlight())
+
+	w := do("/items")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, do("/livez").Code, "critical endpoints are never shed")
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, http.StatusOK, do("/items").Code)
+}
+
+func TestShedder_Adaptive(t *testing.T) {
+	s := New(20, false)
+	s.MinConcurrency = 5
+	s.LatencyTarget = 100 * time.Millisecond
+
+	s.observe(time.Second, 0)
+	assert.Equal(t, 18, s.Limit())
+	for i := 0; i < 50; i++ {
+		s.observe(time.Second, 0)
+	}
+	assert.Equal(t, 5, s.Limit(), "backs off no further than the min")
+
+	s.observe(time.Millisecond, 0)
+	assert.Equal(t, 5, s.Limit(), "an idle limit does not grow")
+	s.observe(time.Millisecond, 3)
+	assert.Equal(t, 6, s.Limit())
+	for i := 0; i < 50; i++ {
+		s.observe(time.Millisecond, 20)
+	}
+	assert.Equal(t, 20, s.Limit(), "grows no further than the max")
+}
+
+func TestShedder_ConcurrentAdmission(t *testing.T) {
+	s := New(5, false)
+	release := make(chan struct{})
+	var admitted, shed atomic.Int64
+	handler := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admitted.Add(1)
+		<-release
+	}))
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items", nil))
+			if w.Code == http.StatusServiceUnavailable {
+				shed.Add(1)
+			}
+		}()
+	}
+	close(start)
+	// every request is either blocked in the handler or shed
+	require.Eventually(t, func() bool { return admitted.Load()+shed.Load() == 50 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, int64(5), admitted.Load(), "a burst cannot pass the limit before being counted")
+	assert.Equal(t, int64(5), s.InFlight())
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int64(0), s.InFlight())
+}
@@ -0,0 +1,100 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+)
+
+// CertReloader serves a certificate and key pair from disk and reloads it when the files change,
+// so rotated certificates are picked up without a restart.
+type CertReloader struct {
+	CertFile string
+	KeyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewCertReloader loads the pair once; a pair that cannot be loaded at startup is an error.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	c := &CertReloader{CertFile: certFile, KeyFile: keyFile}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload reads the pair again. The previous certificate stays in use when it fails.
+func (c *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed loading tls certificate: %w", err)
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	return nil
+}
+
+// GetCertificate fits tls.Config.GetCertificate.
+func (c *CertReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// Watch reloads the pair when the files change until ctx is done. The directories are watched
+// rather than the files, so atomic renames and the symlink swaps of mounted kubernetes secrets
+// are seen. Events are debounced because writers usually touch both files.
+func (c *CertReloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed creating certificate watcher: %w", err)
+	}
+	defer watcher.Close()
+	dirs := map[string]bool{filepath.Dir(c.CertFile): true, filepath.Dir(c.KeyFile): true}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("failed watching %s: %w", dir, err)
+		}
+	}
+
+	const debounce = 100 * time.Millisecond
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			timer.Reset(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			ctxLogger.Warn(ctx, "certificate watcher error", zap.Error(err))
+		case <-timer.C:
+			if err := c.Reload(); err != nil {
+				ctxLogger.Error(ctx, "failed reloading tls certificate, keeping the previous one", zap.Error(err))
+				continue
+			}
+			ctxLogger.Info(ctx, "reloaded tls certificate", zap.String("cert_file", c.CertFile))
+		}
+	}
+}
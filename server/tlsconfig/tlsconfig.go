@@ -0,0 +1,199 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/Seann-Moser/go-serve/pkg/ctxLogger"
+)
+
+const (
+	tlsCertFileFlag         = "tls-cert-file"
+	tlsKeyFileFlag          = "tls-key-file"
+	tlsMinVersionFlag       = "tls-min-version"
+	tlsCipherSuitesFlag     = "tls-cipher-suites"
+	tlsRedirectPortFlag     = "tls-redirect-port"
+	tlsHSTSMaxAgeFlag       = "tls-hsts-max-age"
+	tlsHSTSSubdomainsFlag   = "tls-hsts-include-subdomains"
+	tlsHSTSPreloadFlag      = "tls-hsts-preload"
+	tlsWatchCertificateFlag = "tls-watch-certificate"
+)
+
+func Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("tls", pflag.ExitOnError)
+	fs.String(tlsCertFileFlag, "", "pem certificate chain, tls is disabled when empty")
+	fs.String(tlsKeyFileFlag, "", "pem private key of the certificate")
+	fs.String(tlsMinVersionFlag, "1.2", "minimum tls version: 1.2 or 1.3")
+	fs.StringSlice(tlsCipherSuitesFlag, nil, "allowed tls 1.2 cipher suite names, go defaults when empty")
+	fs.String(tlsRedirectPortFlag, "", "port of a plain http listener redirecting to https, disabled when empty")
+	fs.Duration(tlsHSTSMaxAgeFlag, 0, "Strict-Transport-Security max-age, disabled when 0")
+	fs.Bool(tlsHSTSSubdomainsFlag, false, "add includeSubDomains to Strict-Transport-Security")
+	fs.Bool(tlsHSTSPreloadFlag, false, "add preload to Strict-Transport-Security")
+	fs.Bool(tlsWatchCertificateFlag, true, "reload the certificate when its files change")
+	return fs
+}
+
+// TLS is the https policy of a server: the reloading certificate, protocol and cipher limits,
+// HSTS, and an optional http listener redirecting to https.
+type TLS struct {
+	Certificate       *CertReloader
+	MinVersion        uint16
+	CipherSuites      []uint16
+	RedirectPort      string
+	HSTSMaxAge        time.Duration
+	HSTSSubdomains    bool
+	HSTSPreload       bool
+	WatchCertificates bool
+}
+
+// NewFromFlags returns nil when no certificate is configured.
+func NewFromFlags() (*TLS, error) {
+	certFile, keyFile := viper.GetString(tlsCertFileFlag), viper.GetString(tlsKeyFileFlag)
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	t, err := New(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if t.MinVersion, err = ParseVersion(viper.GetString(tlsMinVersionFlag)); err != nil {
+		return nil, err
+	}
+	if t.CipherSuites, err = ParseCipherSuites(viper.GetStringSlice(tlsCipherSuitesFlag)); err != nil {
+		return nil, err
+	}
+	t.RedirectPort = viper.GetString(tlsRedirectPortFlag)
+	t.HSTSMaxAge = viper.GetDuration(tlsHSTSMaxAgeFlag)
+	t.HSTSSubdomains = viper.GetBool(tlsHSTSSubdomainsFlag)
+	t.HSTSPreload = viper.GetBool(tlsHSTSPreloadFlag)
+	t.WatchCertificates = viper.GetBool(tlsWatchCertificateFlag)
+	return t, nil
+}
+
+func New(certFile, keyFile string) (*TLS, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("tls needs both a certificate and a key file")
+	}
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &TLS{
+		Certificate:       reloader,
+		MinVersion:        tls.VersionTLS12,
+		WatchCertificates: true,
+	}, nil
+}
+
+// ParseVersion converts "1.2" or "1.3".
+func ParseVersion(version string) (uint16, error) {
+	switch version {
+	case "1.2", "":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported tls version %q", version)
+}
+
+// ParseCipherSuites converts cipher suite names, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+// Insecure suites are refused.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, found := known[strings.TrimSpace(name)]
+		if !found {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Apply sets the certificate and protocol policy on a copy of base, or a new config, keeping
+// other settings such as client certificate verification.
+func (t *TLS) Apply(base *tls.Config) *tls.Config {
+	var config *tls.Config
+	if base != nil {
+		config = base.Clone()
+	} else {
+		config = &tls.Config{}
+	}
+	config.Certificates = nil
+	config.GetCertificate = t.Certificate.GetCertificate
+	config.MinVersion = t.MinVersion
+	config.CipherSuites = t.CipherSuites
+	return config
+}
+
+// HSTSHeader returns the Strict-Transport-Security value, empty when HSTS is disabled.
+func (t *TLS) HSTSHeader() string {
+	if t.HSTSMaxAge <= 0 {
+		return ""
+	}
+	value := "max-age=" + strconv.FormatInt(int64(t.HSTSMaxAge.Seconds()), 10)
+	if t.HSTSSubdomains {
+		value += "; includeSubDomains"
+	}
+	if t.HSTSPreload {
+		value += "; preload"
+	}
+	return value
+}
+
+// HSTSMiddleware sets Strict-Transport-Security on responses to https requests.
+func (t *TLS) HSTSMiddleware(next http.Handler) http.Handler {
+	header := t.HSTSHeader()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if header != "" && r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", header)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RedirectHandler permanently redirects to the same url on https at httpsPort.
+func RedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
+
+// Run watches the certificate until ctx is done. The redirect listener is served by the server,
+// see RedirectHandler.
+func (t *TLS) Run(ctx context.Context) {
+	if !t.WatchCertificates {
+		return
+	}
+	go func() {
+		if err := t.Certificate.Watch(ctx); err != nil {
+			ctxLogger.Error(ctx, "failed watching tls certificate", zap.Error(err))
+		}
+	}()
+}
@@ -0,0 +1,102 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeCert(t *testing.T, dir, cn string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, c *CertReloader) string {
+	cert, err := c.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader_Watch(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "first")
+	c, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, c))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Watch(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+
+	writeCert(t, dir, "second")
+	assert.Eventually(t, func() bool { return commonName(t, c) == "second" }, 5*time.Second, 20*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(certFile, []byte("broken"), 0o600))
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, "second", commonName(t, c), "a broken pair keeps the previous certificate")
+}
+
+func TestTLS_Policy(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir(), "server")
+	tlsPolicy, err := New(certFile, keyFile)
+	require.NoError(t, err)
+	tlsPolicy.HSTSMaxAge = 365 * 24 * time.Hour
+	tlsPolicy.HSTSSubdomains = true
+
+	config := tlsPolicy.Apply(&tls.Config{ClientAuth: tls.VerifyClientCertIfGiven})
+	assert.Equal(t, tls.VerifyClientCertIfGiven, config.ClientAuth)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+	assert.NotNil(t, config.GetCertificate)
+
+	_, err = ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"})
+	assert.Error(t, err)
+	suites, err := ParseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"})
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, suites)
+
+	handler := tlsPolicy.HSTSMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/", nil))
+	assert.Equal(t, "max-age=31536000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"), "hsts is only sent over https")
+
+	w = httptest.NewRecorder()
+	RedirectHandler("8443").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com:8080/a?b=c", nil))
+	assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+	assert.Equal(t, "https://example.com:8443/a?b=c", w.Header().Get("Location"))
+}